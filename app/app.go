@@ -4,13 +4,21 @@ package app
 ////////////////////////////////////////////////////////////////////////////////
 
 import (
+	"fmt"
+	"log"
+	"sort"
 	"strings"
-
-	bittrex "github.com/toorop/go-bittrex"
+	"sync"
+	"time"
 
 	"github.com/sabhiram/trade-bot/app/db"
+	"github.com/sabhiram/trade-bot/exchange"
+	"github.com/sabhiram/trade-bot/history"
 	"github.com/sabhiram/trade-bot/hub"
-	"github.com/sabhiram/trade-bot/server/socket"
+	"github.com/sabhiram/trade-bot/indicator"
+	"github.com/sabhiram/trade-bot/market"
+	"github.com/sabhiram/trade-bot/orders"
+	"github.com/sabhiram/trade-bot/risk"
 	"github.com/sabhiram/trade-bot/types"
 )
 
@@ -20,52 +28,108 @@ import (
 // session.  The app instance will be used to issue new requests to the upstream
 // APIs and push state to various clients via open/subscribed websockets.
 type App struct {
-	config *types.Config // app config
-	db     *db.DB        // local "database" of tracked session(s)
-	hub    *hub.Hub
-	client *bittrex.Bittrex // bittrex client
+	sync.Mutex // guards monitors, watched, recon and rejections
+
+	config   *types.Config     // app config
+	db       *db.DB            // local "database" of tracked session(s)
+	hub      *hub.Hub          // websocket hub
+	exchange exchange.Exchange // upstream exchange (bittrex, paper, ...)
+	market   *market.Service   // streamed market data for active sessions
+	orders   *orders.Manager   // lifecycle of the orders placed by sessions
+	risk     *risk.Checker     // checks every order before it is placed
+
+	candles    *history.Store     // local candle store
+	indicators *indicator.Source  // candles and indicators, shared by sessions
+	snapshots  *history.Snapshots // portfolio snapshot series
+
+	monitors map[types.UUID]*monitor // running session monitors
+	watched  map[string]int          // markets clients follow, by subscriber
+	recon    *Reconciliation         // last reconciliation of orders
+
+	rejections []*risk.Rejection // recent orders rejected by the risk checks
 }
 
-func New(config *types.Config, h *hub.Hub) (*App, error) {
+// New returns an instance of App which trades against the exchange `ex`.
+func New(config *types.Config, h *hub.Hub, ex exchange.Exchange) (*App, error) {
 	d, err := db.New(config.DbPath)
 	if err != nil {
 		return nil, err
 	}
 
 	app := &App{
-		config: config,
-		db:     d,
-		hub:    h,
-		client: bittrex.New(config.ApiKey, config.Secret),
+		config:   config,
+		db:       d,
+		hub:      h,
+		exchange: ex,
+		monitors: map[types.UUID]*monitor{},
+		watched:  map[string]int{},
+	}
+	tracked, err := d.GetOrders()
+	if err != nil {
+		return nil, err
+	}
+	app.orders = orders.New(ex, tracked, app.onOrderEvent)
+	app.market = market.New(ex, app.onMarketUpdate)
+	app.market.OnFills = app.onMarketFills
+	if app.candles, err = history.New(config.CandleDir, ex); err != nil {
+		return nil, err
+	}
+	app.indicators = indicator.NewSource(app.candles, indicator.DefaultRefresh)
+	if app.snapshots, err = history.NewSnapshots(config.SnapshotPath); err != nil {
+		return nil, err
+	}
+	if app.risk, err = app.newRiskChecker(); err != nil {
+		return nil, err
+	}
+
+	if err := app.UpdateBalances(false); err != nil {
+		return nil, err
+	}
+
+	// Flag orders that were placed (or lost) while we were not running.
+	if _, err := app.Reconcile(); err != nil {
+		return nil, err
 	}
 
-	return app, app.UpdateBalances(false)
+	// Pick up monitoring any sessions that were active when we last exited.
+	return app, app.resumeSessions()
 }
 
 ////////////////////////////////////////////////////////////////////////////////
 
-// UpdateBalances updates balances using the bitterx client and pushes the new
-// balances to the `db`.
-func (a *App) UpdateBalances(broadcast bool) error {
-	// Fetch current balances from bittrex.
-	balances, err := a.client.GetBalances()
+// FetchBalances returns the non-zero (or pending) balances held on the
+// exchange `ex` along with their estimated value.
+func FetchBalances(ex exchange.Exchange) ([]*types.Balance, error) {
+	balances, err := ex.GetBalances()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Pull relevant balances into our own format.
 	bs := []*types.Balance{}
 	for _, b := range balances {
-		ava, _ := b.Available.Float64()
-		bal, _ := b.Balance.Float64()
-		if bal > 0.0 {
+		if b.Balance.Sign() > 0 || b.Pending.Sign() > 0 {
 			bs = append(bs, &types.Balance{
-				Currency:  strings.ToUpper(b.Currency),
-				Available: ava,
-				Total:     bal,
+				Currency:      b.Currency,
+				Available:     b.Available,
+				Total:         b.Balance,
+				Pending:       b.Pending,
+				CryptoAddress: b.CryptoAddress,
 			})
 		}
 	}
+	valueBalances(ex, bs)
+	return bs, nil
+}
+
+// UpdateBalances updates balances using the exchange and pushes the new
+// balances to the `db`.
+func (a *App) UpdateBalances(broadcast bool) error {
+	// Fetch current balances from the exchange.
+	bs, err := FetchBalances(a.exchange)
+	if err != nil {
+		return err
+	}
 
 	// Update the db.
 	err = a.db.UpdateBalances(bs)
@@ -80,36 +144,353 @@ func (a *App) UpdateBalances(broadcast bool) error {
 	return nil
 }
 
-// BroadcastBalances pushes the latest balance state to all connected clients.
+// BroadcastBalances pushes the latest balance state to the clients subscribed
+// to balance updates.
 func (a *App) BroadcastBalances() error {
 	bal, err := a.db.GetBalances()
 	if err != nil {
 		return err
 	}
 
-	bs, err := types.NewSocketMessage("Balance", bal).Marshal()
+	if err := a.broadcast(hub.TopicBalance, "Balance", bal); err != nil {
+		return err
+	}
+	return a.BroadcastPortfolio()
+}
+
+// broadcast pushes a message of type `t` to the clients subscribed to `topic`.
+func (a *App) broadcast(topic, t string, data interface{}) error {
+	bs, err := types.NewTopicMessage(topic, t, data).Marshal()
 	if err != nil {
 		return err
 	}
 
-	a.hub.Broadcast(bs)
+	a.hub.BroadcastTopic(topic, bs)
 	return nil
 }
 
-// SendBalances pushes the latest balance state to the specified socket.
-func (a *App) SendBalances(sock *socket.Socket) error {
-	bal, err := a.db.GetBalances()
+// Snapshot returns the message with the current state of `topic`, which is
+// sent to a client when it subscribes to the topic.
+func (a *App) Snapshot(topic string) (*types.SocketMessage, error) {
+	var (
+		t    string
+		data interface{}
+		err  error
+	)
+
+	kind, arg := hub.ParseTopic(topic)
+	switch {
+	case kind == hub.TopicBalance && len(arg) == 0:
+		t = "Balance"
+		data, err = a.db.GetBalances()
+	case kind == hub.TopicPortfolio && len(arg) == 0:
+		t = "Portfolio"
+		data, err = a.GetPortfolio()
+	case kind == hub.TopicSessions && len(arg) == 0:
+		t = "Sessions"
+		data, err = a.db.GetSessions()
+	case kind == hub.TopicOrders && len(arg) == 0:
+		t = "OpenOrders"
+		data, err = a.exchange.GetOpenOrders(exchange.AllMarkets)
+	case kind == hub.TopicReconciliation && len(arg) == 0:
+		t = "Reconciliation"
+		data, err = a.GetReconciliation()
+	case kind == hub.TopicRisk && len(arg) == 0:
+		t = "Rejections"
+		data, err = a.GetRejections()
+	case kind == hub.TopicKillSwitch && len(arg) == 0:
+		t = "KillSwitch"
+		data, err = a.GetKillSwitch()
+	case kind == hub.TopicTicker && len(arg) > 0:
+		t = "Ticker"
+		data, err = a.getTickerUpdate(arg)
+	case kind == hub.TopicSession && len(arg) > 0:
+		t = "Session"
+		data, err = a.db.GetSession(types.UUID(arg))
+	default:
+		return nil, &ValidationError{fmt.Errorf("unknown topic %q", topic)}
+	}
+
 	if err != nil {
-		return err
+		return nil, err
+	}
+	return types.NewTopicMessage(topic, t, data), nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// ValidationError is returned when a request made to the app is invalid, as
+// opposed to failing due to the exchange or the db.
+type ValidationError struct {
+	Err error
+}
+
+func (e *ValidationError) Error() string {
+	return e.Err.Error()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Version returns the version of the running trade-bot.
+func (a *App) Version() string {
+	return a.config.Version
+}
+
+// ExchangeName returns the name of the exchange the app is trading against.
+func (a *App) ExchangeName() string {
+	return a.exchange.Name()
+}
+
+// GetBalances returns the last known balances.
+func (a *App) GetBalances() ([]*types.Balance, error) {
+	return a.db.GetBalances()
+}
+
+// GetMarkets returns all markets listed on the exchange.
+func (a *App) GetMarkets() ([]exchange.Market, error) {
+	return a.exchange.GetMarkets()
+}
+
+// GetTicker returns the current ticker for `market`, streamed if the market
+// has active sessions.
+func (a *App) GetTicker(market string) (exchange.Ticker, error) {
+	return a.streamed().GetTicker(market)
+}
+
+// TickerUpdate is the ticker for a single market as pushed to clients.
+type TickerUpdate struct {
+	Market string
+	Ticker exchange.Ticker
+}
+
+// getTickerUpdate returns the current ticker of `market` as pushed to clients.
+func (a *App) getTickerUpdate(market string) (*TickerUpdate, error) {
+	market = strings.ToUpper(market)
+	t, err := a.GetTicker(market)
+	if err != nil {
+		return nil, err
+	}
+	return &TickerUpdate{Market: market, Ticker: t}, nil
+}
+
+// WatchMarket follows `market` on behalf of a client, its ticker is pushed
+// until every client that watched it has unwatched it.
+func (a *App) WatchMarket(market string) {
+	a.Lock()
+	defer a.Unlock()
+	a.watched[strings.ToUpper(market)]++
+}
+
+// UnwatchMarket releases a client's watch of `market`.
+func (a *App) UnwatchMarket(market string) {
+	a.Lock()
+	defer a.Unlock()
+
+	market = strings.ToUpper(market)
+	if a.watched[market] > 1 {
+		a.watched[market]--
+	} else {
+		delete(a.watched, market)
+	}
+}
+
+// WatchedMarkets returns the markets followed for clients.
+func (a *App) WatchedMarkets() []string {
+	a.Lock()
+	defer a.Unlock()
+
+	ms := []string{}
+	for m := range a.watched {
+		ms = append(ms, m)
+	}
+	sort.Strings(ms)
+	return ms
+}
+
+// GetDepth returns the best `n` levels of the order book for `m` along with
+// their cumulative volume, from the local book if the market is streamed.
+func (a *App) GetDepth(m string, n int) (*market.Depth, error) {
+	m = strings.ToUpper(m)
+	if d, ok := a.market.Depth(m, n); ok {
+		return d, nil
+	}
+
+	ob, err := a.exchange.GetOrderBook(m)
+	if err != nil {
+		return nil, err
+	}
+	b := market.NewBook(m)
+	b.Reset(ob)
+	return b.Depth(n), nil
+}
+
+// Chart is the candle history of a market along with indicators computed over
+// it, keyed by their canonical spec.
+type Chart struct {
+	Market     string
+	Interval   string
+	Candles    []exchange.Candle
+	Indicators map[string][]indicator.Point
+}
+
+// GetChart returns the last `n` candles (all if `n` <= 0) of `m` at `interval`
+// along with the indicators `specs` (ex: "sma(20)") over them.
+func (a *App) GetChart(m, interval string, specs []string, n int) (*Chart, error) {
+	for _, spec := range specs {
+		if _, err := indicator.Parse(spec); err != nil {
+			return nil, &ValidationError{err}
+		}
+	}
+	if err := exchange.ValidateMarket(m); err != nil {
+		return nil, &ValidationError{err}
+	}
+	if err := exchange.ValidateInterval(interval); err != nil {
+		return nil, &ValidationError{err}
 	}
 
-	bs, err := types.NewSocketMessage("Balance", bal).Marshal()
+	s, err := a.indicators.Series(m, interval)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Chart{
+		Market:     s.Market,
+		Interval:   s.Interval,
+		Candles:    s.Candles(n),
+		Indicators: map[string][]indicator.Point{},
+	}
+	for _, spec := range specs {
+		ps, err := s.Points(spec, n)
+		if err != nil {
+			return nil, err
+		}
+		key, _ := indicator.Parse(spec)
+		c.Indicators[key] = ps
+	}
+	return c, nil
+}
+
+// GetCandles returns the stored candles of `m` at `interval` from `from` to
+// `to` (a zero time leaves that end open), bringing the store up to date
+// first.
+func (a *App) GetCandles(m, interval string, from, to time.Time) ([]exchange.Candle, error) {
+	if err := exchange.ValidateMarket(m); err != nil {
+		return nil, &ValidationError{err}
+	}
+	if err := exchange.ValidateInterval(interval); err != nil {
+		return nil, &ValidationError{err}
+	}
+	if _, err := a.candles.Update(m, interval); err != nil {
+		return nil, err
+	}
+	return a.candles.Range(m, interval, from, to)
+}
+
+// GetOpenOrders returns the open orders for `market` (or all markets).
+func (a *App) GetOpenOrders(market string) ([]exchange.Order, error) {
+	return a.exchange.GetOpenOrders(market)
+}
+
+// GetOrderHistory returns the closed orders for `market` (or all markets).
+func (a *App) GetOrderHistory(market string) ([]exchange.Order, error) {
+	return a.exchange.GetOrderHistory(market)
+}
+
+// GetTrackedOrders returns the orders placed by the session `id`, or by any
+// session if `id` is empty.
+func (a *App) GetTrackedOrders(id types.UUID) ([]*types.Order, error) {
+	return a.orders.List(id), nil
+}
+
+// onOrderEvent persists tracked orders as they change and pushes them to the
+// clients following orders and the order's session.
+func (a *App) onOrderEvent(e orders.Event) {
+	o := e.Order
+	if len(e.Previous) == 0 {
+		log.Printf("Orders :: tracking %s %s on %s (%s)\n", o.Type, o.UUID, o.Market, o.State)
+	} else {
+		log.Printf("Orders :: %s %s -> %s, filled %s @ %s\n", o.UUID, e.Previous, o.State, o.QuantityFilled, o.AveragePrice.StringFixed(8))
+	}
+
+	if err := a.db.UpdateOrder(o); err != nil {
+		log.Printf("Orders :: unable to save %s :: %s\n", o.UUID, err.Error())
+	}
+	if err := a.broadcast(hub.TopicOrders, "Order", o); err != nil {
+		log.Printf("Orders :: unable to broadcast :: %s\n", err.Error())
+	}
+	if len(o.Session) > 0 {
+		a.broadcastSessionMessage(o.Session, "Order", o)
+	}
+}
+
+// pruneOrders stops tracking (and drops from the db) the orders which closed
+// more than the order retention ago, unless their session is still active.
+func (a *App) pruneOrders() error {
+	ss, err := a.db.GetSessions()
 	if err != nil {
 		return err
 	}
+	active := map[types.UUID]bool{}
+	for _, s := range ss {
+		if s.IsActive() {
+			active[s.ID] = true
+		}
+	}
 
-	sock.Send(bs)
-	return nil
+	uuids := a.orders.Prune(time.Now().Add(-a.config.OrderRetention), func(id types.UUID) bool {
+		return active[id]
+	})
+	if len(uuids) == 0 {
+		return nil
+	}
+	log.Printf("Orders :: pruned %d closed orders\n", len(uuids))
+	return a.db.DeleteOrders(uuids)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// streamingExchange is the app's exchange with tickers and order books served
+// from the market data service for streamed markets.
+type streamingExchange struct {
+	exchange.Exchange
+	market *market.Service
+}
+
+func (e *streamingExchange) GetTicker(m string) (exchange.Ticker, error) {
+	if t, ok := e.market.Ticker(m); ok {
+		return t, nil
+	}
+	return e.Exchange.GetTicker(m)
+}
+
+func (e *streamingExchange) GetOrderBook(m string) (exchange.OrderBook, error) {
+	if ob, ok := e.market.OrderBook(m); ok {
+		return ob, nil
+	}
+	return e.Exchange.GetOrderBook(m)
+}
+
+// streamed returns the exchange with streamed tickers.
+func (a *App) streamed() exchange.Exchange {
+	return &streamingExchange{Exchange: a.exchange, market: a.market}
+}
+
+// tradingExchange returns the streamed exchange which the session `id` places
+// orders through, each order is risk checked and then tracked.
+func (a *App) tradingExchange(id types.UUID) exchange.Exchange {
+	return a.orders.Exchange(a.risk.Exchange(a.streamed(), id), id)
+}
+
+// onMarketFills refreshes the tracked orders of markets which traded.
+func (a *App) onMarketFills(m string, fs []exchange.Fill) {
+	a.orders.Wake(m)
+}
+
+// onMarketUpdate pushes streamed tickers to subscribed clients.
+func (a *App) onMarketUpdate(m string, t exchange.Ticker) {
+	if err := a.broadcast(hub.TickerTopic(m), "Ticker", &TickerUpdate{Market: m, Ticker: t}); err != nil {
+		log.Printf("Market %s :: unable to broadcast :: %s\n", m, err.Error())
+	}
 }
 
 ////////////////////////////////////////////////////////////////////////////////
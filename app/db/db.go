@@ -4,8 +4,10 @@ package db
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"log"
 	"os"
 	"sync"
 
@@ -14,10 +16,28 @@ import (
 
 ////////////////////////////////////////////////////////////////////////////////
 
+var (
+	ErrSessionNotFound = errors.New("session not found")
+	ErrSessionExists   = errors.New("session already exists")
+)
+
+// version is the current layout of the db file, older files are migrated when
+// they are loaded:
+//
+//	0: balances stored as JSON numbers (floats)
+//	1: amounts stored as decimal strings
+const version = 1
+
+////////////////////////////////////////////////////////////////////////////////
+
 // db is a JSON serialize-able structure.
 type db struct {
+	Version  int              `json:"Version"`
 	Balances []*types.Balance `json:"Balances"`
 	Sessions []*types.Session `json:"Sessions"`
+	Orders   []*types.Order   `json:"Orders"`
+
+	KillSwitch types.KillSwitch `json:"KillSwitch"`
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -41,8 +61,10 @@ func New(dbPath string) (*DB, error) {
 
 		dbPath: dbPath,
 		db: &db{
+			Version:  version,
 			Balances: []*types.Balance{},
 			Sessions: []*types.Session{},
+			Orders:   []*types.Order{},
 		},
 	}
 
@@ -60,14 +82,35 @@ func (d *DB) Load() error {
 	}
 
 	d.Lock()
-	defer d.Unlock()
-
 	bs, err := ioutil.ReadFile(d.dbPath)
-	if err != nil {
+	if err == nil {
+		d.db.Version = 0
+		err = json.Unmarshal(bs, &d.db)
+	}
+	old := d.db.Version
+	if err == nil && old < version {
+		migrate(d.db)
+	}
+	d.Unlock()
+
+	if err != nil || old >= version {
 		return err
 	}
+	log.Printf("DB :: migrated %s from version %d to %d\n", d.dbPath, old, version)
+	return d.Flush()
+}
 
-	return json.Unmarshal(bs, &d.db)
+// migrate upgrades the db `d` to the current version.
+func migrate(d *db) {
+	if d.Version < 1 {
+		// Float balances may carry binary rounding noise beyond the 8 decimal
+		// places that the exchange deals in.
+		for _, b := range d.Balances {
+			b.Available = b.Available.Round(8)
+			b.Total = b.Total.Round(8)
+		}
+	}
+	d.Version = version
 }
 
 // Flush writes the database to the stored `dbPath`.
@@ -98,6 +141,13 @@ func (d *DB) Dump() error {
 		fmt.Printf("Found session: %#v\n", ses)
 	}
 
+	fmt.Printf("Kill switch: %#v\n", d.db.KillSwitch)
+
+	fmt.Printf("Dumping Orders\n")
+	for _, ord := range d.db.Orders {
+		fmt.Printf("Found order: %#v\n", ord)
+	}
+
 	return nil
 }
 
@@ -124,3 +174,175 @@ func (d *DB) GetBalances() ([]*types.Balance, error) {
 }
 
 ////////////////////////////////////////////////////////////////////////////////
+
+// AddSession adds a new session to the db.
+func (d *DB) AddSession(s *types.Session) error {
+	d.Lock()
+	for _, ses := range d.db.Sessions {
+		if ses.ID == s.ID {
+			d.Unlock()
+			return ErrSessionExists
+		}
+	}
+	d.db.Sessions = append(d.db.Sessions, s.Clone())
+	d.Unlock()
+
+	return d.Flush()
+}
+
+// UpdateSession replaces the stored session with the same ID as `s`.
+func (d *DB) UpdateSession(s *types.Session) error {
+	d.Lock()
+	found := false
+	for i, ses := range d.db.Sessions {
+		if ses.ID == s.ID {
+			d.db.Sessions[i] = s.Clone()
+			found = true
+			break
+		}
+	}
+	d.Unlock()
+
+	if !found {
+		return ErrSessionNotFound
+	}
+	return d.Flush()
+}
+
+// GetSessions returns copies of all sessions in the db.
+func (d *DB) GetSessions() ([]*types.Session, error) {
+	ss := []*types.Session{}
+
+	d.RLock()
+	for _, ses := range d.db.Sessions {
+		ss = append(ss, ses.Clone())
+	}
+	d.RUnlock()
+
+	return ss, nil
+}
+
+// GetSession returns a copy of the session with the given `id`.
+func (d *DB) GetSession(id types.UUID) (*types.Session, error) {
+	d.RLock()
+	defer d.RUnlock()
+
+	for _, ses := range d.db.Sessions {
+		if ses.ID == id {
+			return ses.Clone(), nil
+		}
+	}
+	return nil, ErrSessionNotFound
+}
+
+// DeleteSession removes the session with the given `id` from the db.
+func (d *DB) DeleteSession(id types.UUID) error {
+	d.Lock()
+	found := false
+	for i, ses := range d.db.Sessions {
+		if ses.ID == id {
+			d.db.Sessions = append(d.db.Sessions[:i], d.db.Sessions[i+1:]...)
+			found = true
+			break
+		}
+	}
+	d.Unlock()
+
+	if !found {
+		return ErrSessionNotFound
+	}
+	return d.Flush()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// UpdateOrder adds the order `o` to the db, or replaces the stored order with
+// the same UUID.
+func (d *DB) UpdateOrder(o *types.Order) error {
+	d.Lock()
+	found := false
+	for i, ord := range d.db.Orders {
+		if ord.UUID == o.UUID {
+			d.db.Orders[i] = o.Clone()
+			found = true
+			break
+		}
+	}
+	if !found {
+		d.db.Orders = append(d.db.Orders, o.Clone())
+	}
+	d.Unlock()
+
+	return d.Flush()
+}
+
+// DeleteOrders removes the orders `uuids` from the db.
+func (d *DB) DeleteOrders(uuids []string) error {
+	del := map[string]bool{}
+	for _, uuid := range uuids {
+		del[uuid] = true
+	}
+
+	d.Lock()
+	ords := []*types.Order{}
+	for _, ord := range d.db.Orders {
+		if !del[ord.UUID] {
+			ords = append(ords, ord)
+		}
+	}
+	d.db.Orders = ords
+	d.Unlock()
+
+	return d.Flush()
+}
+
+// GetOrders returns copies of all orders in the db.
+func (d *DB) GetOrders() ([]*types.Order, error) {
+	ords := []*types.Order{}
+
+	d.RLock()
+	for _, ord := range d.db.Orders {
+		ords = append(ords, ord.Clone())
+	}
+	d.RUnlock()
+
+	return ords, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// SetKillSwitch replaces the state of the kill switch.
+func (d *DB) SetKillSwitch(k types.KillSwitch) error {
+	d.Lock()
+	d.db.KillSwitch = k
+	d.Unlock()
+
+	return d.Flush()
+}
+
+// GetKillSwitch returns the state of the kill switch.
+func (d *DB) GetKillSwitch() (types.KillSwitch, error) {
+	d.RLock()
+	defer d.RUnlock()
+	return d.db.KillSwitch, nil
+}
+
+// KillSwitchEngaged returns true while the kill switch stored in the db file
+// `dbPath` is engaged, or if the file can not be read.  The file is read on
+// every call, so that a switch engaged by another process is seen.
+func KillSwitchEngaged(dbPath string) bool {
+	bs, err := ioutil.ReadFile(dbPath)
+	if os.IsNotExist(err) {
+		return false
+	} else if err != nil {
+		return true
+	}
+
+	var d db
+	if err := json.Unmarshal(bs, &d); err != nil {
+		return true
+	}
+	return d.KillSwitch.Engaged
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,149 @@
+package db
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sabhiram/trade-bot/types"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// tempPath returns the path to `name` in a new temporary directory, and a
+// function that removes the directory.
+func tempPath(t *testing.T, name string) (string, func()) {
+	dir, err := ioutil.TempDir("", "db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, name), func() { os.RemoveAll(dir) }
+}
+
+func dec(s string) decimal.Decimal {
+	d, err := decimal.NewFromString(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func TestNew(t *testing.T) {
+	path, cleanup := tempPath(t, "db.json")
+	defer cleanup()
+	if _, err := New(path); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	// New files are created at the current version.
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("expected the db to be created: %s", err.Error())
+	}
+	stored := db{}
+	if err := json.Unmarshal(bs, &stored); err != nil || stored.Version != version {
+		t.Fatalf("expected version %d, got %d (%v)", version, stored.Version, err)
+	}
+}
+
+func TestMigrateFloatBalances(t *testing.T) {
+	path, cleanup := tempPath(t, "db.json")
+	defer cleanup()
+	old := `{
+  "Balances": [
+    {"Currency": "BTC", "Available": 0.30000000000000004, "Total": 1.2345678949999999},
+    {"Currency": "PIVX", "Available": 100, "Total": 150.5}
+  ],
+  "Sessions": [],
+  "Orders": []
+}`
+	if err := ioutil.WriteFile(path, []byte(old), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := New(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	want := map[string][2]string{
+		"BTC":  {"0.3", "1.23456789"},
+		"PIVX": {"100", "150.5"},
+	}
+	check := func(bs []*types.Balance) {
+		t.Helper()
+		if len(bs) != len(want) {
+			t.Fatalf("expected %d balances, got %d", len(want), len(bs))
+		}
+		for _, b := range bs {
+			w := want[b.Currency]
+			if !b.Available.Equal(dec(w[0])) || !b.Total.Equal(dec(w[1])) {
+				t.Fatalf("%s: expected %s of %s, got %s of %s", b.Currency, w[0], w[1], b.Available, b.Total)
+			}
+		}
+	}
+	bs, _ := d.GetBalances()
+	check(bs)
+
+	// The file is rewritten at the current version with decimal strings, and
+	// loads again without a further migration.
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := struct {
+		Version  int
+		Balances []map[string]interface{}
+	}{}
+	if err := json.Unmarshal(raw, &stored); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if stored.Version != version {
+		t.Fatalf("expected version %d, got %d", version, stored.Version)
+	}
+	for _, b := range stored.Balances {
+		if _, ok := b["Total"].(string); !ok {
+			t.Fatalf("%s: expected a decimal string, got %#v", b["Currency"], b["Total"])
+		}
+	}
+
+	d, err = New(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	bs, _ = d.GetBalances()
+	check(bs)
+}
+
+func TestDeleteOrders(t *testing.T) {
+	path, cleanup := tempPath(t, "db.json")
+	defer cleanup()
+	d, err := New(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	for _, uuid := range []string{"A", "B", "C"} {
+		if err := d.UpdateOrder(&types.Order{UUID: uuid}); err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+	}
+	if err := d.DeleteOrders([]string{"A", "C", "MISSING"}); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	// The deletion is flushed.
+	d, _ = New(path)
+	kept, _ := d.GetOrders()
+	if len(kept) != 1 || kept[0].UUID != "B" {
+		t.Fatalf("expected only B to remain, got %d orders", len(kept))
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,204 @@
+package app
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/sabhiram/trade-bot/exchange"
+	"github.com/sabhiram/trade-bot/hub"
+	"github.com/sabhiram/trade-bot/types"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+var (
+	ErrHalted = errors.New("trading is halted, re-arm the kill switch first")
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Halt is the outcome of engaging the kill switch.
+type Halt struct {
+	KillSwitch types.KillSwitch
+	Paused     []types.UUID // sessions which were being monitored
+	Cancelled  []string     // open orders cancelled
+	Exits      []string     // orders placed to exit positions to BTC
+	Errors     []string     // orders which could not be cancelled or placed
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Halt engages the kill switch: no further orders are placed, every session
+// monitor is stopped and the open orders placed by the bot are cancelled.  If
+// `exit` is set, every balance with a BTC market is then sold at the bid.  The
+// switch stays engaged (across restarts) until Rearm is called.
+func (a *App) Halt(exit bool) (*Halt, error) {
+	k, err := a.db.GetKillSwitch()
+	if err != nil {
+		return nil, err
+	}
+	if !k.Engaged {
+		k = types.KillSwitch{Engaged: true, EngagedAt: time.Now(), RearmedAt: k.RearmedAt}
+		if err := a.db.SetKillSwitch(k); err != nil {
+			return nil, err
+		}
+	}
+	log.Printf("Kill switch :: engaged (exit %t)\n", exit)
+	a.broadcastKillSwitch(k)
+
+	h := &Halt{
+		KillSwitch: k,
+		Paused:     []types.UUID{},
+		Cancelled:  []string{},
+		Exits:      []string{},
+		Errors:     []string{},
+	}
+
+	a.Lock()
+	for id := range a.monitors {
+		h.Paused = append(h.Paused, id)
+	}
+	a.Unlock()
+	a.stopSessions()
+	for _, id := range h.Paused {
+		log.Printf("Kill switch :: paused session %s\n", id)
+	}
+
+	if err := a.cancelOwnedOrders(h); err != nil {
+		return nil, err
+	}
+	if exit {
+		if err := a.exitPositions(h); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := a.UpdateBalances(true); err != nil {
+		log.Printf("Kill switch :: unable to update balances :: %s\n", err.Error())
+	}
+	return h, nil
+}
+
+// Rearm disengages the kill switch and resumes monitoring active sessions.
+func (a *App) Rearm() (*types.KillSwitch, error) {
+	k, err := a.db.GetKillSwitch()
+	if err != nil {
+		return nil, err
+	}
+	if !k.Engaged {
+		return &k, nil
+	}
+
+	k.Engaged = false
+	k.RearmedAt = time.Now()
+	if err := a.db.SetKillSwitch(k); err != nil {
+		return nil, err
+	}
+	log.Printf("Kill switch :: re-armed\n")
+	a.broadcastKillSwitch(k)
+
+	return &k, a.resumeSessions()
+}
+
+// GetKillSwitch returns the state of the kill switch.
+func (a *App) GetKillSwitch() (*types.KillSwitch, error) {
+	k, err := a.db.GetKillSwitch()
+	if err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+// halted returns true while the kill switch is engaged.
+func (a *App) halted() bool {
+	k, err := a.db.GetKillSwitch()
+	return err != nil || k.Engaged
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// cancelOwnedOrders cancels the open orders on the exchange which were placed
+// by sessions or are tracked by the bot, leaving any other orders alone.
+func (a *App) cancelOwnedOrders(h *Halt) error {
+	ss, err := a.db.GetSessions()
+	if err != nil {
+		return err
+	}
+	owner := map[string]types.UUID{}
+	for _, s := range ss {
+		for _, oid := range s.OrderIDs {
+			owner[oid] = s.ID
+		}
+	}
+	for _, o := range a.orders.List("") {
+		owner[o.UUID] = o.Session
+	}
+
+	open, err := a.exchange.GetOpenOrders(exchange.AllMarkets)
+	if err != nil {
+		return err
+	}
+	for _, o := range open {
+		id, ok := owner[o.UUID]
+		if !ok {
+			continue
+		}
+
+		log.Printf("Kill switch :: cancelling order %s on %s\n", o.UUID, o.Market)
+		if err := a.exchange.CancelOrder(o.UUID); err != nil {
+			h.Errors = append(h.Errors, fmt.Sprintf("cancel %s: %s", o.UUID, err.Error()))
+			continue
+		}
+		h.Cancelled = append(h.Cancelled, o.UUID)
+		if _, err := a.orders.Refresh(id, o.UUID); err != nil {
+			log.Printf("Kill switch :: unable to get order %s :: %s\n", o.UUID, err.Error())
+		}
+	}
+	return nil
+}
+
+// exitPositions sells the available balance of every currency with a BTC
+// market at its bid.  The orders bypass the kill switch and risk checks, and
+// are tracked without a session.
+func (a *App) exitPositions(h *Halt) error {
+	bs, err := FetchBalances(a.exchange)
+	if err != nil {
+		return err
+	}
+
+	ex := a.orders.Exchange(a.streamed(), "")
+	for _, b := range bs {
+		if b.Currency == "BTC" || b.Available.Sign() <= 0 {
+			continue
+		}
+
+		m := "BTC-" + b.Currency
+		t, err := ex.GetTicker(m)
+		if err != nil || t.Bid.Sign() <= 0 {
+			h.Errors = append(h.Errors, fmt.Sprintf("exit %s: no bid on %s", b.Currency, m))
+			continue
+		}
+
+		log.Printf("Kill switch :: selling %s %s @ %s\n", b.Available, b.Currency, t.Bid.StringFixed(8))
+		uuid, err := ex.SellLimit(m, b.Available, t.Bid)
+		if err != nil {
+			h.Errors = append(h.Errors, fmt.Sprintf("exit %s: %s", b.Currency, err.Error()))
+			continue
+		}
+		h.Exits = append(h.Exits, uuid)
+	}
+	return nil
+}
+
+// broadcastKillSwitch pushes the state of the kill switch to clients.
+func (a *App) broadcastKillSwitch(k types.KillSwitch) {
+	if err := a.broadcast(hub.TopicKillSwitch, "KillSwitch", &k); err != nil {
+		log.Printf("Kill switch :: unable to broadcast :: %s\n", err.Error())
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
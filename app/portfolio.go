@@ -0,0 +1,128 @@
+package app
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sabhiram/trade-bot/exchange"
+	"github.com/sabhiram/trade-bot/history"
+	"github.com/sabhiram/trade-bot/hub"
+	"github.com/sabhiram/trade-bot/types"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// valueBalances estimates the BTC and USDT value of each balance in `bs` from
+// the last price of its BTC market (or its USDT market if there is no BTC
+// one) and of USDT-BTC.  Balances which can not be priced are left at zero.
+func valueBalances(md exchange.MarketData, bs []*types.Balance) {
+	last := func(market string) decimal.Decimal {
+		t, err := md.GetTicker(market)
+		if err != nil {
+			return decimal.Zero
+		}
+		return t.Last
+	}
+
+	usdt := last("USDT-BTC")
+	for _, b := range bs {
+		var price decimal.Decimal // in BTC
+		switch b.Currency {
+		case "BTC":
+			price = decimal.New(1, 0)
+		case "USDT":
+			if usdt.Sign() > 0 {
+				price = decimal.New(1, 0).Div(usdt)
+			}
+		default:
+			price = last("BTC-" + b.Currency)
+			if p := last("USDT-" + b.Currency); price.Sign() == 0 && p.Sign() > 0 && usdt.Sign() > 0 {
+				price = p.Div(usdt)
+			}
+		}
+
+		b.BTCValue = b.Total.Mul(price).Round(8)
+		b.USDTValue = b.BTCValue.Mul(usdt).Round(8)
+		if b.Currency == "USDT" {
+			b.USDTValue = b.Total
+		}
+	}
+}
+
+// newPortfolio returns the portfolio of the valued balances `bs`.
+func newPortfolio(bs []*types.Balance) *types.Portfolio {
+	p := &types.Portfolio{Balances: bs}
+	for _, b := range bs {
+		p.BTCValue = p.BTCValue.Add(b.BTCValue)
+		p.USDTValue = p.USDTValue.Add(b.USDTValue)
+	}
+	return p
+}
+
+// GetPortfolio returns the last known balances along with their total value.
+func (a *App) GetPortfolio() (*types.Portfolio, error) {
+	bs, err := a.db.GetBalances()
+	if err != nil {
+		return nil, err
+	}
+	return newPortfolio(bs), nil
+}
+
+// BroadcastPortfolio pushes the latest portfolio to the clients subscribed to
+// portfolio updates.
+func (a *App) BroadcastPortfolio() error {
+	p, err := a.GetPortfolio()
+	if err != nil {
+		return err
+	}
+	return a.broadcast(hub.TopicPortfolio, "Portfolio", p)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// SnapshotPortfolio values the balances held on the exchange at current prices
+// and appends them to the snapshot series.  The snapshot is pushed to the
+// clients subscribed to portfolio updates.
+func (a *App) SnapshotPortfolio() error {
+	bs, err := FetchBalances(a.exchange)
+	if err != nil {
+		return err
+	}
+
+	snap := history.NewSnapshot(time.Now(), newPortfolio(bs))
+	if err := a.snapshots.Add(snap); err != nil {
+		return err
+	}
+	return a.broadcast(hub.TopicPortfolio, "PortfolioSnapshot", snap)
+}
+
+// GetPortfolioHistory returns the portfolio snapshots taken from `from` to `to`
+// (a zero time leaves that end open).
+func (a *App) GetPortfolioHistory(from, to time.Time) ([]history.Snapshot, error) {
+	return a.snapshots.Range(from, to), nil
+}
+
+// GetPortfolioPnL returns the daily or weekly (see `period`) change in value
+// of the portfolio, along with each currency's contribution, from `from` to
+// `to`.
+func (a *App) GetPortfolioPnL(period string, from, to time.Time) ([]history.Period, error) {
+	if err := history.ValidatePeriod(period); err != nil {
+		return nil, &ValidationError{err}
+	}
+
+	// Periods are measured from the last snapshot of the previous period, so
+	// the series is split from its start and trimmed to `from` afterwards.
+	ps, err := history.PnL(a.snapshots.Range(time.Time{}, to), period)
+	if err != nil {
+		return nil, err
+	}
+	for len(ps) > 0 && !ps[0].To.After(from) {
+		ps = ps[1:]
+	}
+	return ps, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
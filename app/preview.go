@@ -0,0 +1,119 @@
+package app
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"strings"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sabhiram/trade-bot/exchange"
+	"github.com/sabhiram/trade-bot/trade"
+	"github.com/sabhiram/trade-bot/types"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// OrderPreview is an order which a trade would place, with its estimated fee.
+type OrderPreview struct {
+	Market   string
+	Side     string // "BUY" or "SELL"
+	Quantity decimal.Decimal
+	Rate     decimal.Decimal
+	Notional decimal.Decimal // quantity x rate, in the base currency
+	Fee      decimal.Decimal // estimated commission, in the base currency
+}
+
+// NewOrderPreviews returns the previews of the orders `placed` with fees
+// estimated at the rate `fee`.
+func NewOrderPreviews(placed []exchange.Order, fee decimal.Decimal) []*OrderPreview {
+	ret := []*OrderPreview{}
+	for _, o := range placed {
+		side := "SELL"
+		if o.Type == exchange.OrderTypeLimitBuy {
+			side = "BUY"
+		}
+		notional := o.Quantity.Mul(o.Limit).Round(8)
+		ret = append(ret, &OrderPreview{
+			Market:   o.Market,
+			Side:     side,
+			Quantity: o.Quantity,
+			Rate:     o.Limit,
+			Notional: notional,
+			Fee:      notional.Mul(fee).Round(8),
+		})
+	}
+	return ret
+}
+
+// SessionPreview is what a session would do if it were created, shown to the
+// user to confirm before the session is armed.
+type SessionPreview struct {
+	Strategy  string
+	Currency  string
+	Market    string
+	Params    map[string]string // inputs with defaults filled in
+	Condition string            // condition which triggers the orders
+	DryRun    bool              // orders are only logged, not placed
+	Orders    []*OrderPreview   // orders placed if triggered at the current market
+	Fees      decimal.Decimal   // estimated fees of all orders
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// PreviewSession validates the `params` for the trade `strategy` on `currency`
+// and returns the orders it would place if its condition were met now, without
+// creating a session or placing any order.
+func (a *App) PreviewSession(strategy, currency string, params map[string]string) (*SessionPreview, error) {
+	s, t, err := a.resolveSession(strategy, currency, params)
+	if err != nil {
+		return nil, err
+	}
+
+	placed, err := t.Preview(sessionArgs(s))
+	if err != nil {
+		return nil, &ValidationError{err}
+	}
+
+	p := &SessionPreview{
+		Strategy:  s.Strategy,
+		Currency:  s.Currency,
+		Market:    s.Market,
+		Params:    s.Params,
+		Condition: t.Condition(),
+		DryRun:    a.config.DryRun,
+		Orders:    NewOrderPreviews(placed, a.risk.Limits().Fee),
+	}
+	for _, o := range p.Orders {
+		p.Fees = p.Fees.Add(o.Fee)
+	}
+	return p, nil
+}
+
+// resolveSession returns a new (unsaved) session for the trade `strategy` on
+// `currency` with its `params` validated, and the trade bound to it.
+func (a *App) resolveSession(strategy, currency string, params map[string]string) (*types.Session, *trade.Trade, error) {
+	currency = strings.ToUpper(currency)
+	s := types.NewSession(trade.MarketFor(currency), currency, strategy, nil)
+
+	t, err := a.newTrade(s)
+	if err != nil {
+		return nil, nil, &ValidationError{err}
+	}
+
+	// Only the trade's inputs are taken from the user, any other argument is
+	// set by the trade itself (ex: the market data and its resting orders).
+	args := map[string]interface{}{}
+	for _, inp := range t.Inputs {
+		if v, ok := params[inp.Key]; ok {
+			args[inp.Key] = v
+		}
+	}
+	s.Params, err = t.Resolve(args)
+	if err != nil {
+		return nil, nil, &ValidationError{err}
+	}
+	return s, t, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,285 @@
+package app
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/sabhiram/trade-bot/exchange"
+	"github.com/sabhiram/trade-bot/hub"
+	"github.com/sabhiram/trade-bot/types"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Kinds of orphaned orders found by a reconciliation.
+const (
+	OrphanUnknown    = "UNKNOWN"    // open on the exchange, not placed by a session
+	OrphanUnrecorded = "UNRECORDED" // closed in an active session's market since it started, not recorded by it
+	OrphanMissing    = "MISSING"    // recorded by an active session, not found on the exchange
+)
+
+// Actions which resolve an orphaned order.
+const (
+	ActionAdopt   = "adopt"   // add the order to a session
+	ActionCancel  = "cancel"  // cancel the order on the exchange
+	ActionDismiss = "dismiss" // track the order without a session
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Orphan is an order which the exchange and the sessions disagree about.
+type Orphan struct {
+	Kind    string
+	Order   exchange.Order
+	Session types.UUID // session which recorded the order, or likely placed it
+	Actions []string   // actions which can resolve the orphan
+}
+
+// Reconciliation is the outcome of matching the exchange's orders against
+// the orders recorded by sessions.
+type Reconciliation struct {
+	At      time.Time
+	Open    int // open orders on the exchange
+	Closed  int // orders in the exchange's order history
+	Matched int // exchange orders recorded by a session
+	Orphans []*Orphan
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Reconcile matches the open orders and order history on the exchange against
+// the orders recorded by sessions (by UUID) and replaces the last report.
+// Matched orders which are not yet tracked are tracked on behalf of their
+// session.
+func (a *App) Reconcile() (*Reconciliation, error) {
+	open, err := a.exchange.GetOpenOrders(exchange.AllMarkets)
+	if err != nil {
+		return nil, err
+	}
+	hist, err := a.exchange.GetOrderHistory(exchange.AllMarkets)
+	if err != nil {
+		return nil, err
+	}
+	ss, err := a.db.GetSessions()
+	if err != nil {
+		return nil, err
+	}
+
+	owner := map[string]types.UUID{}
+	for _, s := range ss {
+		for _, oid := range s.OrderIDs {
+			owner[oid] = s.ID
+		}
+	}
+	for _, o := range a.orders.List("") {
+		if _, ok := owner[o.UUID]; !ok {
+			owner[o.UUID] = o.Session
+		}
+	}
+
+	r := &Reconciliation{
+		At:      time.Now(),
+		Open:    len(open),
+		Closed:  len(hist),
+		Orphans: []*Orphan{},
+	}
+	seen := map[string]struct{}{}
+	for _, o := range append(open, hist...) {
+		seen[o.UUID] = struct{}{}
+		if id, ok := owner[o.UUID]; ok {
+			r.Matched++
+			a.orders.Adopt(id, o)
+			continue
+		}
+
+		s := likelySession(ss, o)
+		switch {
+		case o.IsOpen:
+			r.Orphans = append(r.Orphans, &Orphan{
+				Kind:    OrphanUnknown,
+				Order:   o,
+				Session: s,
+				Actions: []string{ActionAdopt, ActionCancel},
+			})
+		case len(s) > 0:
+			r.Orphans = append(r.Orphans, &Orphan{
+				Kind:    OrphanUnrecorded,
+				Order:   o,
+				Session: s,
+				Actions: []string{ActionAdopt, ActionDismiss},
+			})
+		}
+	}
+
+	// The history may not go back far enough, so orders of active sessions
+	// which were not listed are looked up before being flagged.  Dry-run
+	// orders never reach the exchange.
+	for _, s := range ss {
+		if !s.IsActive() || s.DryRun {
+			continue
+		}
+		for _, oid := range s.OrderIDs {
+			if _, ok := seen[oid]; ok {
+				continue
+			}
+			if _, err := a.orders.Refresh(s.ID, oid); err == nil {
+				continue
+			}
+
+			o := exchange.Order{UUID: oid, Market: s.Market}
+			if rec, err := a.orders.Get(oid); err == nil {
+				o.Type, o.Quantity, o.Limit, o.Opened = rec.Type, rec.Quantity, rec.Limit, rec.PlacedAt
+			}
+			r.Orphans = append(r.Orphans, &Orphan{
+				Kind:    OrphanMissing,
+				Order:   o,
+				Session: s.ID,
+				Actions: []string{},
+			})
+		}
+	}
+
+	for _, o := range r.Orphans {
+		log.Printf("Reconcile :: %s order %s on %s (session %q)\n", o.Kind, o.Order.UUID, o.Order.Market, o.Session)
+	}
+	log.Printf("Reconcile :: matched %d orders, %d orphaned\n", r.Matched, len(r.Orphans))
+
+	a.setReconciliation(r)
+	return r, nil
+}
+
+// GetReconciliation returns the report of the last reconciliation.
+func (a *App) GetReconciliation() (*Reconciliation, error) {
+	a.Lock()
+	defer a.Unlock()
+	return a.recon, nil
+}
+
+// ResolveOrphan resolves the orphaned order `uuid` of the last reconciliation
+// with `action`.  Adopted orders are added to the session `id`, which defaults
+// to the orphan's likely session.  Dismissed orders are tracked without a
+// session, so that later reconciliations match them.
+func (a *App) ResolveOrphan(uuid, action string, id types.UUID) (*Reconciliation, error) {
+	a.Lock()
+	var orphan *Orphan
+	if a.recon != nil {
+		for _, o := range a.recon.Orphans {
+			if o.Order.UUID == uuid {
+				orphan = o
+			}
+		}
+	}
+	a.Unlock()
+
+	if orphan == nil {
+		return nil, &ValidationError{fmt.Errorf("order %s is not orphaned", uuid)}
+	}
+	action = strings.ToLower(action)
+	allowed := false
+	for _, act := range orphan.Actions {
+		allowed = allowed || act == action
+	}
+	if !allowed {
+		return nil, &ValidationError{fmt.Errorf("can not %s %s order %s", action, strings.ToLower(orphan.Kind), uuid)}
+	}
+
+	switch action {
+	case ActionAdopt:
+		if len(id) == 0 {
+			id = orphan.Session
+		}
+		if err := a.adoptOrder(id, orphan.Order); err != nil {
+			return nil, err
+		}
+	case ActionCancel:
+		log.Printf("Reconcile :: cancelling order %s\n", uuid)
+		if err := a.exchange.CancelOrder(uuid); err != nil {
+			return nil, err
+		}
+	case ActionDismiss:
+		log.Printf("Reconcile :: dismissing order %s\n", uuid)
+		a.orders.Adopt("", orphan.Order)
+	}
+
+	a.Lock()
+	r := *a.recon
+	r.Orphans = []*Orphan{}
+	for _, o := range a.recon.Orphans {
+		if o != orphan {
+			r.Orphans = append(r.Orphans, o)
+		}
+	}
+	a.Unlock()
+
+	a.setReconciliation(&r)
+	return &r, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// adoptOrder adds the exchange order `o` to the session `id` and tracks it.
+// An active session is restarted so that its monitor picks up the order.
+func (a *App) adoptOrder(id types.UUID, o exchange.Order) error {
+	if len(id) == 0 {
+		return &ValidationError{fmt.Errorf("a session is required to adopt order %s", o.UUID)}
+	}
+	s, err := a.db.GetSession(id)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(s.Market, o.Market) {
+		return &ValidationError{fmt.Errorf("order %s is on %s, session %s trades %s", o.UUID, o.Market, id, s.Market)}
+	}
+
+	log.Printf("Reconcile :: adopting order %s into session %s\n", o.UUID, id)
+	a.stopSession(id)
+	if s, err = a.db.GetSession(id); err != nil {
+		return err
+	}
+
+	s.OrderIDs = append(s.OrderIDs, o.UUID)
+	if err := a.saveSession(s); err != nil {
+		return err
+	}
+	a.orders.Adopt(id, o)
+
+	if s.IsActive() {
+		a.startSession(s)
+	}
+	return nil
+}
+
+// setReconciliation replaces the last report and pushes it to clients.
+func (a *App) setReconciliation(r *Reconciliation) {
+	a.Lock()
+	a.recon = r
+	a.Unlock()
+
+	if err := a.broadcast(hub.TopicReconciliation, "Reconciliation", r); err != nil {
+		log.Printf("Reconcile :: unable to broadcast :: %s\n", err.Error())
+	}
+}
+
+// likelySession returns the most recent active session on the market of `o`
+// which was created before `o` was placed, if any.
+func likelySession(ss []*types.Session, o exchange.Order) types.UUID {
+	var ret *types.Session
+	for _, s := range ss {
+		if !s.IsActive() || !strings.EqualFold(s.Market, o.Market) || s.CreatedAt.After(o.Opened) {
+			continue
+		}
+		if ret == nil || s.CreatedAt.After(ret.CreatedAt) {
+			ret = s
+		}
+	}
+	if ret == nil {
+		return ""
+	}
+	return ret.ID
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,272 @@
+package app
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sabhiram/trade-bot/app/db"
+	"github.com/sabhiram/trade-bot/exchange"
+	"github.com/sabhiram/trade-bot/hub"
+	"github.com/sabhiram/trade-bot/types"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+func dec(s string) decimal.Decimal {
+	d, err := decimal.NewFromString(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// newTestPaper returns a paper exchange holding 1 BTC and 1000 PIVX, without
+// fees or slippage, with BTC-PIVX quoted at 0.000999 / 0.001001.
+func newTestPaper() *exchange.Paper {
+	cs := []exchange.Candle{{TimeStamp: time.Now().Add(-time.Minute), Close: dec("0.001")}}
+	feed := exchange.NewSteppedFeed(map[string][]exchange.Candle{"BTC-PIVX": cs}, time.Minute)
+	return exchange.NewPaper(feed, map[string]decimal.Decimal{"BTC": dec("1"), "PIVX": dec("1000")}, decimal.Zero, decimal.Zero)
+}
+
+// testApp is an app over a db in a temporary directory.
+type testApp struct {
+	dir string
+	ex  *exchange.Paper
+	h   *hub.Hub
+}
+
+// newTestApp returns a test app trading on `ex` with the `sessions` in its
+// db.  Trading is halted so that the sessions are not monitored.
+func newTestApp(t *testing.T, ex *exchange.Paper, sessions ...*types.Session) (*testApp, func()) {
+	dir, err := ioutil.TempDir("", "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := db.New(filepath.Join(dir, "db.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range sessions {
+		if err := d.AddSession(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.SetKillSwitch(types.KillSwitch{Engaged: true, EngagedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+
+	h, _ := hub.New()
+	go h.Run()
+	return &testApp{dir: dir, ex: ex, h: h}, func() { os.RemoveAll(dir) }
+}
+
+// start returns a new app over the test app's db, which reconciles the
+// exchange's orders as it starts.
+func (ta *testApp) start(t *testing.T) *App {
+	t.Helper()
+	a, err := New(&types.Config{
+		DbPath:       filepath.Join(ta.dir, "db.json"),
+		CandleDir:    filepath.Join(ta.dir, "candles"),
+		SnapshotPath: filepath.Join(ta.dir, "snapshots.json"),
+	}, ta.h, ta.ex)
+	if err != nil {
+		t.Fatalf("unable to start the app: %s", err.Error())
+	}
+	return a
+}
+
+// newTestSession returns an armed session on BTC-PIVX created an hour ago
+// which placed `orderIDs`.
+func newTestSession(orderIDs ...string) *types.Session {
+	s := types.NewSession("BTC-PIVX", "PIVX", "limit-sell", map[string]string{})
+	s.CreatedAt = s.CreatedAt.Add(-time.Hour)
+	s.OrderIDs = append(s.OrderIDs, orderIDs...)
+	return s
+}
+
+// place places a limit order of `quantity` @ `rate` on `ex`, which fills at
+// once if it crosses the quotes.
+func place(t *testing.T, ex *exchange.Paper, typ, quantity, rate string) string {
+	t.Helper()
+	limit := ex.SellLimit
+	if typ == exchange.OrderTypeLimitBuy {
+		limit = ex.BuyLimit
+	}
+	uuid, err := limit("BTC-PIVX", dec(quantity), dec(rate))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return uuid
+}
+
+// checkOrphans fails `t` unless the orphans of `r` are exactly `want`, which
+// maps order UUIDs to their kind.
+func checkOrphans(t *testing.T, r *Reconciliation, want map[string]string) {
+	t.Helper()
+	if len(r.Orphans) != len(want) {
+		t.Fatalf("expected %d orphans, got %d", len(want), len(r.Orphans))
+	}
+	for _, o := range r.Orphans {
+		if kind, ok := want[o.Order.UUID]; !ok || kind != o.Kind {
+			t.Fatalf("%s: expected %q, got %q", o.Order.UUID, kind, o.Kind)
+		}
+	}
+}
+
+// orphan returns the orphan of `r` for the order `uuid`.
+func orphan(t *testing.T, r *Reconciliation, uuid string) *Orphan {
+	t.Helper()
+	for _, o := range r.Orphans {
+		if o.Order.UUID == uuid {
+			return o
+		}
+	}
+	t.Fatalf("expected %s to be orphaned", uuid)
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func TestReconcile(t *testing.T) {
+	ex := newTestPaper()
+	recorded := place(t, ex, exchange.OrderTypeLimitSell, "10", "0.002")
+	unknown := place(t, ex, exchange.OrderTypeLimitBuy, "10", "0.0005")
+	unrecorded := place(t, ex, exchange.OrderTypeLimitSell, "10", "0.0009")
+
+	active := newTestSession(recorded, "LOST")
+	done := newTestSession()
+	done.Status = types.SessionFilled
+	ta, cleanup := newTestApp(t, ex, active, done)
+	defer cleanup()
+
+	r, err := ta.start(t).GetReconciliation()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if r.Open != 2 || r.Closed != 1 || r.Matched != 1 {
+		t.Fatalf("expected 1 of 2 open and 1 closed orders to match, got %d of %d and %d", r.Matched, r.Open, r.Closed)
+	}
+	checkOrphans(t, r, map[string]string{
+		unknown:    OrphanUnknown,
+		unrecorded: OrphanUnrecorded,
+		"LOST":     OrphanMissing,
+	})
+
+	// Orphans suggest the active session, and can only be resolved where
+	// the exchange has the order.
+	for uuid, actions := range map[string][]string{
+		unknown:    {ActionAdopt, ActionCancel},
+		unrecorded: {ActionAdopt, ActionDismiss},
+		"LOST":     {},
+	} {
+		o := orphan(t, r, uuid)
+		if o.Session != active.ID || len(o.Actions) != len(actions) {
+			t.Fatalf("%s: expected %v for session %s, got %v for %q", uuid, actions, active.ID, o.Actions, o.Session)
+		}
+		for i := range actions {
+			if o.Actions[i] != actions[i] {
+				t.Fatalf("%s: expected %v, got %v", uuid, actions, o.Actions)
+			}
+		}
+	}
+}
+
+func TestReconcileUnrecordedNeedsSession(t *testing.T) {
+	ex := newTestPaper()
+	place(t, ex, exchange.OrderTypeLimitSell, "10", "0.0009")
+
+	// Closed orders which no active session could have placed are ignored.
+	late := newTestSession()
+	late.CreatedAt = time.Now().Add(time.Hour)
+	ta, cleanup := newTestApp(t, ex, late)
+	defer cleanup()
+
+	r, _ := ta.start(t).GetReconciliation()
+	checkOrphans(t, r, map[string]string{})
+}
+
+func TestResolveOrphan(t *testing.T) {
+	ex := newTestPaper()
+	adopted := place(t, ex, exchange.OrderTypeLimitBuy, "10", "0.0005")
+	cancelled := place(t, ex, exchange.OrderTypeLimitBuy, "20", "0.0005")
+	dismissed := place(t, ex, exchange.OrderTypeLimitSell, "10", "0.0009")
+
+	active := newTestSession("LOST")
+	other := newTestSession()
+	other.Market, other.Currency = "BTC-LTC", "LTC"
+	ta, cleanup := newTestApp(t, ex, active, other)
+	defer cleanup()
+	a := ta.start(t)
+
+	for _, tc := range []struct {
+		uuid, action string
+		session      types.UUID
+	}{
+		{"NOPE", ActionAdopt, ""},
+		{"LOST", ActionAdopt, ""},
+		{adopted, "sell", ""},
+		{adopted, ActionDismiss, ""},
+		{dismissed, ActionCancel, ""},
+		{adopted, ActionAdopt, other.ID},
+	} {
+		_, err := a.ResolveOrphan(tc.uuid, tc.action, tc.session)
+		if _, ok := err.(*ValidationError); !ok {
+			t.Fatalf("%s %s: expected a validation error, got %v", tc.action, tc.uuid, err)
+		}
+	}
+
+	// Adopted orders default to the likely session.
+	r, err := a.ResolveOrphan(adopted, "ADOPT", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	s, _ := a.GetSession(active.ID)
+	if len(s.OrderIDs) != 2 || s.OrderIDs[1] != adopted {
+		t.Fatalf("expected %s to be added to the session, got %v", adopted, s.OrderIDs)
+	}
+	if o, err := a.orders.Get(adopted); err != nil || o.Session != active.ID {
+		t.Fatalf("expected %s to be tracked for the session", adopted)
+	}
+
+	if r, err = a.ResolveOrphan(cancelled, ActionCancel, ""); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if o, _ := ex.GetOrder(cancelled); o.IsOpen {
+		t.Fatalf("expected %s to be cancelled", cancelled)
+	}
+
+	// Dismissed orders are tracked without joining a session.
+	if r, err = a.ResolveOrphan(dismissed, ActionDismiss, ""); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if o, err := a.orders.Get(dismissed); err != nil || len(o.Session) != 0 {
+		t.Fatalf("expected %s to be tracked without a session", dismissed)
+	}
+	if s, _ = a.GetSession(active.ID); len(s.OrderIDs) != 2 {
+		t.Fatalf("expected the session's orders to be unchanged, got %v", s.OrderIDs)
+	}
+	checkOrphans(t, r, map[string]string{"LOST": OrphanMissing})
+
+	// Only the missing order is flagged again, also after a restart.  The
+	// cancelled order is orphaned again as it was not resolved into a
+	// session.
+	want := map[string]string{"LOST": OrphanMissing, cancelled: OrphanUnrecorded}
+	if r, err = a.Reconcile(); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	checkOrphans(t, r, want)
+	r, _ = ta.start(t).GetReconciliation()
+	checkOrphans(t, r, want)
+	if r.Matched != 2 {
+		t.Fatalf("expected the adopted and dismissed orders to match, got %d", r.Matched)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,100 @@
+package app
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"log"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sabhiram/trade-bot/history"
+	"github.com/sabhiram/trade-bot/hub"
+	"github.com/sabhiram/trade-bot/risk"
+	"github.com/sabhiram/trade-bot/types"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+const (
+	maxRejections = 20 // rejected orders kept for clients
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// newRiskChecker returns the risk checker for the orders placed through the
+// app, which checks balances held on `a.exchange` and the loss of the day.
+func (a *App) newRiskChecker() (*risk.Checker, error) {
+	l, err := risk.NewLimits(a.config)
+	if err != nil {
+		return nil, err
+	}
+
+	c := risk.New(a.streamed(), l)
+	c.Halted = a.halted
+	c.Balances = func() ([]*types.Balance, error) {
+		return FetchBalances(a.exchange)
+	}
+	c.DailyLoss = a.dailyLoss
+	c.OnReject = a.onRiskReject
+	return c, nil
+}
+
+// dailyLoss returns the BTC value lost by the last known balances since the
+// opening snapshot of the (UTC) day.  Gains are returned as a zero loss.
+func (a *App) dailyLoss() (decimal.Decimal, error) {
+	open, ok := a.snapshots.Opening(history.PeriodDay, time.Now())
+	if !ok {
+		return decimal.Zero, nil
+	}
+	p, err := a.GetPortfolio()
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	loss := open.BTCValue.Sub(p.BTCValue)
+	if loss.Sign() < 0 {
+		return decimal.Zero, nil
+	}
+	return loss, nil
+}
+
+// onRiskReject keeps the rejection `r` and pushes it to clients.
+func (a *App) onRiskReject(r *risk.Rejection) {
+	a.Lock()
+	a.rejections = append(a.rejections, r)
+	if n := len(a.rejections); n > maxRejections {
+		a.rejections = a.rejections[n-maxRejections:]
+	}
+	a.Unlock()
+
+	if err := a.broadcast(hub.TopicRisk, "Rejection", r); err != nil {
+		log.Printf("Risk :: unable to broadcast :: %s\n", err.Error())
+	}
+}
+
+// Risk is the limits orders are checked against along with the most recent
+// rejections.
+type Risk struct {
+	Limits     *risk.Limits
+	Rejections []*risk.Rejection
+}
+
+// GetRisk returns the risk limits and the recent rejections.
+func (a *App) GetRisk() (*Risk, error) {
+	rs, err := a.GetRejections()
+	if err != nil {
+		return nil, err
+	}
+	return &Risk{Limits: a.risk.Limits(), Rejections: rs}, nil
+}
+
+// GetRejections returns the most recent orders rejected by the risk checks,
+// oldest first.
+func (a *App) GetRejections() ([]*risk.Rejection, error) {
+	a.Lock()
+	defer a.Unlock()
+	return append([]*risk.Rejection{}, a.rejections...), nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
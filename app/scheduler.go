@@ -0,0 +1,182 @@
+package app
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"context"
+	"log"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/sabhiram/trade-bot/exchange"
+	"github.com/sabhiram/trade-bot/hub"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// orderPruneInterval is how often closed orders past the order retention are
+// pruned.
+const orderPruneInterval = time.Hour
+
+// task is a refresh job run by the scheduler every `interval`.
+type task struct {
+	name     string
+	interval time.Duration
+	fn       func() error
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Run refreshes balances, tickers for watched markets and open orders, prunes
+// closed orders and snapshots the portfolio, on their configured intervals,
+// pushing any changes to subscribed clients.  Run blocks until `ctx` is cancelled, at which point it stops all refreshers,
+// session monitors and market data streams before returning.
+func (a *App) Run(ctx context.Context) {
+	prune := time.Duration(0)
+	if a.config.OrderRetention > 0 {
+		prune = orderPruneInterval
+		if err := a.pruneOrders(); err != nil {
+			log.Printf("Scheduler :: unable to prune orders :: %s\n", err.Error())
+		}
+	}
+
+	tasks := []task{
+		{"balances", a.config.BalanceInterval, a.refreshBalances},
+		{"tickers", a.config.TickerInterval, a.tickerRefresher()},
+		{"orders", a.config.OrderInterval, a.orderRefresher()},
+		{"tracked orders", a.config.OrderInterval, a.orders.Poll},
+		{"order pruning", prune, a.pruneOrders},
+		{"snapshots", a.config.SnapshotInterval, a.SnapshotPortfolio},
+	}
+
+	// Record the portfolio at startup rather than an interval later.
+	if a.config.SnapshotInterval > 0 {
+		if err := a.SnapshotPortfolio(); err != nil {
+			log.Printf("Scheduler :: unable to snapshot portfolio :: %s\n", err.Error())
+		}
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		a.orders.Run(ctx)
+	}()
+
+	for _, t := range tasks {
+		if t.interval <= 0 {
+			continue
+		}
+
+		wg.Add(1)
+		go func(t task) {
+			defer wg.Done()
+			runTask(ctx, t)
+		}(t)
+	}
+	wg.Wait()
+
+	a.stopSessions()
+	a.market.Close()
+}
+
+func runTask(ctx context.Context, t task) {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := t.fn(); err != nil {
+				log.Printf("Scheduler :: unable to refresh %s :: %s\n", t.name, err.Error())
+			}
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// refreshBalances fetches the balances from the exchange and only updates the
+// db and clients if they changed.
+func (a *App) refreshBalances() error {
+	bs, err := FetchBalances(a.exchange)
+	if err != nil {
+		return err
+	}
+
+	prev, err := a.db.GetBalances()
+	if err != nil {
+		return err
+	}
+	if reflect.DeepEqual(bs, prev) {
+		return nil
+	}
+
+	if err := a.db.UpdateBalances(bs); err != nil {
+		return err
+	}
+	return a.BroadcastBalances()
+}
+
+// tickerRefresher returns a task which pushes the ticker of each watched
+// market to its subscribers whenever it changes.
+func (a *App) tickerRefresher() func() error {
+	last := map[string]exchange.Ticker{}
+
+	return func() error {
+		for _, m := range a.WatchedMarkets() {
+			// Streamed markets are pushed as updates arrive.
+			if _, ok := a.market.Ticker(m); ok {
+				delete(last, m)
+				continue
+			}
+
+			t, err := a.exchange.GetTicker(m)
+			if err != nil {
+				log.Printf("Scheduler :: unable to get ticker for %s :: %s\n", m, err.Error())
+				continue
+			}
+
+			if p, ok := last[m]; ok && p.Equal(t) {
+				continue
+			}
+			last[m] = t
+
+			if err := a.broadcast(hub.TickerTopic(m), "Ticker", &TickerUpdate{Market: m, Ticker: t}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// orderRefresher returns a task which pushes the open orders to subscribers
+// whenever an order is placed, (partially) filled or closed.
+func (a *App) orderRefresher() func() error {
+	var last map[string]string
+
+	return func() error {
+		orders, err := a.exchange.GetOpenOrders(exchange.AllMarkets)
+		if err != nil {
+			return err
+		}
+
+		// Orders are considered unchanged if the same orders are open with
+		// the same quantity remaining.
+		cur := map[string]string{}
+		for _, o := range orders {
+			cur[o.UUID] = o.QuantityRemaining.String()
+		}
+		if last != nil && reflect.DeepEqual(cur, last) {
+			return nil
+		}
+		last = cur
+
+		return a.broadcast(hub.TopicOrders, "OpenOrders", orders)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
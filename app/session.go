@@ -0,0 +1,416 @@
+package app
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"context"
+	"errors"
+	"log"
+	"reflect"
+	"time"
+
+	"github.com/sabhiram/trade-bot/hub"
+	"github.com/sabhiram/trade-bot/trade"
+	"github.com/sabhiram/trade-bot/types"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Notification is a message from a session's trade pushed to clients.
+type Notification struct {
+	Session types.UUID
+	Message string
+}
+
+// monitor tracks the goroutine watching a single active session.
+type monitor struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// CreateSession validates the `params` for the trade `strategy`, persists a new
+// armed session for `currency` and starts monitoring it.
+func (a *App) CreateSession(strategy, currency string, params map[string]string) (*types.Session, error) {
+	if a.halted() {
+		return nil, &ValidationError{ErrHalted}
+	}
+	s, _, err := a.resolveSession(strategy, currency, params)
+	if err != nil {
+		return nil, err
+	}
+	s.DryRun = a.config.DryRun
+
+	if err := a.db.AddSession(s); err != nil {
+		return nil, err
+	}
+	a.broadcastSession(s)
+
+	a.startSession(s)
+	return s.Clone(), nil
+}
+
+// GetSessions returns all known sessions.
+func (a *App) GetSessions() ([]*types.Session, error) {
+	return a.db.GetSessions()
+}
+
+// GetSession returns the session with the given `id`.
+func (a *App) GetSession(id types.UUID) (*types.Session, error) {
+	return a.db.GetSession(id)
+}
+
+// CancelSession stops monitoring the session `id` and cancels any of its
+// orders that are still open on the exchange.
+func (a *App) CancelSession(id types.UUID) (*types.Session, error) {
+	a.stopSession(id)
+
+	s, err := a.db.GetSession(id)
+	if err != nil {
+		return nil, err
+	}
+	if !s.IsActive() {
+		return s, nil
+	}
+
+	for _, oid := range s.OrderIDs {
+		o, err := a.orders.Refresh(s.ID, oid)
+		if err != nil {
+			return nil, err
+		}
+		if o.IsOpen() {
+			if err := a.exchange.CancelOrder(oid); err != nil {
+				return nil, err
+			}
+			if _, err := a.orders.Refresh(s.ID, oid); err != nil {
+				log.Printf("Session %s :: unable to get order %s :: %s\n", s.ID, oid, err.Error())
+			}
+		}
+	}
+
+	s.Status = types.SessionCancelled
+	return s, a.saveSession(s)
+}
+
+// DeleteSession cancels the session `id` and removes it from the db.
+func (a *App) DeleteSession(id types.UUID) error {
+	if _, err := a.CancelSession(id); err != nil {
+		return err
+	}
+	if err := a.db.DeleteSession(id); err != nil {
+		return err
+	}
+
+	a.broadcastSessionMessage(id, "SessionDeleted", id)
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// resumeSessions restarts monitoring for every active session in the db,
+// unless trading is halted.  Sessions armed in dry-run mode are only resumed
+// in dry-run mode, and only while armed since dry-run orders are not kept
+// across restarts.  Live sessions are left paused in dry-run mode.
+func (a *App) resumeSessions() error {
+	if a.halted() {
+		log.Printf("Trading is halted, active sessions are paused until re-armed\n")
+		return nil
+	}
+
+	ss, err := a.db.GetSessions()
+	if err != nil {
+		return err
+	}
+
+	for _, s := range ss {
+		switch {
+		case !s.IsActive():
+			continue
+		case s.DryRun && !a.config.DryRun:
+			a.failSession(s, errors.New("armed in dry-run mode, not resumed with a live exchange"))
+			continue
+		case s.DryRun && s.Status == types.SessionTriggered && a.lostOrders(s):
+			a.failSession(s, errors.New("dry-run orders are not kept across restarts"))
+			continue
+		case !s.DryRun && a.config.DryRun:
+			log.Printf("Session %s :: live session paused in dry-run mode\n", s.ID)
+			continue
+		}
+
+		log.Printf("Resuming %s session %s on %s (%s)\n", s.Strategy, s.ID, s.Market, s.Status)
+		a.startSession(s)
+	}
+	return nil
+}
+
+// lostOrders returns true if any order of the session `s` is unknown to the
+// exchange.
+func (a *App) lostOrders(s *types.Session) bool {
+	for _, oid := range s.OrderIDs {
+		if _, err := a.exchange.GetOrder(oid); err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *App) startSession(s *types.Session) {
+	if a.halted() {
+		log.Printf("Session %s :: paused while trading is halted\n", s.ID)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &monitor{
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	a.Lock()
+	a.monitors[s.ID] = m
+	a.Unlock()
+
+	// Stream the session's market for as long as it is monitored.
+	a.market.Watch(s.Market)
+
+	go func() {
+		defer close(m.done)
+		defer a.market.Unwatch(s.Market)
+		defer func() {
+			a.Lock()
+			if a.monitors[s.ID] == m {
+				delete(a.monitors, s.ID)
+			}
+			a.Unlock()
+		}()
+
+		a.runSession(ctx, s.Clone())
+	}()
+}
+
+// stopSession stops the monitor for the session `id` (if any) and waits for
+// it to exit.
+func (a *App) stopSession(id types.UUID) {
+	a.Lock()
+	m, ok := a.monitors[id]
+	a.Unlock()
+
+	if ok {
+		m.cancel()
+		<-m.done
+	}
+}
+
+// stopSessions stops all session monitors, leaving the sessions in the db to
+// be resumed the next time the app starts.
+func (a *App) stopSessions() {
+	a.Lock()
+	ids := []types.UUID{}
+	for id := range a.monitors {
+		ids = append(ids, id)
+	}
+	a.Unlock()
+
+	for _, id := range ids {
+		a.stopSession(id)
+	}
+}
+
+// runSession drives the session `s` through its state machine until it
+// reaches a terminal state or `ctx` is cancelled.
+func (a *App) runSession(ctx context.Context, s *types.Session) {
+	if s.Status == types.SessionArmed {
+		t, err := a.newTrade(s)
+		if err != nil {
+			a.failSession(s, err)
+			return
+		}
+
+		// Persist the trade's state and any orders it placed whenever they
+		// change, so that resting orders are known even before triggering.
+		t.OnUpdate = func(t *trade.Trade, args map[string]interface{}) error {
+			if !updateSession(s, t, args) {
+				return nil
+			}
+			return a.saveSession(s)
+		}
+
+		// Push notifications from the trade to clients following the session.
+		t.OnNotify = func(t *trade.Trade, msg string) {
+			a.broadcastSessionMessage(s.ID, "Notification", &Notification{Session: s.ID, Message: msg})
+		}
+
+		// Re-evaluate as soon as new market data is streamed.
+		wake, release := a.market.Wake(s.Market)
+		defer release()
+		t.Wake = wake
+
+		args := sessionArgs(s)
+		err = t.Run(ctx, args, a.config.RefreshInterval)
+		updateSession(s, t, args)
+		if err == context.Canceled {
+			return
+		} else if err != nil {
+			a.failSession(s, err)
+			return
+		}
+
+		s.Status = types.SessionTriggered
+		s.TriggeredAt = time.Now()
+		if err := a.saveSession(s); err != nil {
+			log.Printf("Session %s :: unable to save :: %s\n", s.ID, err.Error())
+		}
+	}
+
+	a.awaitFills(ctx, s)
+}
+
+// awaitFills polls the session's orders until they are all closed, marking
+// the session filled if any of them (partially) filled, or cancelled if none
+// did.  Orders cancelled by the trade itself (ex: the other leg of an OCO) do
+// not cancel the session, and sessions which placed no orders (ex: notify
+// only strategies) are done once triggered.
+func (a *App) awaitFills(ctx context.Context, s *types.Session) {
+	for {
+		open, filled := false, false
+		for _, oid := range s.OrderIDs {
+			o, err := a.orders.Refresh(s.ID, oid)
+			if err != nil {
+				log.Printf("Session %s :: unable to get order %s :: %s\n", s.ID, oid, err.Error())
+				open = true
+				continue
+			}
+			if o.IsOpen() {
+				open = true
+			} else if o.QuantityFilled.Sign() > 0 {
+				filled = true
+			}
+		}
+
+		if !open {
+			if !filled && len(s.OrderIDs) > 0 {
+				s.Status = types.SessionCancelled
+			} else {
+				s.Status = types.SessionFilled
+				s.FilledAt = time.Now()
+			}
+			if err := a.saveSession(s); err != nil {
+				log.Printf("Session %s :: unable to save :: %s\n", s.ID, err.Error())
+			}
+			return
+		}
+
+		select {
+		case <-time.After(a.config.RefreshInterval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (a *App) failSession(s *types.Session, err error) {
+	log.Printf("Session %s :: failed :: %s\n", s.ID, err.Error())
+	s.Status = types.SessionFailed
+	s.Error = err.Error()
+	if err := a.saveSession(s); err != nil {
+		log.Printf("Session %s :: unable to save :: %s\n", s.ID, err.Error())
+	}
+}
+
+// saveSession persists `s` and pushes it to all connected clients.
+func (a *App) saveSession(s *types.Session) error {
+	if err := a.db.UpdateSession(s); err != nil {
+		return err
+	}
+	a.broadcastSession(s)
+	return nil
+}
+
+func (a *App) broadcastSession(s *types.Session) {
+	a.broadcastSessionMessage(s.ID, "Session", s)
+}
+
+// broadcastSessionMessage pushes a message about the session `id` to clients
+// following that session and to those following all sessions.
+func (a *App) broadcastSessionMessage(id types.UUID, t string, data interface{}) {
+	for _, topic := range []string{hub.SessionTopic(string(id)), hub.TopicSessions} {
+		if err := a.broadcast(topic, t, data); err != nil {
+			log.Printf("Session %s :: unable to broadcast :: %s\n", id, err.Error())
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// newTrade returns the trade for the session `s` bound to the app's exchange
+// and the last known balances.
+func (a *App) newTrade(s *types.Session) (*trade.Trade, error) {
+	t, err := trade.New(s.Strategy)
+	if err != nil {
+		return nil, err
+	}
+
+	bs, err := a.db.GetBalances()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		target = &types.Balance{Currency: s.Currency}
+		btc    = &types.Balance{Currency: "BTC"}
+		usdt   = &types.Balance{Currency: "USDT"}
+	)
+	for _, b := range bs {
+		switch b.Currency {
+		case s.Currency:
+			target = b
+		case "BTC":
+			btc = b
+		case "USDT":
+			usdt = b
+		}
+	}
+
+	if len(s.Currency) == 0 {
+		return nil, errors.New("session currency missing")
+	}
+	t.Indicators = a.indicators
+	return t, t.Setup(a.tradingExchange(s.ID), s.Currency, target, btc, usdt)
+}
+
+// updateSession copies the state of the trade `t` and the orders it placed
+// into `s`, returning true if anything changed.
+func updateSession(s *types.Session, t *trade.Trade, args map[string]interface{}) bool {
+	changed := false
+	if st := t.State(args); !reflect.DeepEqual(st, s.State) {
+		s.State = st
+		changed = true
+	}
+
+	known := map[string]struct{}{}
+	for _, oid := range s.OrderIDs {
+		known[oid] = struct{}{}
+	}
+	for _, oid := range t.Orders {
+		if _, ok := known[oid]; !ok {
+			s.OrderIDs = append(s.OrderIDs, oid)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// sessionArgs builds the trade arguments for `s` from its params and state.
+func sessionArgs(s *types.Session) map[string]interface{} {
+	args := map[string]interface{}{}
+	for k, v := range s.Params {
+		args[k] = v
+	}
+	for k, v := range s.State {
+		args[k] = v
+	}
+	return args
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,294 @@
+// Package backtest replays a trade against recorded candles on a paper
+// exchange and reports how it would have performed.
+package backtest
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sabhiram/trade-bot/exchange"
+	"github.com/sabhiram/trade-bot/indicator"
+	"github.com/sabhiram/trade-bot/trade"
+	"github.com/sabhiram/trade-bot/types"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+var (
+	hundred = decimal.New(100, 0)
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Options configures a backtest.
+type Options struct {
+	Trade    string                     // registered trade to run
+	Currency string                     // currency traded in its BTC market
+	Interval string                     // interval of the candles
+	Args     map[string]interface{}     // the trade's inputs
+	Balances map[string]decimal.Decimal // initial paper balances
+	Fee      decimal.Decimal            // commission as a fraction of each fill
+	Slippage decimal.Decimal            // slippage as a fraction of each fill
+}
+
+// Fill is an order filled during the backtest.  `PnL` is the profit of a sell
+// against the average cost of the currency held, the currency held at the
+// start of the backtest costs the first close.
+type Fill struct {
+	TimeStamp  time.Time
+	Type       string // exchange.OrderTypeLimitBuy or exchange.OrderTypeLimitSell
+	Quantity   decimal.Decimal
+	Rate       decimal.Decimal
+	Commission decimal.Decimal
+	PnL        decimal.Decimal
+}
+
+// Point is the value of the account at the close of a candle.
+type Point struct {
+	TimeStamp time.Time
+	Close     decimal.Decimal
+	Base      decimal.Decimal // BTC held
+	Currency  decimal.Decimal // currency held
+	Equity    decimal.Decimal // value in BTC
+}
+
+// Report is the outcome of a backtest.  Returns are in BTC, percentages are
+// relative to the starting equity.
+type Report struct {
+	Trade      string
+	Market     string
+	From, To   time.Time
+	Candles    int
+	Executed   bool      // the trade's condition was met
+	ExecutedAt time.Time // close of the candle the trade executed at
+	Fills      []Fill
+	Open       int // orders still open at the end of the backtest
+
+	StartEquity decimal.Decimal
+	EndEquity   decimal.Decimal
+	PnL         decimal.Decimal
+	PnLPercent  decimal.Decimal
+	MaxDrawdown decimal.Decimal // largest drop from a peak, in percent
+	Wins        int             // sells above the average cost
+	Losses      int             // sells at or below the average cost
+	WinRate     decimal.Decimal // percent of sells that were wins
+
+	Equity []Point
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Run runs the trade described by `o` over the candles `cs`, one candle at a
+// time.  The trade is evaluated at every close and orders are matched against
+// the close's bid and ask.  The backtest carries on to the last candle after
+// the trade executes so that its orders may fill.
+func Run(cs []exchange.Candle, o *Options) (*Report, error) {
+	if len(cs) == 0 {
+		return nil, errors.New("no candles to backtest")
+	}
+	step, ok := exchange.IntervalDuration(o.Interval)
+	if !ok {
+		return nil, exchange.ValidateInterval(o.Interval)
+	}
+
+	t, err := trade.New(o.Trade)
+	if err != nil {
+		return nil, err
+	}
+
+	currency := strings.ToUpper(o.Currency)
+	market := trade.MarketFor(currency)
+	feed := exchange.NewSteppedFeed(map[string][]exchange.Candle{market: cs}, step)
+	ex := exchange.NewPaper(feed, o.Balances, o.Fee, o.Slippage)
+
+	target, btc, usdt := balances(o.Balances, currency)
+	t.Indicators = indicator.NewSource(feed, 0)
+	if err := t.Setup(ex, currency, target, btc, usdt); err != nil {
+		return nil, err
+	}
+
+	args := map[string]interface{}{}
+	for k, v := range o.Args {
+		args[k] = v
+	}
+	if err := t.Start(args); err != nil {
+		return nil, err
+	}
+
+	r := &Report{
+		Trade:   t.Name,
+		Market:  market,
+		From:    cs[0].TimeStamp,
+		To:      cs[len(cs)-1].TimeStamp,
+		Candles: len(cs),
+		Fills:   []Fill{},
+		Equity:  []Point{},
+	}
+
+	pos := position{qty: o.Balances[currency], cost: o.Balances[currency].Mul(cs[0].Close)}
+	seen := map[string]bool{}
+	for i := 0; ; i++ {
+		c := cs[i]
+		if !r.Executed {
+			done, err := t.Step(args)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", c.TimeStamp.Format(time.RFC3339), err.Error())
+			}
+			if done {
+				r.Executed, r.ExecutedAt = true, c.TimeStamp
+			}
+		}
+
+		// Orders are matched when the history is queried.
+		hist, err := ex.GetOrderHistory(market)
+		if err != nil {
+			return nil, err
+		}
+		for _, ord := range hist {
+			if seen[ord.UUID] || ord.Quantity.Equal(ord.QuantityRemaining) {
+				continue
+			}
+			seen[ord.UUID] = true
+			r.Fills = append(r.Fills, pos.fill(c.TimeStamp, ord))
+		}
+
+		p, err := point(ex, market, currency, c)
+		if err != nil {
+			return nil, err
+		}
+		r.Equity = append(r.Equity, p)
+
+		if !feed.Step() {
+			break
+		}
+	}
+
+	open, err := ex.GetOpenOrders(market)
+	if err != nil {
+		return nil, err
+	}
+	r.Open = len(open)
+	r.summarize()
+	return r, nil
+}
+
+// WriteEquityCSV writes the equity curve as CSV with a header row.
+func (r *Report) WriteEquityCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"TimeStamp", "Close", "Base", "Currency", "Equity"})
+	for _, p := range r.Equity {
+		cw.Write([]string{
+			p.TimeStamp.Format(time.RFC3339),
+			p.Close.String(),
+			p.Base.String(),
+			p.Currency.String(),
+			p.Equity.String(),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// summarize computes the returns, drawdown and win rate.
+func (r *Report) summarize() {
+	r.StartEquity = r.Equity[0].Equity
+	r.EndEquity = r.Equity[len(r.Equity)-1].Equity
+	r.PnL = r.EndEquity.Sub(r.StartEquity)
+	if r.StartEquity.Sign() > 0 {
+		r.PnLPercent = r.PnL.Div(r.StartEquity).Mul(hundred).Round(2)
+	}
+
+	peak := decimal.Zero
+	for _, p := range r.Equity {
+		peak = decimal.Max(peak, p.Equity)
+		if peak.Sign() > 0 {
+			dd := peak.Sub(p.Equity).Div(peak).Mul(hundred).Round(2)
+			r.MaxDrawdown = decimal.Max(r.MaxDrawdown, dd)
+		}
+	}
+
+	for _, f := range r.Fills {
+		if f.Type != exchange.OrderTypeLimitSell {
+			continue
+		}
+		if f.PnL.Sign() > 0 {
+			r.Wins++
+		} else {
+			r.Losses++
+		}
+	}
+	if n := r.Wins + r.Losses; n > 0 {
+		r.WinRate = decimal.New(int64(r.Wins), 0).Div(decimal.New(int64(n), 0)).Mul(hundred).Round(2)
+	}
+}
+
+// position is the currency held and what it cost (in BTC, with fees).
+type position struct {
+	qty, cost decimal.Decimal
+}
+
+// fill applies the filled order `o` to the position.
+func (pos *position) fill(ts time.Time, o exchange.Order) Fill {
+	f := Fill{
+		TimeStamp:  ts,
+		Type:       o.Type,
+		Quantity:   o.Quantity.Sub(o.QuantityRemaining),
+		Rate:       o.PricePerUnit,
+		Commission: o.CommissionPaid,
+	}
+
+	switch o.Type {
+	case exchange.OrderTypeLimitBuy:
+		pos.qty = pos.qty.Add(f.Quantity)
+		pos.cost = pos.cost.Add(o.Price).Add(o.CommissionPaid)
+	case exchange.OrderTypeLimitSell:
+		cost := decimal.Zero
+		if pos.qty.Sign() > 0 {
+			cost = pos.cost.Mul(f.Quantity).Div(pos.qty).Round(8)
+		}
+		f.PnL = o.Price.Sub(o.CommissionPaid).Sub(cost)
+		pos.qty = pos.qty.Sub(f.Quantity)
+		pos.cost = pos.cost.Sub(cost)
+	}
+	return f
+}
+
+// point values the paper account at the close of `c`.
+func point(ex *exchange.Paper, market, currency string, c exchange.Candle) (Point, error) {
+	bs, err := ex.GetBalances()
+	if err != nil {
+		return Point{}, err
+	}
+
+	p := Point{TimeStamp: c.TimeStamp, Close: c.Close}
+	for _, b := range bs {
+		switch b.Currency {
+		case "BTC":
+			p.Base = b.Balance
+		case currency:
+			p.Currency = b.Balance
+		}
+	}
+	p.Equity = p.Base.Add(p.Currency.Mul(c.Close)).Round(8)
+	return p, nil
+}
+
+// balances returns the trade's balances for the initial paper balances `bs`.
+func balances(bs map[string]decimal.Decimal, currency string) (target, btc, usdt *types.Balance) {
+	get := func(c string) *types.Balance {
+		return &types.Balance{Currency: c, Available: bs[c], Total: bs[c]}
+	}
+	return get(currency), get("BTC"), get("USDT")
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,185 @@
+package backtest
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sabhiram/trade-bot/exchange"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+func dec(s string) decimal.Decimal {
+	d, err := decimal.NewFromString(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+var start = time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// candles returns five minute candles closing at `closes`.  The paper
+// exchange quotes a bid and an ask 0.1% either side of each close.
+func candles(closes ...string) []exchange.Candle {
+	cs := []exchange.Candle{}
+	for i, c := range closes {
+		cs = append(cs, exchange.Candle{TimeStamp: start.Add(time.Duration(i) * 5 * time.Minute), Close: dec(c)})
+	}
+	return cs
+}
+
+// options returns the options to run `trade` with `args` over 100 PIVX,
+// with a fee of 0.25% and slippage of 0.1%.
+func options(trade string, args map[string]interface{}) *Options {
+	return &Options{
+		Trade:    trade,
+		Currency: "PIVX",
+		Interval: exchange.IntervalFiveMin,
+		Args:     args,
+		Balances: map[string]decimal.Decimal{"PIVX": dec("100")},
+		Fee:      dec("0.0025"),
+		Slippage: dec("0.001"),
+	}
+}
+
+// checkDecimals fails `t` unless each of `got` equals the `want` with the
+// same name.
+func checkDecimals(t *testing.T, got map[string]decimal.Decimal, want map[string]string) {
+	t.Helper()
+	for k, v := range want {
+		if !got[k].Equal(dec(v)) {
+			t.Fatalf("%s: expected %s, got %s", k, v, got[k])
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func TestRunLimitSell(t *testing.T) {
+	cs := candles("1", "0.9", "1.1", "1.2", "1")
+	r, err := Run(cs, options("limit-sell", map[string]interface{}{"SellLimit": "1.1", "Quantity": "40"}))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	// The sell is placed at the close of 1.1 but rests above the bid of
+	// 1.0989, until it fills at the next bid of 1.1988 less 0.1%.
+	if !r.Executed || !r.ExecutedAt.Equal(cs[2].TimeStamp) || r.Open != 0 || len(r.Fills) != 1 {
+		t.Fatalf("expected one fill of an order placed at %s, got %d (%d open) placed at %s",
+			cs[2].TimeStamp, len(r.Fills), r.Open, r.ExecutedAt)
+	}
+	f := r.Fills[0]
+	if f.Type != exchange.OrderTypeLimitSell || !f.TimeStamp.Equal(cs[3].TimeStamp) {
+		t.Fatalf("expected a sell filled at %s, got a %s at %s", cs[3].TimeStamp, f.Type, f.TimeStamp)
+	}
+
+	// The 40 PIVX held at the first close cost 40 BTC, and sell for
+	// 47.904048 less a commission of 0.11976012.
+	checkDecimals(t, map[string]decimal.Decimal{
+		"Quantity":   f.Quantity,
+		"Rate":       f.Rate,
+		"Commission": f.Commission,
+		"PnL":        f.PnL,
+	}, map[string]string{
+		"Quantity":   "40",
+		"Rate":       "1.1976012",
+		"Commission": "0.11976012",
+		"PnL":        "7.78428788",
+	})
+
+	// The equity falls 10% to 90, and then 10.02% from its peak of
+	// 119.78428788 (60 PIVX at 1.2) to 107.78428788.
+	equity := []string{"100", "90", "110", "119.78428788", "107.78428788"}
+	if len(r.Equity) != len(equity) {
+		t.Fatalf("expected %d points, got %d", len(equity), len(r.Equity))
+	}
+	for i, p := range r.Equity {
+		if !p.Equity.Equal(dec(equity[i])) {
+			t.Fatalf("%s: expected an equity of %s, got %s", p.TimeStamp, equity[i], p.Equity)
+		}
+	}
+	if last := r.Equity[len(r.Equity)-1]; !last.Base.Equal(dec("47.78428788")) || !last.Currency.Equal(dec("60")) {
+		t.Fatalf("expected 47.78428788 BTC and 60 PIVX, got %s and %s", last.Base, last.Currency)
+	}
+
+	checkDecimals(t, map[string]decimal.Decimal{
+		"StartEquity": r.StartEquity,
+		"EndEquity":   r.EndEquity,
+		"PnL":         r.PnL,
+		"PnLPercent":  r.PnLPercent,
+		"MaxDrawdown": r.MaxDrawdown,
+		"WinRate":     r.WinRate,
+	}, map[string]string{
+		"StartEquity": "100",
+		"EndEquity":   "107.78428788",
+		"PnL":         "7.78428788",
+		"PnLPercent":  "7.78",
+		"MaxDrawdown": "10.02",
+		"WinRate":     "100",
+	})
+	if r.Wins != 1 || r.Losses != 0 {
+		t.Fatalf("expected 1 win, got %d wins and %d losses", r.Wins, r.Losses)
+	}
+}
+
+func TestRunStopLoss(t *testing.T) {
+	cs := candles("1", "0.95", "0.9", "0.915")
+	r, err := Run(cs, options("stop-loss", map[string]interface{}{"StopPrice": "0.92", "LimitOffset": "0.01"}))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	// The stop places a sell at 0.91, which fills at the next bid of
+	// 0.914085 less 0.1%, below the cost of the PIVX.
+	if len(r.Fills) != 1 || !r.Fills[0].Rate.Equal(dec("0.91317092")) {
+		t.Fatalf("expected one fill at 0.91317092, got %#v", r.Fills)
+	}
+	checkDecimals(t, map[string]decimal.Decimal{
+		"Fill PnL":    r.Fills[0].PnL,
+		"PnL":         r.PnL,
+		"PnLPercent":  r.PnLPercent,
+		"MaxDrawdown": r.MaxDrawdown,
+		"WinRate":     r.WinRate,
+	}, map[string]string{
+		"Fill PnL":    "-8.91120073",
+		"PnL":         "-8.91120073",
+		"PnLPercent":  "-8.91",
+		"MaxDrawdown": "10",
+		"WinRate":     "0",
+	})
+	if r.Wins != 0 || r.Losses != 1 {
+		t.Fatalf("expected 1 loss, got %d wins and %d losses", r.Wins, r.Losses)
+	}
+}
+
+func TestRunNotExecuted(t *testing.T) {
+	cs := candles("1", "1.05")
+	r, err := Run(cs, options("limit-sell", map[string]interface{}{"SellLimit": "1.1", "Quantity": "40"}))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if r.Executed || len(r.Fills) != 0 || !r.PnL.Equal(dec("5")) || r.WinRate.Sign() != 0 {
+		t.Fatalf("expected the PIVX held to gain 5 without executing, got %#v", r)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	if _, err := Run(nil, options("limit-sell", nil)); err == nil {
+		t.Fatalf("expected an error without candles")
+	}
+	o := options("limit-sell", nil)
+	o.Interval = "weekly"
+	if _, err := Run(candles("1"), o); err == nil {
+		t.Fatalf("expected an invalid interval")
+	}
+	if _, err := Run(candles("1"), options("nope", nil)); err == nil {
+		t.Fatalf("expected an unknown trade")
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
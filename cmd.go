@@ -2,295 +2,511 @@ package main
 
 import (
 	"bufio"
-	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"net/http"
 	"os"
+	"strings"
 	"sync"
-	"text/template"
 	"time"
 
-	bittrex "github.com/toorop/go-bittrex"
-
+	"github.com/shopspring/decimal"
+
+	"github.com/sabhiram/trade-bot/app"
+	"github.com/sabhiram/trade-bot/app/db"
+	"github.com/sabhiram/trade-bot/backtest"
+	"github.com/sabhiram/trade-bot/exchange"
+	"github.com/sabhiram/trade-bot/history"
+	"github.com/sabhiram/trade-bot/hub"
+	"github.com/sabhiram/trade-bot/risk"
+	"github.com/sabhiram/trade-bot/server"
+	"github.com/sabhiram/trade-bot/trade"
 	"github.com/sabhiram/trade-bot/types"
 )
 
 ////////////////////////////////////////////////////////////////////////////////
 
-type (
-	ExecFunc   func(t *Trade, args map[string]interface{}) error
-	UpdateFunc func(t *Trade, args map[string]interface{}) error
+var (
+	stdinOnce    sync.Once
+	stdinScanner *bufio.Scanner
 )
 
+func getUserInput(msg string) string {
+	stdinOnce.Do(func() {
+		stdinScanner = bufio.NewScanner(os.Stdin)
+	})
+
+	if stdinScanner != nil {
+		fmt.Print(msg)
+		stdinScanner.Scan()
+		return stdinScanner.Text()
+	}
+
+	return ""
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 
-type Input struct {
-	prompt string
-	key    string
+func printSummary(s *exchange.MarketSummary) {
+	fmt.Print(`
+Market Summary:
+===============
+High:       ` + s.High.String() + `
+Low:        ` + s.Low.String() + `
+Ask:        ` + s.Ask.String() + `
+Bid:        ` + s.Bid.String() + `
+Last:       ` + s.Last.String() + `
+Volume:     ` + s.Volume.String() + `
+`)
 }
 
 ////////////////////////////////////////////////////////////////////////////////
 
-// Trade represents the required data to represent the appropriate
-// trading condition.  It contains a list of variables to fetch from
-// the user which are stored in a map.  It also contains a template
-// expression which when evaluated against the map should resolve in
-// a truthy value.
-type Trade struct {
-	evaluate string
-	inputs   []*Input
-	execute  ExecFunc
-	update   UpdateFunc
-
-	Currency      string
-	TargetBalance *types.Balance
-	BTCBalance    *types.Balance
-	USDTBalance   *types.Balance
+func runCmd(ex exchange.Exchange, cmd, currency string, market *exchange.MarketSummary, target, btc, usdt *types.Balance) error {
+	fmt.Printf(`
+Available %s balance %s.
+Available USDT balance %s.
+Available BTC balance %s.
+`, currency, target.Available, usdt.Available, btc.Available)
+	printSummary(market)
+
+	t, err := trade.New(cmd)
+	if err != nil {
+		return err
+	}
+
+	// Orders placed from the command line are risk checked as they are for
+	// sessions, the loss of the day is only tracked by the server.
+	limits, err := risk.NewLimits(&config)
+	if err != nil {
+		return err
+	}
+	rc := risk.New(ex, limits)
+
+	// The kill switch is read before every order, so that a halt issued
+	// while the trade runs also stops it.
+	rc.Halted = func() bool {
+		return db.KillSwitchEngaged(config.DbPath)
+	}
+	rc.Balances = func() ([]*types.Balance, error) {
+		return app.FetchBalances(ex)
+	}
+
+	if err := t.Setup(rc.Exchange(ex, ""), currency, target, btc, usdt); err != nil {
+		return err
+	}
+
+	// Iterate through the inputs as specified by the trade.
+	// Build a map and pass it to the exec function.
+	m := map[string]interface{}{}
+	for _, inp := range t.Inputs {
+		m[inp.Key] = getUserInput(inp.Prompt)
+	}
+
+	// Show the orders the trade would place and confirm before deploying it.
+	placed, err := t.Preview(m)
+	if err != nil {
+		return err
+	}
+	printPreview(t.Condition(), app.NewOrderPreviews(placed, limits.Fee))
+	input := getUserInput("Deploy this trade? [y/N]: ")
+	if !strings.HasPrefix(strings.ToLower(strings.TrimSpace(input)), "y") {
+		fmt.Printf("Trade not deployed.\n")
+		return nil
+	}
+
+	return t.Run(context.Background(), m, config.RefreshInterval)
 }
 
-func (t *Trade) Setup(currency string, target, btc, usdt *types.Balance) error {
-	fmt.Printf("SETUP CALLED: %#v\n", currency)
-	t.Currency = currency
-	t.TargetBalance = target
-	t.BTCBalance = btc
-	t.USDTBalance = usdt
-	return nil
+func printPreview(condition string, ps []*app.OrderPreview) {
+	fmt.Printf("\nOnce %q is met (at current prices) the trade places:\n", condition)
+	fees := decimal.Zero
+	for _, p := range ps {
+		fmt.Printf("  %-4s  %s %s @ %s  (%s BTC, est. fee %s BTC)\n", p.Side, p.Quantity, p.Market,
+			p.Rate.StringFixed(8), p.Notional.StringFixed(8), p.Fee.StringFixed(8))
+		fees = fees.Add(p.Fee)
+	}
+	if len(ps) == 0 {
+		fmt.Printf("  no orders\n")
+	}
+	fmt.Printf("Estimated fees: %s BTC\n", fees.StringFixed(8))
+	if config.DryRun {
+		fmt.Printf("Dry run: orders are logged, not placed.\n")
+	}
+	fmt.Printf("\n")
 }
 
-func (t *Trade) Evaluate(args map[string]interface{}) (string, error) {
-	fmt.Printf("EVAL CALLED: %#v\n", args)
-	tpl, err := template.New("eval").Parse(t.evaluate)
+// runTradeCmd prompts the user for the currency to trade and runs the trade
+// `cmd` against it from the command line.
+func runTradeCmd(ex exchange.Exchange, cmd string) error {
+	if db.KillSwitchEngaged(config.DbPath) {
+		return fmt.Errorf("trading is halted by the kill switch in %s, re-arm it first", config.DbPath)
+	}
+
+	fmt.Printf("Fetching %s balances for account...\n", ex.Name())
+	bs, err := app.FetchBalances(ex)
 	if err != nil {
-		return "error", err
+		return err
+	}
+
+	fmt.Printf("Found the following balances:\n")
+	for i, bal := range bs {
+		fmt.Printf("% 3d. % 6s : %s available\n", i+1, bal.Currency, bal.Available)
+	}
+
+	input := getUserInput(`Which coin do you want to setup (ex: "PIVX"): `)
+	input = strings.ToUpper(strings.TrimSpace(input))
+
+	var (
+		target *types.Balance                     // chosen currency balance
+		btc    = &types.Balance{Currency: "BTC"}  // BTC balance
+		usdt   = &types.Balance{Currency: "USDT"} // USDT balance
+	)
+	for _, bal := range bs {
+		switch bal.Currency {
+		case input:
+			target = bal
+		case "BTC":
+			btc = bal
+		case "USDT":
+			usdt = bal
+		}
 	}
 
-	var buf bytes.Buffer
-	if err := tpl.Execute(&buf, args); err != nil {
-		return "error", err
+	if target == nil {
+		return fmt.Errorf("currency (%s) not available", input)
+	}
+	if target.Available.Sign() <= 0 {
+		return fmt.Errorf("currency (%s) has no available balance", input)
+	}
+
+	market := trade.MarketFor(input)
+	fmt.Printf("Querying market %s\n", market)
+	summary, err := ex.GetMarketSummary(market)
+	if err != nil {
+		return err
 	}
 
-	return buf.String(), nil
+	return runCmd(ex, cmd, input, &summary, target, btc, usdt)
 }
 
-func (t *Trade) Run(currency string, args map[string]interface{}, refreshDuration time.Duration) error {
-	// Always update the trade before doing anything else. This will cause the
-	// default values to be setup correctly.  Update should also be called
-	// if the evaluate returns false for the next tick.
-	if err := t.update(t, args); err != nil {
+////////////////////////////////////////////////////////////////////////////////
+
+// runCandlesCmd manages the local candle store from the command line:
+//
+//	candles backfill <market> [interval]
+//	candles import <csv> [interval]
+//	candles export <market> <csv> [interval] [from] [to]
+//
+// `from` and `to` are RFC3339 times.
+func runCandlesCmd(ex exchange.Exchange, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("candles requires an action (backfill, import or export)")
+	}
+	action, args := strings.ToLower(args[0]), args[1:]
+
+	nargs := 1
+	if action == "export" {
+		nargs = 2
+	}
+	if len(args) < nargs {
+		return fmt.Errorf("candles %s is missing arguments", action)
+	}
+
+	interval := trade.CandleInterval
+	if len(args) > nargs {
+		interval = args[nargs]
+	}
+	if err := exchange.ValidateInterval(interval); err != nil {
 		return err
 	}
 
-	for {
-		res, err := t.Evaluate(args)
-		fatalOnError(err)
+	st, err := history.New(config.CandleDir, ex)
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "backfill":
+		n, err := st.Backfill(args[0], interval)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Stored %d new %s candles for %s\n", n, interval, strings.ToUpper(args[0]))
 
-		switch res {
-		case "true":
-			return t.execute(t, args)
-		case "false":
-			if err := t.update(t, args); err != nil {
+	case "import":
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		added, err := st.Import(f, interval)
+		if err != nil {
+			return err
+		}
+		for m, n := range added {
+			fmt.Printf("Stored %d new %s candles for %s\n", n, interval, m)
+		}
+
+	case "export":
+		var from, to time.Time
+		if len(args) > 3 {
+			if from, err = time.Parse(time.RFC3339, args[3]); err != nil {
+				return err
+			}
+		}
+		if len(args) > 4 {
+			if to, err = time.Parse(time.RFC3339, args[4]); err != nil {
 				return err
 			}
-		default:
-			return fmt.Errorf("invalid result %s", res)
 		}
 
-		<-time.After(refreshDuration)
-	}
+		f, err := os.Create(args[1])
+		if err != nil {
+			return err
+		}
+		if err := st.Export(f, args[0], interval, from, to); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		fmt.Printf("Exported %s %s candles to %s\n", strings.ToUpper(args[0]), interval, args[1])
 
-	return errors.New("unknown run error")
+	default:
+		return fmt.Errorf("unknown candles action %q (want backfill, import or export)", action)
+	}
+	return nil
 }
 
-var tradeMap = map[string]*Trade{
-	"limit-sell": &Trade{
-		evaluate: `{{ ge .Current .Target }}`,
-		inputs: []*Input{
-			{prompt: "Sell Limit (in BTC): ", key: "SellLimit"},
-			{prompt: "Sell Price (in BTC): ", key: "SellPrice"},
-		},
-		update: func(t *Trade, args map[string]interface{}) error {
-			args["FOO"] = "bar"
-			return nil
-		},
-		execute: func(t *Trade, args map[string]interface{}) error {
-			log.Printf("Trade exec called %#v\n", args)
-			return nil
-		},
-	},
-	"high-low": &Trade{
-		evaluate: `{{ ge 1 1 }}`,
-		update: func(t *Trade, args map[string]interface{}) error {
-			return nil
-		},
-		execute: func(t *Trade, args map[string]interface{}) error {
-			return nil
-		},
-	},
-	"stop-loss": &Trade{
-		evaluate: `{{ ge 1 1 }}`,
-		update: func(t *Trade, args map[string]interface{}) error {
-			return nil
-		},
-		execute: func(t *Trade, args map[string]interface{}) error {
-			return nil
-		},
-	},
+////////////////////////////////////////////////////////////////////////////////
+
+// backtestCandles returns the candles of `market` to backtest, read from the
+// configured csv or the candle store.
+func backtestCandles(market string) ([]exchange.Candle, error) {
+	if len(config.BacktestCandles) == 0 {
+		st, err := history.New(config.CandleDir, nil)
+		if err != nil {
+			return nil, err
+		}
+		cs, err := st.Range(market, config.BacktestInterval, time.Time{}, time.Time{})
+		if err == nil && len(cs) == 0 {
+			err = fmt.Errorf("no %s candles stored for %s (see the candles command)", config.BacktestInterval, market)
+		}
+		return cs, err
+	}
+
+	f, err := os.Open(config.BacktestCandles)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data, err := exchange.ReadCandlesCSV(f)
+	if err != nil {
+		return nil, err
+	}
+	cs, ok := data[market]
+	if !ok {
+		return nil, fmt.Errorf("%s has no candles for %s", config.BacktestCandles, market)
+	}
+	return cs, nil
 }
 
-////////////////////////////////////////////////////////////////////////////////
+// runBacktestCmd runs the trade `args[0]` over the candles of the market
+// `args[1]` with the inputs given as "Key=value" in the remaining `args`,
+// prompting for any others.
+func runBacktestCmd(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("backtest requires a trade and a market")
+	}
+	t, err := trade.New(strings.ToLower(args[0]))
+	if err != nil {
+		return err
+	}
 
-var (
-	stdinOnce    sync.Once
-	stdinScanner *bufio.Scanner
-)
+	currency := strings.ToUpper(args[1])
+	if i := strings.Index(currency, "-"); i >= 0 {
+		if currency[:i] != "BTC" {
+			return fmt.Errorf("only BTC markets can be backtested (got %s)", currency)
+		}
+		currency = currency[i+1:]
+	}
+	market := trade.MarketFor(currency)
 
-func getUserInput(msg string) string {
-	stdinOnce.Do(func() {
-		stdinScanner = bufio.NewScanner(os.Stdin)
-	})
+	cs, err := backtestCandles(market)
+	if err != nil {
+		return err
+	}
 
-	if stdinScanner != nil {
-		fmt.Printf(msg)
-		stdinScanner.Scan()
-		return stdinScanner.Text()
+	inputs := map[string]interface{}{}
+	for _, kv := range args[2:] {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid input %q (expected Key=value)", kv)
+		}
+		inputs[parts[0]] = parts[1]
+	}
+	for _, inp := range t.Inputs {
+		if _, ok := inputs[inp.Key]; !ok {
+			inputs[inp.Key] = getUserInput(inp.Prompt)
+		}
 	}
 
-	return ""
+	bs, err := exchange.LoadPaperBalances(config.PaperBalances)
+	if err != nil {
+		return err
+	}
+
+	r, err := backtest.Run(cs, &backtest.Options{
+		Trade:    t.Name,
+		Currency: currency,
+		Interval: config.BacktestInterval,
+		Args:     inputs,
+		Balances: bs,
+		Fee:      decimal.NewFromFloat(config.PaperFee),
+		Slippage: decimal.NewFromFloat(config.PaperSlippage),
+	})
+	if err != nil {
+		return err
+	}
+	printReport(r)
+
+	f, err := os.Create(config.BacktestEquity)
+	if err != nil {
+		return err
+	}
+	if err := r.WriteEquityCSV(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("Equity curve written to %s\n", config.BacktestEquity)
+	return nil
 }
 
-////////////////////////////////////////////////////////////////////////////////
+func printReport(r *backtest.Report) {
+	executed := "never"
+	if r.Executed {
+		executed = r.ExecutedAt.Format(time.RFC3339)
+	}
 
-func printSummary(s *bittrex.MarketSummary) {
 	fmt.Printf(`
-Market Summary:
-===============
-High:       ` + s.High.String() + `
-Low:        ` + s.Low.String() + `
-Ask:        ` + s.Ask.String() + `
-Bid:        ` + s.Bid.String() + `
-Last:       ` + s.Last.String() + `
-Volume:     ` + s.Volume.String() + `
-`)
+Backtest Report:
+================
+Trade:          %s
+Market:         %s
+Candles:        %d (%s to %s)
+Executed:       %s
+Open orders:    %d
+
+Fills:
+`, r.Trade, r.Market, r.Candles, r.From.Format(time.RFC3339), r.To.Format(time.RFC3339), executed, r.Open)
+
+	if len(r.Fills) == 0 {
+		fmt.Printf("  none\n")
+	}
+	for _, f := range r.Fills {
+		fmt.Printf("  %s  %-10s  %s @ %s  fee %s  pnl %s\n", f.TimeStamp.Format(time.RFC3339),
+			f.Type, f.Quantity, f.Rate.StringFixed(8), f.Commission.StringFixed(8), f.PnL.StringFixed(8))
+	}
+
+	winRate := "n/a"
+	if r.Wins+r.Losses > 0 {
+		winRate = fmt.Sprintf("%s%% (%d wins, %d losses)", r.WinRate, r.Wins, r.Losses)
+	}
+	fmt.Printf(`
+Start equity:   %s BTC
+End equity:     %s BTC
+P&L:            %s BTC (%s%%)
+Max drawdown:   %s%%
+Win rate:       %s
+
+`, r.StartEquity.StringFixed(8), r.EndEquity.StringFixed(8), r.PnL.StringFixed(8), r.PnLPercent, r.MaxDrawdown, winRate)
 }
 
 ////////////////////////////////////////////////////////////////////////////////
 
-func runCmd(cmd, currency string, market *bittrex.MarketSummary, target, btc, usdt *types.Balance) error {
-	fmt.Printf(`
-Available %s balance %f.
-Available USDT balance %f.
-Available BTC balance %f.
-`, currency, target.Available, usdt.Available, btc.Available)
-	printSummary(market)
+// runKillSwitchCmd engages ("halt [exit]") or re-arms ("rearm") the kill
+// switch.  A running server is asked to do so over its API, and only when no
+// server is running are the session db and the exchange acted on directly.
+func runKillSwitchCmd(ex exchange.Exchange, cmd string, args []string) error {
+	exit := len(args) > 0 && strings.EqualFold(args[0], "exit")
+	body := fmt.Sprintf(`{"Exit": %t}`, exit)
+
+	client := &http.Client{Timeout: killSwitchTimeout}
+	resp, err := client.Post("http://localhost"+listenAddr+"/api/killswitch/"+cmd, "application/json", strings.NewReader(body))
+	switch {
+	case err == nil:
+		defer resp.Body.Close()
+		var r struct {
+			Data  json.RawMessage
+			Error *struct{ Message string }
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+			return err
+		}
+		if r.Error != nil {
+			return errors.New(r.Error.Message)
+		}
+		fmt.Printf("%s\n", r.Data)
+		return nil
+	case !server.NotRunning(err):
+		// A server which is up but stalled still holds the db, and would
+		// overwrite a kill switch written to it here on its next flush.
+		return fmt.Errorf("server did not respond (%s), stop it and run %q again", err.Error(), cmd)
+	}
+	fmt.Printf("Server not running, updating %s directly\n", config.DbPath)
 
-	trade, ok := tradeMap[cmd]
-	if !ok {
-		return fmt.Errorf("invalid command (%s) specified", cmd)
+	// Engage the switch before the app is opened so that it does not resume
+	// any session, sessions are resumed by the server once re-armed.
+	d, err := db.New(config.DbPath)
+	if err != nil {
+		return err
+	}
+	k, err := d.GetKillSwitch()
+	if err != nil {
+		return err
+	}
+	if cmd == "rearm" {
+		if k.Engaged {
+			k.Engaged, k.RearmedAt = false, time.Now()
+		}
+		return d.SetKillSwitch(k)
+	}
+	if !k.Engaged {
+		k.Engaged, k.EngagedAt = true, time.Now()
+		if err := d.SetKillSwitch(k); err != nil {
+			return err
+		}
 	}
 
-	if err := trade.Setup(currency, target, btc, usdt); err != nil {
+	h, err := hub.New()
+	if err != nil {
 		return err
 	}
+	go h.Run()
 
-	// Iterate through the inputs as specified by the trade.
-	// Build a map and pass it to the exec function.
-	m := map[string]interface{}{}
-	for _, inp := range trade.inputs {
-		m[inp.key] = getUserInput(inp.prompt)
+	a, err := app.New(&config, h, ex)
+	if err != nil {
+		return err
+	}
+	halt, err := a.Halt(exit)
+	if err != nil {
+		return err
 	}
 
-	return trade.Run(currency, m, config.RefreshInterval)
+	fmt.Printf("Trading halted, cancelled %d orders, placed %d exit orders\n", len(halt.Cancelled), len(halt.Exits))
+	for _, e := range halt.Errors {
+		fmt.Printf("  %s\n", e)
+	}
+	return nil
 }
 
 ////////////////////////////////////////////////////////////////////////////////
-////////////////////////////////////////////////////////////////////////////////
-////////////////////////////////////////////////////////////////////////////////
-
-// cmd := strings.ToLower(cli.args[0])
-// switch cmd {
-// case "version":
-// 	fmt.Printf("%s\n", version)
-// 	return
-// case "usage", "help", "-h":
-// 	usageErr(nil)
-// 	return
-// case "limit-sell", "stop-loss", "high-low":
-// 	break
-// default:
-// 	usageErr(fmt.Errorf("%s is an invalid command", cmd))
-// 	return
-// }
-
-// h := &http.Client{
-// 	Timeout: time.Second * 20,
-// }
-// client := bittrex.NewWithCustomHttpClient(cli.apiKey, cli.secret, h)
-
-// fmt.Printf("Fetching bittrex balances for account...\n")
-// balances, err := client.GetBalances()
-// fatalOnError(err)
-
-// bs := []*types.Balance{}
-// for _, b := range balances {
-// 	ava, _ := b.Available.Float64()
-// 	bal, _ := b.Balance.Float64()
-// 	if bal > 0.0 {
-// 		bs = append(bs, &Balance{
-// 			Currency:  strings.ToUpper(b.Currency),
-// 			Available: ava,
-// 			Total:     bal,
-// 		})
-// 	}
-// }
-
-// fmt.Printf("Found the following balances:\n")
-// for i, bal := range bs {
-// 	fmt.Printf("% 3d. % 6s : %f available\n", i+1, bal.Currency, bal.Available)
-// }
-
-// input := getUserInput(`Which coin do you want to setup (ex: "PIVX"): `)
-// input = strings.ToUpper(input)
-
-// var (
-// 	target *types.Balance // chosen currency balance
-// 	btc    *types.Balance // BTC balance
-// 	usdt   *types.Balance // USDT balance
-// )
-// for _, bal := range bs {
-// 	switch bal.Currency {
-// 	case input:
-// 		target = bal
-// 	case "BTC":
-// 		btc = bal
-// 	case "USDT":
-// 		usdt = bal
-// 	}
-// }
-
-// if target == nil {
-// 	fmt.Printf("Currency (%s) not available.\n", input)
-// 	os.Exit(0)
-// }
-
-// if target.Available > 0.0 {
-// 	sourceCurrency := "BTC" // TODO: Fix this
-// 	market := fmt.Sprintf("%s-%s", sourceCurrency, input)
-
-// 	// TODO: This moves into the runCmd
-// 	fmt.Printf("Querying market %s\n", market)
-// 	summary, err := client.GetMarketSummary(market)
-// 	fatalOnError(err)
-
-// 	if len(summary) > 0 {
-// 		err := runCmd(cmd, input, &summary[0], target, usdt, btc)
-// 		fatalOnError(err)
-// 	} else {
-// 		fmt.Printf("Market summary does not exist for %s\n", market)
-// 	}
-// } else {
-// 	fmt.Printf("Currency (%s) has no available balance\n", input)
-// }
-
-////////////////////////////////////////////////////////////////////////////////
-////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,314 @@
+package exchange
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	bittrex "github.com/toorop/go-bittrex"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Bittrex adapts the vendored go-bittrex client to the Exchange interface.
+type Bittrex struct {
+	client *bittrex.Bittrex
+}
+
+// NewBittrex returns an Exchange backed by the bittrex REST and SignalR APIs.
+func NewBittrex(apiKey, secret string) *Bittrex {
+	return &Bittrex{
+		client: bittrex.New(apiKey, secret),
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func (b *Bittrex) Name() string {
+	return "bittrex"
+}
+
+func (b *Bittrex) GetBalances() ([]Balance, error) {
+	balances, err := b.client.GetBalances()
+	if err != nil {
+		return nil, err
+	}
+
+	bs := make([]Balance, 0, len(balances))
+	for _, bal := range balances {
+		bs = append(bs, Balance{
+			Currency:      strings.ToUpper(bal.Currency),
+			Balance:       bal.Balance,
+			Available:     bal.Available,
+			Pending:       bal.Pending,
+			CryptoAddress: bal.CryptoAddress,
+		})
+	}
+	return bs, nil
+}
+
+func (b *Bittrex) GetMarkets() ([]Market, error) {
+	markets, err := b.client.GetMarkets()
+	if err != nil {
+		return nil, err
+	}
+
+	ms := make([]Market, 0, len(markets))
+	for _, m := range markets {
+		ms = append(ms, Market{
+			MarketName:     m.MarketName,
+			BaseCurrency:   m.BaseCurrency,
+			MarketCurrency: m.MarketCurrency,
+			MinTradeSize:   m.MinTradeSize,
+			IsActive:       m.IsActive,
+		})
+	}
+	return ms, nil
+}
+
+func (b *Bittrex) GetTicker(market string) (Ticker, error) {
+	t, err := b.client.GetTicker(market)
+	if err != nil {
+		return Ticker{}, err
+	}
+
+	return Ticker{
+		Bid:  t.Bid,
+		Ask:  t.Ask,
+		Last: t.Last,
+	}, nil
+}
+
+func (b *Bittrex) GetMarketSummary(market string) (MarketSummary, error) {
+	ss, err := b.client.GetMarketSummary(market)
+	if err != nil {
+		return MarketSummary{}, err
+	}
+	if len(ss) == 0 {
+		return MarketSummary{}, fmt.Errorf("market summary does not exist for %s", market)
+	}
+
+	s := ss[0]
+	return MarketSummary{
+		MarketName: s.MarketName,
+		High:       s.High,
+		Low:        s.Low,
+		Ask:        s.Ask,
+		Bid:        s.Bid,
+		Last:       s.Last,
+		Volume:     s.Volume,
+		BaseVolume: s.BaseVolume,
+		PrevDay:    s.PrevDay,
+		TimeStamp:  s.TimeStamp,
+	}, nil
+}
+
+func (b *Bittrex) GetOrderBook(market string) (OrderBook, error) {
+	ob, err := b.client.GetOrderBook(market, "both")
+	if err != nil {
+		return OrderBook{}, err
+	}
+
+	return OrderBook{
+		Buy:  fromBittrexOrderb(ob.Buy),
+		Sell: fromBittrexOrderb(ob.Sell),
+	}, nil
+}
+
+func (b *Bittrex) GetTicks(market, interval string) ([]Candle, error) {
+	cs, err := b.client.GetTicks(market, interval)
+	if err != nil {
+		return nil, err
+	}
+	return fromBittrexCandles(cs), nil
+}
+
+func (b *Bittrex) GetLatestTick(market, interval string) ([]Candle, error) {
+	cs, err := b.client.GetLatestTick(market, interval)
+	if err != nil {
+		return nil, err
+	}
+	return fromBittrexCandles(cs), nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// BuyLimit places a limit buy.  The client takes floats which it formats with
+// 8 decimal places, so the 8 place amounts survive the conversion.
+func (b *Bittrex) BuyLimit(market string, quantity, rate decimal.Decimal) (string, error) {
+	q, r := toClientAmounts(quantity, rate)
+	return b.client.BuyLimit(market, q, r)
+}
+
+// SellLimit places a limit sell, see BuyLimit.
+func (b *Bittrex) SellLimit(market string, quantity, rate decimal.Decimal) (string, error) {
+	q, r := toClientAmounts(quantity, rate)
+	return b.client.SellLimit(market, q, r)
+}
+
+func (b *Bittrex) CancelOrder(uuid string) error {
+	return b.client.CancelOrder(uuid)
+}
+
+func (b *Bittrex) GetOrder(uuid string) (Order, error) {
+	o, err := b.client.GetOrder(uuid)
+	if err != nil {
+		return Order{}, err
+	}
+
+	return Order{
+		UUID:              o.OrderUuid,
+		Market:            o.Exchange,
+		Type:              o.Type,
+		Quantity:          o.Quantity,
+		QuantityRemaining: o.QuantityRemaining,
+		Limit:             o.Limit,
+		Price:             o.Price,
+		PricePerUnit:      o.PricePerUnit,
+		CommissionPaid:    o.CommissionPaid,
+		Opened:            parseBittrexTime(o.Opened),
+		Closed:            parseBittrexTime(o.Closed),
+		IsOpen:            o.IsOpen,
+		CancelInitiated:   o.CancelInitiated,
+	}, nil
+}
+
+func (b *Bittrex) GetOpenOrders(market string) ([]Order, error) {
+	orders, err := b.client.GetOpenOrders(market)
+	if err != nil {
+		return nil, err
+	}
+	return fromBittrexOrders(orders, true), nil
+}
+
+func (b *Bittrex) GetOrderHistory(market string) ([]Order, error) {
+	orders, err := b.client.GetOrderHistory(market)
+	if err != nil {
+		return nil, err
+	}
+	return fromBittrexOrders(orders, false), nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func (b *Bittrex) SubscribeExchangeUpdate(market string, dataCh chan<- ExchangeState, stop <-chan bool) error {
+	ch := make(chan bittrex.ExchangeState, 16)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- b.client.SubscribeExchangeUpdate(market, ch, stop)
+	}()
+
+	for {
+		select {
+		case st := <-ch:
+			select {
+			case dataCh <- fromBittrexExchangeState(st):
+			case <-stop:
+			}
+		case err := <-errCh:
+			return err
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// parseBittrexTime parses the timestamps returned by the bittrex order APIs,
+// which may or may not include fractional seconds.  Unparsable (or empty)
+// values return the zero time.
+func parseBittrexTime(s string) time.Time {
+	for _, layout := range []string{"2006-01-02T15:04:05.999999999", bittrex.TIME_FORMAT} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// toClientAmounts converts an order's quantity and rate to the floats taken by
+// the client, rounded to the 8 decimal places that bittrex accepts.
+func toClientAmounts(quantity, rate decimal.Decimal) (float64, float64) {
+	q, _ := quantity.Round(8).Float64()
+	r, _ := rate.Round(8).Float64()
+	return q, r
+}
+
+func fromBittrexOrderb(entries []bittrex.Orderb) []OrderBookEntry {
+	es := make([]OrderBookEntry, 0, len(entries))
+	for _, o := range entries {
+		es = append(es, OrderBookEntry{
+			Quantity: o.Quantity,
+			Rate:     o.Rate,
+		})
+	}
+	return es
+}
+
+func fromBittrexCandles(cs []bittrex.Candle) []Candle {
+	ret := make([]Candle, 0, len(cs))
+	for _, c := range cs {
+		ret = append(ret, Candle{
+			TimeStamp:  c.TimeStamp.Time,
+			Open:       c.Open,
+			High:       c.High,
+			Low:        c.Low,
+			Close:      c.Close,
+			Volume:     c.Volume,
+			BaseVolume: c.BaseVolume,
+		})
+	}
+	return ret
+}
+
+func fromBittrexOrders(orders []bittrex.Order, open bool) []Order {
+	ret := make([]Order, 0, len(orders))
+	for _, o := range orders {
+		ret = append(ret, Order{
+			UUID:              o.OrderUuid,
+			Market:            o.Exchange,
+			Type:              o.OrderType,
+			Quantity:          o.Quantity,
+			QuantityRemaining: o.QuantityRemaining,
+			Limit:             o.Limit,
+			Price:             o.Price,
+			PricePerUnit:      o.PricePerUnit,
+			CommissionPaid:    o.Commission,
+			Opened:            o.TimeStamp.Time,
+			IsOpen:            open,
+		})
+	}
+	return ret
+}
+
+func fromBittrexExchangeState(st bittrex.ExchangeState) ExchangeState {
+	ret := ExchangeState{
+		MarketName: st.MarketName,
+		Nonce:      st.Nounce,
+		Initial:    st.Initial,
+	}
+	for _, u := range st.Buys {
+		ret.Buys = append(ret.Buys, OrderUpdate{
+			OrderBookEntry: OrderBookEntry{Quantity: u.Quantity, Rate: u.Rate},
+			Type:           u.Type,
+		})
+	}
+	for _, u := range st.Sells {
+		ret.Sells = append(ret.Sells, OrderUpdate{
+			OrderBookEntry: OrderBookEntry{Quantity: u.Quantity, Rate: u.Rate},
+			Type:           u.Type,
+		})
+	}
+	for _, f := range st.Fills {
+		ret.Fills = append(ret.Fills, Fill{
+			OrderBookEntry: OrderBookEntry{Quantity: f.Quantity, Rate: f.Rate},
+			OrderType:      f.OrderType,
+			TimeStamp:      f.Timestamp.Time,
+		})
+	}
+	return ret
+}
+
+////////////////////////////////////////////////////////////////////////////////
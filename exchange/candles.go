@@ -0,0 +1,156 @@
+package exchange
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Candle intervals supported by GetTicks and GetLatestTick.
+const (
+	IntervalOneMin    = "oneMin"
+	IntervalFiveMin   = "fiveMin"
+	IntervalThirtyMin = "thirtyMin"
+	IntervalHour      = "hour"
+	IntervalDay       = "day"
+)
+
+// Intervals lists the candle intervals, shortest first.
+var Intervals = []string{IntervalOneMin, IntervalFiveMin, IntervalThirtyMin, IntervalHour, IntervalDay}
+
+// marketPattern matches market names, ex: "BTC-PIVX".
+var marketPattern = regexp.MustCompile(`^[A-Z0-9]+-[A-Z0-9]+$`)
+
+var intervalDurations = map[string]time.Duration{
+	IntervalOneMin:    time.Minute,
+	IntervalFiveMin:   5 * time.Minute,
+	IntervalThirtyMin: 30 * time.Minute,
+	IntervalHour:      time.Hour,
+	IntervalDay:       24 * time.Hour,
+}
+
+// IntervalDuration returns the duration of a candle at `interval`, false if
+// the interval is not supported.
+func IntervalDuration(interval string) (time.Duration, bool) {
+	d, ok := intervalDurations[interval]
+	return d, ok
+}
+
+// ValidateInterval returns an error if `interval` is not supported.
+func ValidateInterval(interval string) error {
+	if _, ok := intervalDurations[interval]; !ok {
+		return fmt.Errorf("invalid interval %q (have: %s)", interval, strings.Join(Intervals, ", "))
+	}
+	return nil
+}
+
+// ValidateMarket returns an error if `market` is not a market name (ex:
+// "BTC-PIVX"), in any case.
+func ValidateMarket(market string) error {
+	if !marketPattern.MatchString(strings.ToUpper(market)) {
+		return fmt.Errorf("invalid market %q (ex: BTC-PIVX)", market)
+	}
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// CandleCSVHeader is the header row written by WriteCandlesCSV.
+var CandleCSVHeader = []string{"Market", "TimeStamp", "Open", "High", "Low", "Close", "Volume", "BaseVolume"}
+
+// ReadCandlesCSV reads candles keyed by market from CSV with the columns:
+// Market, TimeStamp (RFC3339), Open, High, Low, Close, Volume and optionally
+// BaseVolume.  A header row is skipped if present.  Each market's candles are
+// sorted by time.
+func ReadCandlesCSV(r io.Reader) (map[string][]Candle, error) {
+	rd := csv.NewReader(r)
+	rd.FieldsPerRecord = -1
+
+	data := map[string][]Candle{}
+	for line := 1; ; line++ {
+		rec, err := rd.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if line == 1 && strings.EqualFold(rec[0], "market") {
+			continue
+		}
+		if len(rec) < 7 {
+			return nil, fmt.Errorf("candle csv line %d: expected at least 7 columns", line)
+		}
+
+		ts, err := time.Parse(time.RFC3339, rec[1])
+		if err != nil {
+			return nil, fmt.Errorf("candle csv line %d: %s", line, err.Error())
+		}
+
+		vals := make([]decimal.Decimal, 6)
+		for i := 2; i < len(rec) && i < 8; i++ {
+			vals[i-2], err = decimal.NewFromString(rec[i])
+			if err != nil {
+				return nil, fmt.Errorf("candle csv line %d: %s", line, err.Error())
+			}
+		}
+
+		m := strings.ToUpper(rec[0])
+		data[m] = append(data[m], Candle{
+			TimeStamp:  ts,
+			Open:       vals[0],
+			High:       vals[1],
+			Low:        vals[2],
+			Close:      vals[3],
+			Volume:     vals[4],
+			BaseVolume: vals[5],
+		})
+	}
+
+	for m := range data {
+		cs := data[m]
+		sort.SliceStable(cs, func(i, j int) bool { return cs[i].TimeStamp.Before(cs[j].TimeStamp) })
+	}
+	return data, nil
+}
+
+// WriteCandlesCSV writes the candles `cs` of `market` (with a header row) in
+// the format read by ReadCandlesCSV.
+func WriteCandlesCSV(w io.Writer, market string, cs []Candle) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(CandleCSVHeader); err != nil {
+		return err
+	}
+
+	market = strings.ToUpper(market)
+	for _, c := range cs {
+		rec := []string{
+			market,
+			c.TimeStamp.UTC().Format(time.RFC3339),
+			c.Open.String(),
+			c.High.String(),
+			c.Low.String(),
+			c.Close.String(),
+			c.Volume.String(),
+			c.BaseVolume.String(),
+		}
+		if err := cw.Write(rec); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+////////////////////////////////////////////////////////////////////////////////
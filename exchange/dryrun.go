@@ -0,0 +1,127 @@
+package exchange
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sabhiram/trade-bot/types"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+const (
+	dryRunPrefix = "DRY-RUN-" // prefix of the UUIDs of dry-run orders
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// DryRun wraps an exchange so that orders are logged and recorded instead of
+// being sent to it.  Dry-run orders rest (unfilled) until they are cancelled,
+// every other call is passed through to the wrapped exchange.
+type DryRun struct {
+	Exchange
+	Quiet bool // record orders without logging them
+
+	sync.Mutex
+	orders map[string]*Order
+	placed []string // UUIDs in the order they were placed
+}
+
+// NewDryRun returns a dry-run wrapper around `ex`.
+func NewDryRun(ex Exchange) *DryRun {
+	return &DryRun{
+		Exchange: ex,
+		orders:   map[string]*Order{},
+		placed:   []string{},
+	}
+}
+
+func (d *DryRun) Name() string {
+	return d.Exchange.Name() + " (dry-run)"
+}
+
+func (d *DryRun) BuyLimit(market string, quantity, rate decimal.Decimal) (string, error) {
+	return d.place(market, OrderTypeLimitBuy, quantity, rate), nil
+}
+
+func (d *DryRun) SellLimit(market string, quantity, rate decimal.Decimal) (string, error) {
+	return d.place(market, OrderTypeLimitSell, quantity, rate), nil
+}
+
+func (d *DryRun) CancelOrder(uuid string) error {
+	d.Lock()
+	defer d.Unlock()
+
+	d.logf("DryRun :: would cancel order %s\n", uuid)
+	o, ok := d.orders[uuid]
+	if !ok {
+		return nil
+	}
+	if !o.IsOpen {
+		return ErrOrderNotOpen
+	}
+	o.IsOpen = false
+	o.Closed = time.Now()
+	return nil
+}
+
+func (d *DryRun) GetOrder(uuid string) (Order, error) {
+	d.Lock()
+	o, ok := d.orders[uuid]
+	d.Unlock()
+
+	if !ok {
+		return d.Exchange.GetOrder(uuid)
+	}
+	return *o, nil
+}
+
+// Orders returns the orders recorded so far, in the order they were placed.
+func (d *DryRun) Orders() []Order {
+	d.Lock()
+	defer d.Unlock()
+
+	ret := []Order{}
+	for _, uuid := range d.placed {
+		ret = append(ret, *d.orders[uuid])
+	}
+	return ret
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// place records an order and returns its UUID.
+func (d *DryRun) place(market, typ string, quantity, rate decimal.Decimal) string {
+	d.Lock()
+	defer d.Unlock()
+
+	o := &Order{
+		UUID:              dryRunPrefix + string(types.NewUUID()),
+		Market:            strings.ToUpper(market),
+		Type:              typ,
+		Quantity:          quantity,
+		QuantityRemaining: quantity,
+		Limit:             rate,
+		Opened:            time.Now(),
+		IsOpen:            true,
+	}
+	d.orders[o.UUID] = o
+	d.placed = append(d.placed, o.UUID)
+
+	d.logf("DryRun :: would place %s of %s %s @ %s (%s)\n", typ, quantity, o.Market, rate.StringFixed(8), o.UUID)
+	return o.UUID
+}
+
+func (d *DryRun) logf(format string, args ...interface{}) {
+	if !d.Quiet {
+		log.Printf(format, args...)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
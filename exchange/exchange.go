@@ -0,0 +1,177 @@
+// Package exchange defines the venue agnostic interface that the app uses to
+// query markets and place orders, along with the data types it returns.
+package exchange
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+const (
+	AllMarkets = "all" // pass to GetOpenOrders / GetOrderHistory for every market
+)
+
+const (
+	OrderTypeLimitBuy  = "LIMIT_BUY"
+	OrderTypeLimitSell = "LIMIT_SELL"
+)
+
+const (
+	UpdateTypeAdd    = 0 // new rate added to the book
+	UpdateTypeRemove = 1 // rate removed from the book
+	UpdateTypeUpdate = 2 // quantity at an existing rate changed
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// MarketData is the public (unauthenticated) half of an exchange.  Price feeds
+// used by the paper exchange implement only this interface.
+type MarketData interface {
+	GetMarkets() ([]Market, error)
+	GetTicker(market string) (Ticker, error)
+	GetMarketSummary(market string) (MarketSummary, error)
+	GetOrderBook(market string) (OrderBook, error)
+	GetTicks(market, interval string) ([]Candle, error)
+	GetLatestTick(market, interval string) ([]Candle, error)
+
+	// SubscribeExchangeUpdate streams order book deltas and fills for the
+	// `market` into `dataCh` until `stop` is closed or the connection drops.
+	SubscribeExchangeUpdate(market string, dataCh chan<- ExchangeState, stop <-chan bool) error
+}
+
+// Exchange is implemented by any venue (real or simulated) that the app can
+// trade against.
+type Exchange interface {
+	MarketData
+
+	// Name returns a short identifier for the venue.
+	Name() string
+
+	// Account queries.
+	GetBalances() ([]Balance, error)
+
+	// Orders.
+	BuyLimit(market string, quantity, rate decimal.Decimal) (string, error)
+	SellLimit(market string, quantity, rate decimal.Decimal) (string, error)
+	CancelOrder(uuid string) error
+	GetOrder(uuid string) (Order, error)
+	GetOpenOrders(market string) ([]Order, error)
+	GetOrderHistory(market string) ([]Order, error)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Balance is the account balance for a single currency.
+type Balance struct {
+	Currency      string
+	Balance       decimal.Decimal
+	Available     decimal.Decimal
+	Pending       decimal.Decimal
+	CryptoAddress string
+}
+
+// Market describes a tradable pair (ex: "BTC-PIVX").
+type Market struct {
+	MarketName     string
+	BaseCurrency   string
+	MarketCurrency string
+	MinTradeSize   decimal.Decimal
+	IsActive       bool
+}
+
+// Ticker is the current best bid, best ask and last trade for a market.
+type Ticker struct {
+	Bid  decimal.Decimal
+	Ask  decimal.Decimal
+	Last decimal.Decimal
+}
+
+// Equal returns true if both tickers have the same prices.
+func (t Ticker) Equal(o Ticker) bool {
+	return t.Bid.Equal(o.Bid) && t.Ask.Equal(o.Ask) && t.Last.Equal(o.Last)
+}
+
+// MarketSummary is the 24 hour summary for a market.
+type MarketSummary struct {
+	MarketName string
+	High       decimal.Decimal
+	Low        decimal.Decimal
+	Ask        decimal.Decimal
+	Bid        decimal.Decimal
+	Last       decimal.Decimal
+	Volume     decimal.Decimal
+	BaseVolume decimal.Decimal
+	PrevDay    decimal.Decimal
+	TimeStamp  string
+}
+
+// OrderBookEntry is a single rate level in an order book.
+type OrderBookEntry struct {
+	Quantity decimal.Decimal
+	Rate     decimal.Decimal
+}
+
+// OrderBook contains the bids (Buy) and asks (Sell) for a market.
+type OrderBook struct {
+	Buy  []OrderBookEntry
+	Sell []OrderBookEntry
+}
+
+// Candle is a single OHLCV bar.
+type Candle struct {
+	TimeStamp  time.Time
+	Open       decimal.Decimal
+	High       decimal.Decimal
+	Low        decimal.Decimal
+	Close      decimal.Decimal
+	Volume     decimal.Decimal
+	BaseVolume decimal.Decimal
+}
+
+// Order is an order as reported by the exchange.
+type Order struct {
+	UUID              string
+	Market            string
+	Type              string // OrderTypeLimitBuy or OrderTypeLimitSell
+	Quantity          decimal.Decimal
+	QuantityRemaining decimal.Decimal
+	Limit             decimal.Decimal
+	Price             decimal.Decimal // total cost of the filled portion
+	PricePerUnit      decimal.Decimal
+	CommissionPaid    decimal.Decimal
+	Opened            time.Time
+	Closed            time.Time
+	IsOpen            bool
+	CancelInitiated   bool
+}
+
+// OrderUpdate is an incremental change to one rate in the order book.
+type OrderUpdate struct {
+	OrderBookEntry
+	Type int // one of the UpdateType* constants
+}
+
+// Fill is a trade that executed on the market.
+type Fill struct {
+	OrderBookEntry
+	OrderType string // "BUY" or "SELL"
+	TimeStamp time.Time
+}
+
+// ExchangeState is a single streamed update for a market.  The first state
+// for a subscription has `Initial` set and contains the full book.
+type ExchangeState struct {
+	MarketName string
+	Nonce      int
+	Buys       []OrderUpdate
+	Sells      []OrderUpdate
+	Fills      []Fill
+	Initial    bool
+}
+
+////////////////////////////////////////////////////////////////////////////////
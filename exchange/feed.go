@@ -0,0 +1,443 @@
+package exchange
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"errors"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+const (
+	feedBookLevels    = 10    // levels per side in a generated order book
+	syntheticWarmup   = 200   // candles of history generated before `start`
+	syntheticSubSteps = 4     // random walk steps per synthetic candle
+	defaultSpread     = 0.002 // fractional spread between bid and ask
+)
+
+var (
+	errUnknownMarket = errors.New("INVALID_MARKET")
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// candleSource produces the candle history for a market as of `now`.  The
+// last candle returned is the "current" one.
+type candleSource interface {
+	markets() []string
+	history(market string, now time.Time) ([]Candle, error)
+}
+
+// Feed is a MarketData implementation that derives tickers, summaries and
+// order books from a candle source.  It backs the paper exchange when trading
+// against synthetic or replayed prices.
+type Feed struct {
+	src    candleSource
+	step   time.Duration
+	spread decimal.Decimal
+}
+
+func newFeed(src candleSource, step time.Duration) *Feed {
+	return &Feed{
+		src:    src,
+		step:   step,
+		spread: decimal.NewFromFloat(defaultSpread),
+	}
+}
+
+// NewSyntheticFeed returns a feed which generates a random walk (with a
+// fractional `volatility` per step) for every market it is asked about.
+// Markets listed in `prices` start at the given price, all others start at
+// 0.001 (or 10000 for USDT markets).  A new candle is produced every `step`.
+func NewSyntheticFeed(prices map[string]float64, volatility float64, step time.Duration, seed int64) *Feed {
+	s := &synthetic{
+		seed:       seed,
+		step:       step,
+		start:      time.Now(),
+		volatility: volatility,
+		prices:     map[string]float64{},
+		paths:      map[string][]Candle{},
+		rngs:       map[string]*rand.Rand{},
+	}
+	for m, p := range prices {
+		s.prices[strings.ToUpper(m)] = p
+	}
+	return newFeed(s, step)
+}
+
+// NewReplayFeed returns a feed which replays the candles found in the CSV file
+// at `path`, advancing one candle every `step`.  The CSV is expected to have
+// the columns: Market, TimeStamp (RFC3339), Open, High, Low, Close, Volume and
+// optionally BaseVolume.  A header row is skipped if present.
+func NewReplayFeed(path string, step time.Duration) (*Feed, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data, err := ReadCandlesCSV(f)
+	if err != nil {
+		return nil, err
+	}
+
+	return newFeed(&replay{
+		step:  step,
+		start: time.Now(),
+		data:  data,
+	}, step), nil
+}
+
+// Stepped is a feed over recorded candles which only advances when Step is
+// called, ex: to backtest a trade one candle at a time.
+type Stepped struct {
+	*Feed
+	src *stepped
+}
+
+// NewSteppedFeed returns a feed positioned at the first of the candles in
+// `data` (keyed by market), `step` is the candles' interval.
+func NewSteppedFeed(data map[string][]Candle, step time.Duration) *Stepped {
+	src := &stepped{replay: replay{data: data}}
+	return &Stepped{Feed: newFeed(src, step), src: src}
+}
+
+// Step advances the feed by one candle, it returns false (and does not move)
+// once every market is at its last candle.
+func (s *Stepped) Step() bool {
+	s.src.Lock()
+	defer s.src.Unlock()
+
+	for _, cs := range s.src.data {
+		if s.src.idx+1 < len(cs) {
+			s.src.idx++
+			return true
+		}
+	}
+	return false
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func (f *Feed) last(market string) (Candle, []Candle, error) {
+	cs, err := f.src.history(strings.ToUpper(market), time.Now())
+	if err != nil {
+		return Candle{}, nil, err
+	}
+	if len(cs) == 0 {
+		return Candle{}, nil, errUnknownMarket
+	}
+	return cs[len(cs)-1], cs, nil
+}
+
+func (f *Feed) GetMarkets() ([]Market, error) {
+	ms := []Market{}
+	for _, name := range f.src.markets() {
+		parts := strings.SplitN(name, "-", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		ms = append(ms, Market{
+			MarketName:     name,
+			BaseCurrency:   parts[0],
+			MarketCurrency: parts[1],
+			MinTradeSize:   decimal.New(1, -8),
+			IsActive:       true,
+		})
+	}
+	return ms, nil
+}
+
+func (f *Feed) GetTicker(market string) (Ticker, error) {
+	c, _, err := f.last(market)
+	if err != nil {
+		return Ticker{}, err
+	}
+
+	half := f.spread.Div(decimal.New(2, 0))
+	return Ticker{
+		Bid:  c.Close.Mul(decimal.New(1, 0).Sub(half)).Round(8),
+		Ask:  c.Close.Mul(decimal.New(1, 0).Add(half)).Round(8),
+		Last: c.Close,
+	}, nil
+}
+
+func (f *Feed) GetMarketSummary(market string) (MarketSummary, error) {
+	c, cs, err := f.last(market)
+	if err != nil {
+		return MarketSummary{}, err
+	}
+	t, err := f.GetTicker(market)
+	if err != nil {
+		return MarketSummary{}, err
+	}
+
+	s := MarketSummary{
+		MarketName: strings.ToUpper(market),
+		High:       c.High,
+		Low:        c.Low,
+		Ask:        t.Ask,
+		Bid:        t.Bid,
+		Last:       t.Last,
+		PrevDay:    c.Open,
+		TimeStamp:  c.TimeStamp.Format(time.RFC3339),
+	}
+
+	dayAgo := c.TimeStamp.Add(-24 * time.Hour)
+	for i := len(cs) - 1; i >= 0 && cs[i].TimeStamp.After(dayAgo); i-- {
+		s.High = decimal.Max(s.High, cs[i].High)
+		s.Low = decimal.Min(s.Low, cs[i].Low)
+		s.Volume = s.Volume.Add(cs[i].Volume)
+		s.BaseVolume = s.BaseVolume.Add(cs[i].BaseVolume)
+		s.PrevDay = cs[i].Open
+	}
+	return s, nil
+}
+
+func (f *Feed) GetOrderBook(market string) (OrderBook, error) {
+	c, _, err := f.last(market)
+	if err != nil {
+		return OrderBook{}, err
+	}
+	t, err := f.GetTicker(market)
+	if err != nil {
+		return OrderBook{}, err
+	}
+
+	qty := c.Volume.Div(decimal.New(feedBookLevels, 0)).Round(8)
+	if qty.Sign() <= 0 {
+		qty = decimal.New(100, 0)
+	}
+
+	ob := OrderBook{}
+	tick := t.Last.Mul(f.spread).Div(decimal.New(2, 0))
+	for i := 0; i < feedBookLevels; i++ {
+		off := tick.Mul(decimal.New(int64(i), 0))
+		ob.Buy = append(ob.Buy, OrderBookEntry{Quantity: qty, Rate: t.Bid.Sub(off).Round(8)})
+		ob.Sell = append(ob.Sell, OrderBookEntry{Quantity: qty, Rate: t.Ask.Add(off).Round(8)})
+	}
+	return ob, nil
+}
+
+func (f *Feed) GetTicks(market, interval string) ([]Candle, error) {
+	_, cs, err := f.last(market)
+	if err != nil {
+		return nil, err
+	}
+	return append([]Candle{}, cs...), nil
+}
+
+func (f *Feed) GetLatestTick(market, interval string) ([]Candle, error) {
+	c, _, err := f.last(market)
+	if err != nil {
+		return nil, err
+	}
+	return []Candle{c}, nil
+}
+
+// SubscribeExchangeUpdate emits a full book snapshot (flagged `Initial`) along
+// with a single fill at the close price every time the feed advances.
+func (f *Feed) SubscribeExchangeUpdate(market string, dataCh chan<- ExchangeState, stop <-chan bool) error {
+	ticker := time.NewTicker(f.step)
+	defer ticker.Stop()
+
+	for nonce := 1; ; nonce++ {
+		c, _, err := f.last(market)
+		if err != nil {
+			return err
+		}
+		ob, err := f.GetOrderBook(market)
+		if err != nil {
+			return err
+		}
+
+		st := ExchangeState{
+			MarketName: strings.ToUpper(market),
+			Nonce:      nonce,
+			Initial:    true,
+			Fills: []Fill{{
+				OrderBookEntry: OrderBookEntry{Quantity: c.Volume, Rate: c.Close},
+				OrderType:      "BUY",
+				TimeStamp:      c.TimeStamp,
+			}},
+		}
+		for _, e := range ob.Buy {
+			st.Buys = append(st.Buys, OrderUpdate{OrderBookEntry: e, Type: UpdateTypeAdd})
+		}
+		for _, e := range ob.Sell {
+			st.Sells = append(st.Sells, OrderUpdate{OrderBookEntry: e, Type: UpdateTypeAdd})
+		}
+
+		select {
+		case dataCh <- st:
+		case <-stop:
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return nil
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// synthetic generates a seeded random walk per market.
+type synthetic struct {
+	sync.Mutex
+
+	seed       int64
+	step       time.Duration
+	start      time.Time
+	volatility float64
+	prices     map[string]float64    // starting price per market
+	paths      map[string][]Candle   // generated candles per market
+	rngs       map[string]*rand.Rand // per market generator
+}
+
+func (s *synthetic) markets() []string {
+	s.Lock()
+	defer s.Unlock()
+
+	seen := map[string]struct{}{}
+	for m := range s.prices {
+		seen[m] = struct{}{}
+	}
+	for m := range s.paths {
+		seen[m] = struct{}{}
+	}
+
+	ms := []string{}
+	for m := range seen {
+		ms = append(ms, m)
+	}
+	sort.Strings(ms)
+	return ms
+}
+
+func (s *synthetic) history(market string, now time.Time) ([]Candle, error) {
+	if !strings.Contains(market, "-") {
+		return nil, errUnknownMarket
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	n := syntheticWarmup + int(now.Sub(s.start)/s.step) + 1
+	path := s.paths[market]
+	if len(path) >= n {
+		return path[:n], nil
+	}
+
+	rng, ok := s.rngs[market]
+	if !ok {
+		h := fnv.New64a()
+		h.Write([]byte(market))
+		rng = rand.New(rand.NewSource(s.seed ^ int64(h.Sum64())))
+		s.rngs[market] = rng
+	}
+
+	price, ok := s.prices[market]
+	if !ok {
+		price = 0.001
+		if strings.HasPrefix(market, "USDT-") {
+			price = 10000
+		}
+	}
+	if len(path) > 0 {
+		price, _ = path[len(path)-1].Close.Float64()
+	}
+
+	origin := s.start.Add(-time.Duration(syntheticWarmup) * s.step)
+	for i := len(path); i < n; i++ {
+		open, high, low := price, price, price
+		for j := 0; j < syntheticSubSteps; j++ {
+			price *= math.Exp(rng.NormFloat64() * s.volatility / math.Sqrt(syntheticSubSteps))
+			high = math.Max(high, price)
+			low = math.Min(low, price)
+		}
+		vol := 10 + rng.Float64()*1000
+		path = append(path, Candle{
+			TimeStamp:  origin.Add(time.Duration(i) * s.step),
+			Open:       decimal.NewFromFloat(open).Round(8),
+			High:       decimal.NewFromFloat(high).Round(8),
+			Low:        decimal.NewFromFloat(low).Round(8),
+			Close:      decimal.NewFromFloat(price).Round(8),
+			Volume:     decimal.NewFromFloat(vol).Round(8),
+			BaseVolume: decimal.NewFromFloat(vol * price).Round(8),
+		})
+	}
+	s.paths[market] = path
+	return path, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// replay steps through pre-recorded candles.
+type replay struct {
+	step  time.Duration
+	start time.Time
+	data  map[string][]Candle
+}
+
+func (r *replay) markets() []string {
+	ms := []string{}
+	for m := range r.data {
+		ms = append(ms, m)
+	}
+	sort.Strings(ms)
+	return ms
+}
+
+func (r *replay) history(market string, now time.Time) ([]Candle, error) {
+	cs, ok := r.data[market]
+	if !ok {
+		return nil, errUnknownMarket
+	}
+
+	idx := int(now.Sub(r.start) / r.step)
+	if idx >= len(cs) {
+		idx = len(cs) - 1
+	}
+	return cs[:idx+1], nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// stepped replays candles up to an index which is advanced explicitly.
+type stepped struct {
+	sync.Mutex
+	replay
+
+	idx int
+}
+
+func (s *stepped) history(market string, now time.Time) ([]Candle, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	cs, ok := s.data[market]
+	if !ok {
+		return nil, errUnknownMarket
+	}
+
+	idx := s.idx
+	if idx >= len(cs) {
+		idx = len(cs) - 1
+	}
+	return cs[:idx+1], nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,379 @@
+package exchange
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sabhiram/trade-bot/types"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Error messages mirror the ones returned by the bittrex API so that callers
+// see the same failures in paper mode.
+var (
+	ErrInsufficientFunds = errors.New("INSUFFICIENT_FUNDS")
+	ErrInvalidOrder      = errors.New("INVALID_ORDER")
+	ErrOrderNotOpen      = errors.New("ORDER_NOT_OPEN")
+	ErrInvalidQuantity   = errors.New("QUANTITY_INVALID")
+	ErrInvalidRate       = errors.New("RATE_INVALID")
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+type paperBalance struct {
+	total     decimal.Decimal
+	available decimal.Decimal
+}
+
+type paperOrder struct {
+	Order
+	reserved decimal.Decimal // funds held while the order is open
+}
+
+// Paper is a simulated exchange.  It keeps virtual balances and matches limit
+// orders against the prices reported by its MarketData feed, charging `fee`
+// (as a fraction of the traded amount) on every fill.  Fills are `slippage`
+// (as a fraction of the price) worse than the bid or ask, but never worse than
+// the order's limit.  Orders are matched whenever the paper exchange is
+// queried for tickers, balances or orders.
+type Paper struct {
+	MarketData // price feed the orders are matched against
+
+	sync.Mutex
+	fee      decimal.Decimal
+	slippage decimal.Decimal
+	balances map[string]*paperBalance
+	orders   map[string]*paperOrder
+}
+
+// NewPaper returns a paper exchange seeded with `balances`.
+func NewPaper(feed MarketData, balances map[string]decimal.Decimal, fee, slippage decimal.Decimal) *Paper {
+	p := &Paper{
+		MarketData: feed,
+		fee:        fee,
+		slippage:   slippage,
+		balances:   map[string]*paperBalance{},
+		orders:     map[string]*paperOrder{},
+	}
+	for c, v := range balances {
+		p.balances[strings.ToUpper(c)] = &paperBalance{total: v, available: v}
+	}
+	return p
+}
+
+// LoadPaperBalances parses the initial paper balances from `spec`.  If `spec`
+// names a file, it is read as a JSON object mapping currencies to amounts (ex:
+// {"BTC": "0.5"}).  Otherwise it is parsed as a comma separated list of
+// currency:amount pairs (ex: "BTC:0.5,PIVX:100").
+func LoadPaperBalances(spec string) (map[string]decimal.Decimal, error) {
+	bs := map[string]decimal.Decimal{}
+	if len(spec) == 0 {
+		return bs, nil
+	}
+
+	if _, err := os.Stat(spec); err == nil {
+		data, err := ioutil.ReadFile(spec)
+		if err != nil {
+			return nil, err
+		}
+		return bs, json.Unmarshal(data, &bs)
+	}
+
+	for _, pair := range strings.Split(spec, ",") {
+		kv := strings.SplitN(strings.TrimSpace(pair), ":", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid paper balance %q (expected CUR:amount)", pair)
+		}
+		v, err := decimal.NewFromString(kv[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid paper balance %q: %s", pair, err.Error())
+		}
+		bs[strings.ToUpper(kv[0])] = v
+	}
+	return bs, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func (p *Paper) Name() string {
+	return "paper"
+}
+
+// GetTicker returns the feed's ticker, matching any open orders for `market`
+// against it first.
+func (p *Paper) GetTicker(market string) (Ticker, error) {
+	t, err := p.MarketData.GetTicker(market)
+	if err != nil {
+		return Ticker{}, err
+	}
+
+	p.Lock()
+	p.match(strings.ToUpper(market), t)
+	p.Unlock()
+	return t, nil
+}
+
+func (p *Paper) GetBalances() ([]Balance, error) {
+	p.matchAll()
+
+	p.Lock()
+	defer p.Unlock()
+
+	bs := []Balance{}
+	for c, b := range p.balances {
+		bs = append(bs, Balance{
+			Currency:  c,
+			Balance:   b.total,
+			Available: b.available,
+		})
+	}
+	sort.Slice(bs, func(i, j int) bool { return bs[i].Currency < bs[j].Currency })
+	return bs, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func (p *Paper) BuyLimit(market string, quantity, rate decimal.Decimal) (string, error) {
+	return p.place(market, OrderTypeLimitBuy, quantity, rate)
+}
+
+func (p *Paper) SellLimit(market string, quantity, rate decimal.Decimal) (string, error) {
+	return p.place(market, OrderTypeLimitSell, quantity, rate)
+}
+
+func (p *Paper) CancelOrder(uuid string) error {
+	p.Lock()
+	defer p.Unlock()
+
+	o, ok := p.orders[uuid]
+	if !ok {
+		return ErrInvalidOrder
+	}
+	if !o.IsOpen {
+		return ErrOrderNotOpen
+	}
+
+	base, mkt, _ := splitMarket(o.Market)
+	if o.Type == OrderTypeLimitBuy {
+		p.balance(base).available = p.balance(base).available.Add(o.reserved)
+	} else {
+		p.balance(mkt).available = p.balance(mkt).available.Add(o.reserved)
+	}
+
+	o.reserved = decimal.Zero
+	o.IsOpen = false
+	o.CancelInitiated = true
+	o.Closed = time.Now()
+	return nil
+}
+
+func (p *Paper) GetOrder(uuid string) (Order, error) {
+	p.Lock()
+	o, ok := p.orders[uuid]
+	p.Unlock()
+	if !ok {
+		return Order{}, ErrInvalidOrder
+	}
+
+	// Give the order a chance to fill before reporting on it.
+	p.GetTicker(o.Market)
+
+	p.Lock()
+	defer p.Unlock()
+	return o.Order, nil
+}
+
+func (p *Paper) GetOpenOrders(market string) ([]Order, error) {
+	p.matchAll()
+	return p.filter(market, true), nil
+}
+
+func (p *Paper) GetOrderHistory(market string) ([]Order, error) {
+	p.matchAll()
+	return p.filter(market, false), nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func (p *Paper) place(market, typ string, quantity, rate decimal.Decimal) (string, error) {
+	market = strings.ToUpper(market)
+	base, mkt, err := splitMarket(market)
+	if err != nil {
+		return "", err
+	}
+
+	q := quantity.Round(8)
+	r := rate.Round(8)
+	if q.Sign() <= 0 {
+		return "", ErrInvalidQuantity
+	}
+	if r.Sign() <= 0 {
+		return "", ErrInvalidRate
+	}
+
+	// Fetch the price before taking the lock, the feed may hit the network.
+	t, err := p.MarketData.GetTicker(market)
+	if err != nil {
+		return "", err
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	o := &paperOrder{
+		Order: Order{
+			UUID:              string(types.NewUUID()),
+			Market:            market,
+			Type:              typ,
+			Quantity:          q,
+			QuantityRemaining: q,
+			Limit:             r,
+			Opened:            time.Now(),
+			IsOpen:            true,
+		},
+	}
+
+	// Hold the funds required to fill the order (including fees for buys).
+	var held *paperBalance
+	if typ == OrderTypeLimitBuy {
+		held = p.balance(base)
+		o.reserved = q.Mul(r).Mul(decimal.New(1, 0).Add(p.fee)).Round(8)
+	} else {
+		held = p.balance(mkt)
+		o.reserved = q
+	}
+	if held.available.LessThan(o.reserved) {
+		return "", ErrInsufficientFunds
+	}
+	held.available = held.available.Sub(o.reserved)
+
+	p.orders[o.UUID] = o
+	p.match(market, t)
+	return o.UUID, nil
+}
+
+// match fills any open orders in `market` that cross the ticker `t`.  Buys
+// fill at the ask and sells at the bid, less slippage.  Must be called with
+// the lock held.
+func (p *Paper) match(market string, t Ticker) {
+	one := decimal.New(1, 0)
+	for _, o := range p.orders {
+		if !o.IsOpen || o.Market != market {
+			continue
+		}
+
+		switch o.Type {
+		case OrderTypeLimitBuy:
+			if t.Ask.Sign() > 0 && t.Ask.LessThanOrEqual(o.Limit) {
+				price := t.Ask.Mul(one.Add(p.slippage)).Round(8)
+				p.fill(o, decimal.Min(price, o.Limit))
+			}
+		case OrderTypeLimitSell:
+			if t.Bid.Sign() > 0 && t.Bid.GreaterThanOrEqual(o.Limit) {
+				price := t.Bid.Mul(one.Sub(p.slippage)).Round(8)
+				p.fill(o, decimal.Max(price, o.Limit))
+			}
+		}
+	}
+}
+
+// fill completes the order `o` at `price`, moving funds between balances.
+// Must be called with the lock held.
+func (p *Paper) fill(o *paperOrder, price decimal.Decimal) {
+	base, mkt, _ := splitMarket(o.Market)
+	qty := o.QuantityRemaining
+	cost := qty.Mul(price).Round(8)
+	commission := cost.Mul(p.fee).Round(8)
+
+	bb, mb := p.balance(base), p.balance(mkt)
+	switch o.Type {
+	case OrderTypeLimitBuy:
+		spent := cost.Add(commission)
+		bb.total = bb.total.Sub(spent)
+		bb.available = bb.available.Add(o.reserved).Sub(spent)
+		mb.total = mb.total.Add(qty)
+		mb.available = mb.available.Add(qty)
+	case OrderTypeLimitSell:
+		mb.total = mb.total.Sub(qty)
+		got := cost.Sub(commission)
+		bb.total = bb.total.Add(got)
+		bb.available = bb.available.Add(got)
+	}
+
+	o.reserved = decimal.Zero
+	o.QuantityRemaining = decimal.Zero
+	o.Price = o.Price.Add(cost)
+	o.PricePerUnit = price
+	o.CommissionPaid = o.CommissionPaid.Add(commission)
+	o.IsOpen = false
+	o.Closed = time.Now()
+}
+
+// matchAll refreshes the ticker for every market with an open order.
+func (p *Paper) matchAll() {
+	markets := map[string]struct{}{}
+	p.Lock()
+	for _, o := range p.orders {
+		if o.IsOpen {
+			markets[o.Market] = struct{}{}
+		}
+	}
+	p.Unlock()
+
+	for m := range markets {
+		p.GetTicker(m)
+	}
+}
+
+func (p *Paper) filter(market string, open bool) []Order {
+	p.Lock()
+	defer p.Unlock()
+
+	all := strings.EqualFold(market, AllMarkets)
+	ret := []Order{}
+	for _, o := range p.orders {
+		if o.IsOpen != open || (!all && !strings.EqualFold(o.Market, market)) {
+			continue
+		}
+		ret = append(ret, o.Order)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Opened.Before(ret[j].Opened) })
+	return ret
+}
+
+// balance returns the balance for `currency`, creating an empty one if needed.
+// Must be called with the lock held.
+func (p *Paper) balance(currency string) *paperBalance {
+	b, ok := p.balances[currency]
+	if !ok {
+		b = &paperBalance{}
+		p.balances[currency] = b
+	}
+	return b
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// splitMarket splits a market name (ex: "BTC-PIVX") into its base and market
+// currencies.
+func splitMarket(market string) (string, string, error) {
+	parts := strings.SplitN(strings.ToUpper(market), "-", 2)
+	if len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+		return "", "", errUnknownMarket
+	}
+	return parts[0], parts[1], nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
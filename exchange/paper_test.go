@@ -0,0 +1,220 @@
+package exchange
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// stubFeed is a price feed with tickers set by the test.  Calls it does not
+// implement panic.
+type stubFeed struct {
+	MarketData
+	tickers map[string]Ticker
+}
+
+func (f *stubFeed) GetTicker(market string) (Ticker, error) {
+	t, ok := f.tickers[strings.ToUpper(market)]
+	if !ok {
+		return Ticker{}, errUnknownMarket
+	}
+	return t, nil
+}
+
+func dec(s string) decimal.Decimal {
+	d, err := decimal.NewFromString(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// newTestPaper returns a paper exchange holding 1 BTC and 100 PIVX, charging
+// a 0.25% fee with 0.1% slippage, and quoting BTC-PIVX at 0.00099 / 0.001.
+func newTestPaper() (*Paper, *stubFeed) {
+	feed := &stubFeed{tickers: map[string]Ticker{
+		"BTC-PIVX": {Bid: dec("0.00099"), Ask: dec("0.001"), Last: dec("0.001")},
+	}}
+	p := NewPaper(feed, map[string]decimal.Decimal{"BTC": dec("1"), "pivx": dec("100")}, dec("0.0025"), dec("0.001"))
+	return p, feed
+}
+
+// checkBalance fails `t` unless the paper balance of `currency` is `total`
+// with `available` available.
+func checkBalance(t *testing.T, p *Paper, currency, total, available string) {
+	t.Helper()
+	bs, err := p.GetBalances()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	for _, b := range bs {
+		if b.Currency != currency {
+			continue
+		}
+		if !b.Balance.Equal(dec(total)) || !b.Available.Equal(dec(available)) {
+			t.Fatalf("%s: expected %s (%s available), got %s (%s available)", currency, total, available, b.Balance, b.Available)
+		}
+		return
+	}
+	t.Fatalf("%s: no balance", currency)
+}
+
+// checkFill fails `t` unless the order `uuid` has filled at `price` with the
+// commission `commission`.
+func checkFill(t *testing.T, p *Paper, uuid, price, commission string) {
+	t.Helper()
+	o, err := p.GetOrder(uuid)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if o.IsOpen || o.QuantityRemaining.Sign() != 0 {
+		t.Fatalf("expected order %s to be filled, %s remains", uuid, o.QuantityRemaining)
+	}
+	if !o.PricePerUnit.Equal(dec(price)) || !o.CommissionPaid.Equal(dec(commission)) {
+		t.Fatalf("expected a fill @ %s (fee %s), got %s (fee %s)", price, commission, o.PricePerUnit, o.CommissionPaid)
+	}
+	if want := o.Quantity.Mul(o.PricePerUnit).Round(8); !o.Price.Equal(want) {
+		t.Fatalf("expected a total price of %s, got %s", want, o.Price)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func TestPaperFills(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		typ        string
+		limit      string
+		price      string // fill price
+		commission string
+		btc        string // resulting BTC balance
+		pivx       string // resulting PIVX balance
+	}{
+		// Buys fill at the ask plus slippage: 10 x 0.001001 = 0.01001 BTC.
+		{"buy at the ask", OrderTypeLimitBuy, "0.0011", "0.001001", "0.00002503", "0.98996497", "110"},
+		// Slippage never fills worse than the limit: 10 x 0.0010005 = 0.010005 BTC.
+		{"buy capped at the limit", OrderTypeLimitBuy, "0.0010005", "0.0010005", "0.00002501", "0.98996999", "110"},
+		// Sells fill at the bid less slippage: 10 x 0.00098901 = 0.0098901 BTC.
+		{"sell at the bid", OrderTypeLimitSell, "0.00098", "0.00098901", "0.00002473", "1.00986537", "90"},
+		// 10 x 0.0009895 = 0.009895 BTC.
+		{"sell capped at the limit", OrderTypeLimitSell, "0.0009895", "0.0009895", "0.00002474", "1.00987026", "90"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p, _ := newTestPaper()
+			place := p.SellLimit
+			if tc.typ == OrderTypeLimitBuy {
+				place = p.BuyLimit
+			}
+
+			uuid, err := place("btc-pivx", dec("10"), dec(tc.limit))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err.Error())
+			}
+			checkFill(t, p, uuid, tc.price, tc.commission)
+			checkBalance(t, p, "BTC", tc.btc, tc.btc)
+			checkBalance(t, p, "PIVX", tc.pivx, tc.pivx)
+		})
+	}
+}
+
+func TestPaperRestingBuy(t *testing.T) {
+	p, feed := newTestPaper()
+
+	// The order rests below the ask, holding 10 x 0.0009 plus the fee.
+	uuid, err := p.BuyLimit("BTC-PIVX", dec("10"), dec("0.0009"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	checkBalance(t, p, "BTC", "1", "0.9909775")
+	if open, _ := p.GetOpenOrders("BTC-PIVX"); len(open) != 1 || open[0].UUID != uuid {
+		t.Fatalf("expected the order to be open, got %#v", open)
+	}
+
+	// Orders can not spend funds held by others.
+	if _, err := p.BuyLimit("BTC-PIVX", dec("1100"), dec("0.0009")); err != ErrInsufficientFunds {
+		t.Fatalf("expected ErrInsufficientFunds, got %v", err)
+	}
+
+	// Once the ask drops to the limit it fills at 10 x 0.00089089 (with
+	// slippage) and the rest of the held funds are released.
+	feed.tickers["BTC-PIVX"] = Ticker{Bid: dec("0.00088"), Ask: dec("0.00089"), Last: dec("0.00089")}
+	checkFill(t, p, uuid, "0.00089089", "0.00002227")
+	checkBalance(t, p, "BTC", "0.99106883", "0.99106883")
+	checkBalance(t, p, "PIVX", "110", "110")
+
+	if open, _ := p.GetOpenOrders(AllMarkets); len(open) != 0 {
+		t.Fatalf("expected no open orders, got %d", len(open))
+	}
+	if hist, _ := p.GetOrderHistory("BTC-PIVX"); len(hist) != 1 || hist[0].UUID != uuid {
+		t.Fatalf("expected the order in the history, got %#v", hist)
+	}
+}
+
+func TestPaperCancel(t *testing.T) {
+	p, _ := newTestPaper()
+
+	buy, err := p.BuyLimit("BTC-PIVX", dec("10"), dec("0.0009"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	sell, err := p.SellLimit("BTC-PIVX", dec("60"), dec("0.002"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	checkBalance(t, p, "PIVX", "100", "40")
+	if _, err := p.SellLimit("BTC-PIVX", dec("41"), dec("0.002")); err != ErrInsufficientFunds {
+		t.Fatalf("expected ErrInsufficientFunds, got %v", err)
+	}
+
+	// Cancelling refunds the held funds in full.
+	for _, uuid := range []string{buy, sell} {
+		if err := p.CancelOrder(uuid); err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+		o, err := p.GetOrder(uuid)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+		if o.IsOpen || !o.CancelInitiated || o.QuantityRemaining.Sign() <= 0 {
+			t.Fatalf("expected order %s to be cancelled unfilled, got %#v", uuid, o)
+		}
+	}
+	checkBalance(t, p, "BTC", "1", "1")
+	checkBalance(t, p, "PIVX", "100", "100")
+
+	if err := p.CancelOrder(buy); err != ErrOrderNotOpen {
+		t.Fatalf("expected ErrOrderNotOpen, got %v", err)
+	}
+	if err := p.CancelOrder("NOPE"); err != ErrInvalidOrder {
+		t.Fatalf("expected ErrInvalidOrder, got %v", err)
+	}
+}
+
+func TestPaperInvalidOrders(t *testing.T) {
+	p, _ := newTestPaper()
+	for _, tc := range []struct {
+		market   string
+		quantity string
+		rate     string
+		err      error
+	}{
+		{"BTC-PIVX", "0", "0.001", ErrInvalidQuantity},
+		{"BTC-PIVX", "0.000000001", "0.001", ErrInvalidQuantity}, // rounds to zero
+		{"BTC-PIVX", "10", "-0.001", ErrInvalidRate},
+		{"PIVX", "10", "0.001", errUnknownMarket},
+		{"BTC-NOPE", "10", "0.001", errUnknownMarket},
+		{"BTC-PIVX", "101", "0.002", ErrInsufficientFunds},
+	} {
+		if _, err := p.SellLimit(tc.market, dec(tc.quantity), dec(tc.rate)); err != tc.err {
+			t.Fatalf("%s %s @ %s: expected %v, got %v", tc.market, tc.quantity, tc.rate, tc.err, err)
+		}
+	}
+	checkBalance(t, p, "PIVX", "100", "100")
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,151 @@
+package expr
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"github.com/shopspring/decimal"
+
+	"github.com/sabhiram/trade-bot/indicator"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// evaluator evaluates a single expression, caching indicator values so that
+// they are only fetched once per evaluation.
+type evaluator struct {
+	vars   map[string]interface{}
+	market Market
+	values map[string]indicator.Values // keyed by spec
+}
+
+func (ev *evaluator) eval(n node) (interface{}, error) {
+	switch n := n.(type) {
+	case *numberNode:
+		return n.val, nil
+	case *boolNode:
+		return n.val, nil
+
+	case *identNode:
+		if v, ok := ev.vars[n.name]; ok {
+			switch v := v.(type) {
+			case decimal.Decimal, bool:
+				return v, nil
+			case float64:
+				return decimal.NewFromFloat(v), nil
+			case int:
+				return decimal.New(int64(v), 0), nil
+			}
+			return nil, errorf(n.at, "%s is not a number or a bool", n.name)
+		}
+		if f, ok := functions[n.name]; ok && f.max == 0 {
+			return ev.call(n.at, n.name, nil)
+		}
+		return nil, errorf(n.at, "unknown variable %s", n.name)
+
+	case *unaryNode:
+		x, err := ev.eval(n.x)
+		if err != nil {
+			return nil, err
+		}
+		if n.op == "not" {
+			b, ok := x.(bool)
+			if !ok {
+				return nil, errorf(n.at, "\"not\" needs a bool")
+			}
+			return !b, nil
+		}
+		d, ok := x.(decimal.Decimal)
+		if !ok {
+			return nil, errorf(n.at, "\"-\" needs a number")
+		}
+		return d.Neg(), nil
+
+	case *binaryNode:
+		return ev.binary(n)
+
+	case *callNode:
+		return ev.call(n.at, n.name, n)
+	}
+	return nil, errorf(n.pos(), "unknown expression")
+}
+
+func (ev *evaluator) binary(n *binaryNode) (interface{}, error) {
+	l, err := ev.eval(n.l)
+	if err != nil {
+		return nil, err
+	}
+
+	// and / or short circuit.
+	if n.op == "and" || n.op == "or" {
+		lb, ok := l.(bool)
+		if !ok {
+			return nil, errorf(n.at, "%q needs bools", n.op)
+		}
+		if (n.op == "and" && !lb) || (n.op == "or" && lb) {
+			return lb, nil
+		}
+		r, err := ev.eval(n.r)
+		if err != nil {
+			return nil, err
+		}
+		rb, ok := r.(bool)
+		if !ok {
+			return nil, errorf(n.at, "%q needs bools", n.op)
+		}
+		return rb, nil
+	}
+
+	r, err := ev.eval(n.r)
+	if err != nil {
+		return nil, err
+	}
+
+	if lb, ok := l.(bool); ok {
+		rb, ok := r.(bool)
+		if !ok {
+			return nil, errorf(n.at, "cannot compare a bool with a number")
+		}
+		switch n.op {
+		case "==":
+			return lb == rb, nil
+		case "!=":
+			return lb != rb, nil
+		}
+		return nil, errorf(n.at, "%q needs numbers", n.op)
+	}
+
+	ld, lok := l.(decimal.Decimal)
+	rd, rok := r.(decimal.Decimal)
+	if !lok || !rok {
+		return nil, errorf(n.at, "%q needs numbers", n.op)
+	}
+
+	switch n.op {
+	case "+":
+		return ld.Add(rd), nil
+	case "-":
+		return ld.Sub(rd), nil
+	case "*":
+		return ld.Mul(rd), nil
+	case "/":
+		if rd.Sign() == 0 {
+			return nil, &Error{Pos: n.at, Msg: ErrDivisionByZero.Error(), Cause: ErrDivisionByZero}
+		}
+		return ld.Div(rd), nil
+	case "<":
+		return ld.LessThan(rd), nil
+	case "<=":
+		return ld.LessThanOrEqual(rd), nil
+	case ">":
+		return ld.GreaterThan(rd), nil
+	case ">=":
+		return ld.GreaterThanOrEqual(rd), nil
+	case "==":
+		return ld.Equal(rd), nil
+	case "!=":
+		return !ld.Equal(rd), nil
+	}
+	return nil, errorf(n.at, "unknown operator %q", n.op)
+}
+
+////////////////////////////////////////////////////////////////////////////////
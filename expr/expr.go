@@ -0,0 +1,262 @@
+// Package expr implements the condition language used by trades.  Expressions
+// are parsed once, type checked against the variables a trade provides and
+// evaluated with decimal arithmetic to a bool:
+//
+//	last <= StopPrice and rsi(14) < 30
+//	TargetFilled or pct_change(12) <= -5
+//
+// Numbers support + - * /, comparisons (< <= > >= == !=) yield bools which
+// combine with and, or and not (or &&, || and !).  Market data is available
+// through functions, see Functions.
+package expr
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sabhiram/trade-bot/indicator"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Type is the type of a value in an expression.
+type Type int
+
+const (
+	Invalid Type = iota
+	Number
+	Bool
+)
+
+func (t Type) String() string {
+	switch t {
+	case Number:
+		return "number"
+	case Bool:
+		return "bool"
+	}
+	return "invalid"
+}
+
+// TypeOf returns the expression type of the Go value `v`.
+func TypeOf(v interface{}) Type {
+	switch v.(type) {
+	case decimal.Decimal, float64, int:
+		return Number
+	case bool:
+		return Bool
+	}
+	return Invalid
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Market provides the market data used by the expression's functions.
+type Market interface {
+	Last() decimal.Decimal
+	Bid() decimal.Decimal
+	Ask() decimal.Decimal
+
+	// Indicator returns the current value of the indicator `spec`, in the
+	// canonical form returned by indicator.Canonical (ex: "sma(20)").
+	Indicator(spec string) (indicator.Values, error)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Expr is a parsed expression.  It is immutable and safe for concurrent use.
+type Expr struct {
+	src  string
+	root node
+}
+
+// Parse parses the expression `src`.
+func Parse(src string) (*Expr, error) {
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{toks: toks}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, errorf(t.pos, "unexpected %s", t)
+	}
+	return &Expr{src: src, root: root}, nil
+}
+
+// MustParse is like Parse but panics on error.
+func MustParse(src string) *Expr {
+	e, err := Parse(src)
+	if err != nil {
+		panic(fmt.Sprintf("expr: %q: %s", src, err.Error()))
+	}
+	return e
+}
+
+// String returns the source of the expression.
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Vars returns the sorted names of the variables the expression references.
+// Identifiers that name a function taking no arguments (ex: last) are not
+// variables unless a variable of that name is declared when checking.
+func (e *Expr) Vars() []string {
+	seen := map[string]bool{}
+	walk(e.root, func(n node) {
+		if id, ok := n.(*identNode); ok {
+			seen[id.name] = true
+		}
+	})
+
+	ns := []string{}
+	for n := range seen {
+		ns = append(ns, n)
+	}
+	sort.Strings(ns)
+	return ns
+}
+
+// Check verifies that the expression is well typed given the types of the
+// variables in `vars` and that it evaluates to a bool.
+func (e *Expr) Check(vars map[string]Type) error {
+	t, err := check(e.root, vars)
+	if err != nil {
+		return err
+	}
+	if t != Bool {
+		return errorf(e.root.pos(), "expression is a %s, it must be a bool (ex: a comparison)", t)
+	}
+	return nil
+}
+
+// Eval evaluates the expression with the variables in `vars` (numbers as
+// decimal.Decimal or float64, and bools) and the market data `m`.  The
+// expression should have been checked against the same variables.
+func (e *Expr) Eval(vars map[string]interface{}, m Market) (bool, error) {
+	ev := &evaluator{vars: vars, market: m, values: map[string]indicator.Values{}}
+	v, err := ev.eval(e.root)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, errorf(e.root.pos(), "expression is a %s, it must be a bool", TypeOf(v))
+	}
+	return b, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func walk(n node, fn func(node)) {
+	fn(n)
+	switch n := n.(type) {
+	case *unaryNode:
+		walk(n.x, fn)
+	case *binaryNode:
+		walk(n.l, fn)
+		walk(n.r, fn)
+	case *callNode:
+		for _, a := range n.args {
+			walk(a, fn)
+		}
+	}
+}
+
+// check returns the type of `n`.
+func check(n node, vars map[string]Type) (Type, error) {
+	switch n := n.(type) {
+	case *numberNode:
+		return Number, nil
+	case *boolNode:
+		return Bool, nil
+
+	case *identNode:
+		if t, ok := vars[n.name]; ok {
+			if t != Number && t != Bool {
+				return Invalid, errorf(n.at, "%s is not a number or a bool", n.name)
+			}
+			return t, nil
+		}
+		if f, ok := functions[n.name]; ok && f.max == 0 {
+			return Number, nil
+		}
+		return Invalid, errorf(n.at, "unknown variable %s (have: %s)", n.name, strings.Join(declared(vars), ", "))
+
+	case *unaryNode:
+		t, err := check(n.x, vars)
+		if err != nil {
+			return Invalid, err
+		}
+		want := Number
+		if n.op == "not" {
+			want = Bool
+		}
+		if t != want {
+			return Invalid, errorf(n.at, "%q needs a %s, got a %s", n.op, want, t)
+		}
+		return want, nil
+
+	case *binaryNode:
+		lt, err := check(n.l, vars)
+		if err != nil {
+			return Invalid, err
+		}
+		rt, err := check(n.r, vars)
+		if err != nil {
+			return Invalid, err
+		}
+
+		switch n.op {
+		case "and", "or":
+			if lt != Bool || rt != Bool {
+				return Invalid, errorf(n.at, "%q needs bools, got a %s and a %s", n.op, lt, rt)
+			}
+			return Bool, nil
+		case "==", "!=":
+			if lt != rt {
+				return Invalid, errorf(n.at, "cannot compare a %s with a %s", lt, rt)
+			}
+			return Bool, nil
+		case "<", "<=", ">", ">=":
+			if lt != Number || rt != Number {
+				return Invalid, errorf(n.at, "%q needs numbers, got a %s and a %s", n.op, lt, rt)
+			}
+			return Bool, nil
+		default:
+			if lt != Number || rt != Number {
+				return Invalid, errorf(n.at, "%q needs numbers, got a %s and a %s", n.op, lt, rt)
+			}
+			return Number, nil
+		}
+
+	case *callNode:
+		if err := checkCall(n); err != nil {
+			return Invalid, err
+		}
+		return Number, nil
+	}
+	return Invalid, errorf(n.pos(), "unknown expression")
+}
+
+func declared(vars map[string]Type) []string {
+	ns := []string{}
+	for n, t := range vars {
+		if t == Number || t == Bool {
+			ns = append(ns, n)
+		}
+	}
+	sort.Strings(ns)
+	return ns
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,266 @@
+package expr
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sabhiram/trade-bot/indicator"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// stubMarket is a Market with fixed prices and indicator values.
+type stubMarket struct {
+	last, bid, ask decimal.Decimal
+	values         map[string]indicator.Values // keyed by spec
+	err            error                       // returned by Indicator if set
+	calls          int                         // calls to Indicator
+}
+
+func (m *stubMarket) Last() decimal.Decimal { return m.last }
+func (m *stubMarket) Bid() decimal.Decimal  { return m.bid }
+func (m *stubMarket) Ask() decimal.Decimal  { return m.ask }
+
+func (m *stubMarket) Indicator(spec string) (indicator.Values, error) {
+	m.calls++
+	if m.err != nil {
+		return nil, m.err
+	}
+	vs, ok := m.values[spec]
+	if !ok {
+		return nil, errors.New("no values for " + spec)
+	}
+	return vs, nil
+}
+
+func dec(s string) decimal.Decimal {
+	d, err := decimal.NewFromString(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func newStubMarket() *stubMarket {
+	return &stubMarket{
+		last: dec("0.00100000"),
+		bid:  dec("0.00099"),
+		ask:  dec("0.00101"),
+		values: map[string]indicator.Values{
+			"sma(20)": {indicator.Value: dec("0.0009")},
+			"rsi(14)": {indicator.Value: dec("25")},
+			"vwap":    {indicator.Value: dec("0.001")},
+			"macd(12,26,9)": {
+				indicator.MACDLine:  dec("0.5"),
+				indicator.Signal:    dec("0.25"),
+				indicator.Histogram: dec("0.25"),
+			},
+		},
+	}
+}
+
+// checkError fails `t` unless `err` is an *Error at column `pos` whose message
+// contains `msg`.
+func checkError(t *testing.T, err error, pos int, msg string) {
+	t.Helper()
+	e, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("expected an *Error, got %#v", err)
+	}
+	if e.Pos != pos || !strings.Contains(e.Msg, msg) {
+		t.Fatalf("expected %q at col %d, got %q at col %d", msg, pos, e.Msg, e.Pos)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func TestParseErrors(t *testing.T) {
+	for _, tc := range []struct {
+		src string
+		pos int
+		msg string
+	}{
+		{"last >", 7, "unexpected end of expression"},
+		{"last $ 1", 6, "unexpected character '$'"},
+		{"(last > 1", 10, `expected ")"`},
+		{"sma(20 1) > 1", 8, `expected "," or ")", found "1"`},
+		{"1 < 2 < 3", 7, "comparisons cannot be chained"},
+		{"last > 1 2", 10, `unexpected "2"`},
+		{"last > and", 8, `unexpected "and"`},
+		{"", 1, "unexpected end of expression"},
+	} {
+		t.Run(tc.src, func(t *testing.T) {
+			_, err := Parse(tc.src)
+			checkError(t, err, tc.pos, tc.msg)
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	vars := map[string]Type{
+		"StopPrice":    Number,
+		"TargetFilled": Bool,
+		"Name":         TypeOf("PIVX"), // string inputs are not usable
+	}
+
+	for _, tc := range []struct {
+		src string
+		pos int // 0 if the expression is well typed
+		msg string
+	}{
+		{"last <= StopPrice", 0, ""},
+		{"TargetFilled or last <= StopPrice and not (rsi(14) > 70)", 0, ""},
+		{"TargetFilled == false", 0, ""},
+		{"sma() > vwap", 0, ""},
+		{"StopPrice", 1, "expression is a number"},
+		{"last <= Stop", 9, "unknown variable Stop"},
+		{"Name == 1", 1, "Name is not a number or a bool"},
+		{"TargetFilled + 1 > 2", 14, `"+" needs numbers, got a bool and a number`},
+		{"TargetFilled == 1", 14, "cannot compare a bool with a number"},
+		{"last and true", 6, `"and" needs bools`},
+		{"not last", 1, `"not" needs a bool, got a number`},
+		{"-TargetFilled", 1, `"-" needs a number, got a bool`},
+		{"sma(StopPrice) > 1", 5, "sma: arguments must be numbers"},
+		{"sma(1, 2) > 1", 1, "sma takes at most 1 argument(s), got 2"},
+		{"sma(2.5) > 1", 1, "sma: period must be a whole number"},
+		{"foo(1) > 1", 1, "unknown function foo"},
+	} {
+		t.Run(tc.src, func(t *testing.T) {
+			err := MustParse(tc.src).Check(vars)
+			if tc.pos == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err.Error())
+				}
+				return
+			}
+			checkError(t, err, tc.pos, tc.msg)
+		})
+	}
+}
+
+func TestEval(t *testing.T) {
+	vars := map[string]interface{}{
+		"SellLimit":    dec("0.001"),
+		"StopPrice":    dec("0.00095"),
+		"TargetFilled": false,
+		"Half":         0.5,
+		"Two":          2,
+	}
+
+	for _, tc := range []struct {
+		src  string
+		want bool
+	}{
+		// Precedence and associativity.
+		{"1 + 2 * 3 == 7", true},
+		{"(1 + 2) * 3 == 9", true},
+		{"10 - 4 - 3 == 3", true},
+		{"12 / 2 / 3 == 2", true},
+		{"-2 * -3 == 6", true},
+		{"true or false and false", true},
+		{"(true or false) and false", false},
+		{"not false and false", false},
+		{"not 1 > 2", true},
+		{"! (1 > 2) && 1 < 2 || false", true},
+		{"1 < 2 AND 2 < 3", true},
+
+		// Decimal arithmetic and comparisons.
+		{"0.1 + 0.2 == 0.3", true},
+		{"last >= SellLimit", true},
+		{"last > SellLimit", false},
+		{"last == 0.001", true},
+		{"last <= StopPrice", false},
+		{"bid < last and last < ask", true},
+		{"Half * Two == 1", true},
+
+		// Variables shadow the market data functions.
+		{"TargetFilled or last <= StopPrice", false},
+		{"TargetFilled == false", true},
+
+		// Indicators.
+		{"sma(20) < last", true},
+		{"sma() < last", true},
+		{"vwap < ask", true},
+		{"rsi(14) < 30", true},
+		{"macd_hist(12, 26, 9) == macd(12, 26, 9) - macd_signal(12, 26, 9)", true},
+	} {
+		t.Run(tc.src, func(t *testing.T) {
+			e := MustParse(tc.src)
+			got, err := e.Eval(vars, newStubMarket())
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err.Error())
+			}
+			if got != tc.want {
+				t.Fatalf("expected %t, got %t", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestEvalShortCircuit(t *testing.T) {
+	m := newStubMarket()
+	m.err = errors.New("not enough candles")
+
+	for _, src := range []string{"false and sma(20) > 1", "true or sma(20) > 1"} {
+		if _, err := MustParse(src).Eval(nil, m); err != nil {
+			t.Fatalf("%q: unexpected error: %s", src, err.Error())
+		}
+	}
+	if m.calls != 0 {
+		t.Fatalf("expected no indicator calls, got %d", m.calls)
+	}
+}
+
+func TestEvalCachesIndicators(t *testing.T) {
+	m := newStubMarket()
+	ok, err := MustParse("sma(20) > 0 and sma(20) < 1 and sma() > 0").Eval(nil, m)
+	if err != nil || !ok {
+		t.Fatalf("expected true, got %t (%v)", ok, err)
+	}
+	if m.calls != 1 {
+		t.Fatalf("expected 1 indicator call, got %d", m.calls)
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	candles := errors.New("not enough candles")
+	for _, tc := range []struct {
+		src   string
+		vars  map[string]interface{}
+		err   error // market error
+		pos   int
+		msg   string
+		cause error // nil if evaluating again can not succeed
+	}{
+		{"(last - sma(20)) / (ask - bid) > 1", map[string]interface{}{}, nil, 18, "division by zero", ErrDivisionByZero},
+		{"rsi(14) < 30", nil, candles, 1, "not enough candles", candles},
+		{"Missing > 1", nil, nil, 1, "unknown variable Missing", nil},
+		{"Name > 1", map[string]interface{}{"Name": "PIVX"}, nil, 1, "Name is not a number or a bool", nil},
+	} {
+		t.Run(tc.src, func(t *testing.T) {
+			m := newStubMarket()
+			m.bid, m.ask = m.last, m.last // a locked book
+			m.err = tc.err
+
+			_, err := MustParse(tc.src).Eval(tc.vars, m)
+			checkError(t, err, tc.pos, tc.msg)
+			if c := err.(*Error).Cause; c != tc.cause {
+				t.Fatalf("expected cause %v, got %v", tc.cause, c)
+			}
+		})
+	}
+}
+
+func TestVars(t *testing.T) {
+	got := strings.Join(MustParse("TargetFilled or last <= StopPrice and sma(20) > StopPrice").Vars(), ",")
+	if want := "StopPrice,TargetFilled,last"; got != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,147 @@
+package expr
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sabhiram/trade-bot/indicator"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// function is a builtin function.  Functions either return a price from the
+// ticker, or an output of an indicator (see package indicator) in which case
+// the arguments are the indicator's and must be number literals.
+type function struct {
+	max  int // maximum number of arguments
+	desc string
+
+	price     func(m Market) decimal.Decimal
+	indicator string
+	output    string
+}
+
+func indicatorFn(name, output, desc string, max int) function {
+	return function{max: max, desc: desc, indicator: name, output: output}
+}
+
+var functions = map[string]function{
+	"last": {desc: "last trade price", price: Market.Last},
+	"bid":  {desc: "best bid", price: Market.Bid},
+	"ask":  {desc: "best ask", price: Market.Ask},
+
+	"sma":         indicatorFn("sma", indicator.Value, "simple moving average of the last n closes", 1),
+	"ema":         indicatorFn("ema", indicator.Value, "exponential moving average of the closes with period n", 1),
+	"rsi":         indicatorFn("rsi", indicator.Value, "relative strength index (0-100) with period n", 1),
+	"atr":         indicatorFn("atr", indicator.Value, "average true range with period n", 1),
+	"vwap":        indicatorFn("vwap", indicator.Value, "volume weighted average price of the day (UTC)", 0),
+	"pct_change":  indicatorFn("roc", indicator.Value, "percent change of the latest close from the close n candles earlier", 1),
+	"macd":        indicatorFn("macd", indicator.MACDLine, "macd line (fast, slow, signal periods)", 3),
+	"macd_signal": indicatorFn("macd", indicator.Signal, "macd signal line (fast, slow, signal periods)", 3),
+	"macd_hist":   indicatorFn("macd", indicator.Histogram, "macd histogram (fast, slow, signal periods)", 3),
+	"bb_upper":    indicatorFn("bb", indicator.Upper, "upper bollinger band (period, standard deviations)", 2),
+	"bb_middle":   indicatorFn("bb", indicator.Middle, "middle bollinger band (period, standard deviations)", 2),
+	"bb_lower":    indicatorFn("bb", indicator.Lower, "lower bollinger band (period, standard deviations)", 2),
+}
+
+// Functions returns a short description of each builtin function keyed by its
+// name.
+func Functions() map[string]string {
+	ret := map[string]string{}
+	for name, f := range functions {
+		ret[name] = f.desc
+	}
+	return ret
+}
+
+// FunctionNames returns the sorted names of the builtin functions.
+func FunctionNames() []string {
+	ns := []string{}
+	for n := range functions {
+		ns = append(ns, n)
+	}
+	sort.Strings(ns)
+	return ns
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// spec returns the indicator spec for the call `n` of the indicator function
+// `f`, missing arguments take the indicator's defaults.
+func (f function) spec(n *callNode) (string, error) {
+	args := []decimal.Decimal{}
+	for _, a := range n.args {
+		num, ok := a.(*numberNode)
+		if !ok {
+			return "", errorf(a.pos(), "%s: arguments must be numbers", n.name)
+		}
+		args = append(args, num.val)
+	}
+
+	s, err := indicator.Canonical(f.indicator, args)
+	if err != nil {
+		// Report errors in terms of the function rather than the indicator.
+		msg := err.Error()
+		if i := strings.Index(msg, ": "); i >= 0 {
+			msg = msg[i+2:]
+		}
+		return "", errorf(n.at, "%s: %s", n.name, msg)
+	}
+	return s, nil
+}
+
+// checkCall validates the call `n`.
+func checkCall(n *callNode) error {
+	f, ok := functions[n.name]
+	if !ok {
+		return errorf(n.at, "unknown function %s (have: %s)", n.name, strings.Join(FunctionNames(), ", "))
+	}
+	if len(n.args) > f.max {
+		return errorf(n.at, "%s takes at most %d argument(s), got %d", n.name, f.max, len(n.args))
+	}
+	if f.price != nil {
+		return nil
+	}
+	_, err := f.spec(n)
+	return err
+}
+
+// call evaluates the builtin function `name` with the (literal) arguments of
+// `n`, which is nil for bare identifiers.
+func (ev *evaluator) call(pos int, name string, n *callNode) (decimal.Decimal, error) {
+	f, ok := functions[name]
+	if !ok {
+		return decimal.Zero, errorf(pos, "unknown function %s", name)
+	}
+	if f.price != nil {
+		return f.price(ev.market), nil
+	}
+
+	if n == nil {
+		n = &callNode{at: pos, name: name}
+	}
+	spec, err := f.spec(n)
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	vs, ok := ev.values[spec]
+	if !ok {
+		if vs, err = ev.market.Indicator(spec); err != nil {
+			return decimal.Zero, &Error{Pos: pos, Msg: err.Error(), Cause: err}
+		}
+		ev.values[spec] = vs
+	}
+
+	v, ok := vs[f.output]
+	if !ok {
+		return decimal.Zero, errorf(pos, "%s: %s has no %s output", name, spec, f.output)
+	}
+	return v, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,132 @@
+package expr
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"errors"
+	"fmt"
+	"unicode"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokIdent
+	tokOp     // + - * / < <= > >= == != && || !
+	tokLParen // (
+	tokRParen // )
+	tokComma  // ,
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int // 1 based column in the source
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of expression"
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// ErrDivisionByZero is the `Cause` of dividing by zero, which market data may
+// do for a moment (ex: "ask - bid" on a locked book).
+var ErrDivisionByZero = errors.New("division by zero")
+
+// Error is a parse, type or evaluation error.  `Pos` is the 1 based column
+// of the offending token in the expression, or 0 if not applicable.  `Cause`
+// is set when the market data could not be fetched (ex: not enough candles)
+// or divided by zero, in which case evaluating again later may succeed.
+type Error struct {
+	Pos   int
+	Msg   string
+	Cause error
+}
+
+func (e *Error) Error() string {
+	if e.Pos > 0 {
+		return fmt.Sprintf("col %d: %s", e.Pos, e.Msg)
+	}
+	return e.Msg
+}
+
+func errorf(pos int, format string, args ...interface{}) error {
+	return &Error{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// twoCharOps are the operators made of two characters.
+var twoCharOps = map[string]bool{
+	"<=": true, ">=": true, "==": true, "!=": true, "&&": true, "||": true,
+}
+
+// lex splits `src` into tokens.
+func lex(src string) ([]token, error) {
+	rs := []rune(src)
+	toks := []token{}
+
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		pos := i + 1
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+
+		case unicode.IsDigit(r) || (r == '.' && i+1 < len(rs) && unicode.IsDigit(rs[i+1])):
+			j := i
+			dot := false
+			for j < len(rs) && (unicode.IsDigit(rs[j]) || (rs[j] == '.' && !dot)) {
+				if rs[j] == '.' {
+					dot = true
+				}
+				j++
+			}
+			toks = append(toks, token{tokNumber, string(rs[i:j]), pos})
+			i = j
+
+		case unicode.IsLetter(r) || r == '_':
+			j := i
+			for j < len(rs) && (unicode.IsLetter(rs[j]) || unicode.IsDigit(rs[j]) || rs[j] == '_') {
+				j++
+			}
+			toks = append(toks, token{tokIdent, string(rs[i:j]), pos})
+			i = j
+
+		case r == '(':
+			toks = append(toks, token{tokLParen, "(", pos})
+			i++
+		case r == ')':
+			toks = append(toks, token{tokRParen, ")", pos})
+			i++
+		case r == ',':
+			toks = append(toks, token{tokComma, ",", pos})
+			i++
+
+		default:
+			if i+1 < len(rs) && twoCharOps[string(rs[i:i+2])] {
+				toks = append(toks, token{tokOp, string(rs[i : i+2]), pos})
+				i += 2
+				continue
+			}
+			switch r {
+			case '+', '-', '*', '/', '<', '>', '!':
+				toks = append(toks, token{tokOp, string(r), pos})
+				i++
+			default:
+				return nil, errorf(pos, "unexpected character %q", r)
+			}
+		}
+	}
+
+	return append(toks, token{tokEOF, "", len(rs) + 1}), nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
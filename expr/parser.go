@@ -0,0 +1,259 @@
+package expr
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// node is an element of the parsed expression tree.
+type node interface {
+	pos() int
+}
+
+type (
+	numberNode struct {
+		at  int
+		val decimal.Decimal
+	}
+	boolNode struct {
+		at  int
+		val bool
+	}
+	identNode struct {
+		at   int
+		name string
+	}
+	unaryNode struct {
+		at int
+		op string // "-" or "not"
+		x  node
+	}
+	binaryNode struct {
+		at   int
+		op   string // arithmetic, comparison, "and" or "or"
+		l, r node
+	}
+	callNode struct {
+		at   int
+		name string
+		args []node
+	}
+)
+
+func (n *numberNode) pos() int { return n.at }
+func (n *boolNode) pos() int   { return n.at }
+func (n *identNode) pos() int  { return n.at }
+func (n *unaryNode) pos() int  { return n.at }
+func (n *binaryNode) pos() int { return n.at }
+func (n *callNode) pos() int   { return n.at }
+
+////////////////////////////////////////////////////////////////////////////////
+
+// opAliases maps the symbolic boolean operators to their keyword form.
+var opAliases = map[string]string{
+	"&&": "and",
+	"||": "or",
+	"!":  "not",
+}
+
+// parser is a recursive descent parser, lowest precedence first:
+//
+//	or  := and ("or" and)*
+//	and := not ("and" not)*
+//	not := "not" not | cmp
+//	cmp := sum (("<" | "<=" | ">" | ">=" | "==" | "!=") sum)?
+//	sum := mul (("+" | "-") mul)*
+//	mul := neg (("*" | "/") neg)*
+//	neg := "-" neg | primary
+//	primary := number | "true" | "false" | ident | ident "(" args ")" | "(" or ")"
+type parser struct {
+	toks []token
+	i    int
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.i]
+}
+
+func (p *parser) next() token {
+	t := p.toks[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+// op returns the (normalized) operator of the next token if it is one of
+// `ops`, keywords such as "and" are treated as operators.
+func (p *parser) op(ops ...string) (string, bool) {
+	t := p.peek()
+	if t.kind != tokOp && t.kind != tokIdent {
+		return "", false
+	}
+
+	s := t.text
+	if t.kind == tokIdent {
+		s = strings.ToLower(s)
+	} else if a, ok := opAliases[s]; ok {
+		s = a
+	}
+	for _, o := range ops {
+		if s == o {
+			return s, true
+		}
+	}
+	return "", false
+}
+
+func (p *parser) parseOr() (node, error) {
+	return p.parseLeft(p.parseAnd, "or")
+}
+
+func (p *parser) parseAnd() (node, error) {
+	return p.parseLeft(p.parseNot, "and")
+}
+
+func (p *parser) parseNot() (node, error) {
+	if _, ok := p.op("not"); ok {
+		t := p.next()
+		x, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{at: t.pos, op: "not", x: x}, nil
+	}
+	return p.parseCmp()
+}
+
+func (p *parser) parseCmp() (node, error) {
+	l, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+
+	cmps := []string{"<", "<=", ">", ">=", "==", "!="}
+	op, ok := p.op(cmps...)
+	if !ok {
+		return l, nil
+	}
+	t := p.next()
+
+	r, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := p.op(cmps...); ok {
+		return nil, errorf(p.peek().pos, "comparisons cannot be chained, use \"and\"")
+	}
+	return &binaryNode{at: t.pos, op: op, l: l, r: r}, nil
+}
+
+func (p *parser) parseSum() (node, error) {
+	return p.parseLeft(p.parseMul, "+", "-")
+}
+
+func (p *parser) parseMul() (node, error) {
+	return p.parseLeft(p.parseNeg, "*", "/")
+}
+
+// parseLeft parses a left associative chain of `ops` between operands parsed
+// by `operand`.
+func (p *parser) parseLeft(operand func() (node, error), ops ...string) (node, error) {
+	l, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.op(ops...)
+		if !ok {
+			return l, nil
+		}
+		t := p.next()
+
+		r, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		l = &binaryNode{at: t.pos, op: op, l: l, r: r}
+	}
+}
+
+func (p *parser) parseNeg() (node, error) {
+	if _, ok := p.op("-"); ok {
+		t := p.next()
+		x, err := p.parseNeg()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{at: t.pos, op: "-", x: x}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		d, err := decimal.NewFromString(t.text)
+		if err != nil {
+			return nil, errorf(t.pos, "invalid number %q", t.text)
+		}
+		return &numberNode{at: t.pos, val: d}, nil
+
+	case tokLParen:
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if c := p.next(); c.kind != tokRParen {
+			return nil, errorf(c.pos, "expected \")\", found %s", c)
+		}
+		return x, nil
+
+	case tokIdent:
+		switch strings.ToLower(t.text) {
+		case "true":
+			return &boolNode{at: t.pos, val: true}, nil
+		case "false":
+			return &boolNode{at: t.pos, val: false}, nil
+		case "and", "or", "not":
+			return nil, errorf(t.pos, "unexpected %s", t)
+		}
+
+		if p.peek().kind != tokLParen {
+			return &identNode{at: t.pos, name: t.text}, nil
+		}
+		p.next()
+
+		args := []node{}
+		if p.peek().kind != tokRParen {
+			for {
+				a, err := p.parseOr()
+				if err != nil {
+					return nil, err
+				}
+				args = append(args, a)
+				if p.peek().kind != tokComma {
+					break
+				}
+				p.next()
+			}
+		}
+		if c := p.next(); c.kind != tokRParen {
+			return nil, errorf(c.pos, "expected \",\" or \")\", found %s", c)
+		}
+		return &callNode{at: t.pos, name: t.text, args: args}, nil
+	}
+
+	if t.kind == tokEOF {
+		return nil, errorf(t.pos, "unexpected end of expression")
+	}
+	return nil, errorf(t.pos, "unexpected %s", t)
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,317 @@
+package history
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sabhiram/trade-bot/types"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+const (
+	PeriodDay  = "day"
+	PeriodWeek = "week"
+)
+
+var (
+	hundred = decimal.New(100, 0)
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Holding is the quantity and value of a single currency in a snapshot.
+type Holding struct {
+	Currency  string
+	Quantity  decimal.Decimal
+	BTCValue  decimal.Decimal
+	USDTValue decimal.Decimal
+}
+
+// Snapshot is the portfolio at a point in time.
+type Snapshot struct {
+	TimeStamp time.Time
+	Holdings  []Holding
+	BTCValue  decimal.Decimal
+	USDTValue decimal.Decimal
+}
+
+// NewSnapshot returns the snapshot of the portfolio `p` taken at `ts`.
+func NewSnapshot(ts time.Time, p *types.Portfolio) Snapshot {
+	s := Snapshot{
+		TimeStamp: ts.UTC(),
+		Holdings:  make([]Holding, 0, len(p.Balances)),
+		BTCValue:  p.BTCValue,
+		USDTValue: p.USDTValue,
+	}
+	for _, b := range p.Balances {
+		s.Holdings = append(s.Holdings, Holding{
+			Currency:  b.Currency,
+			Quantity:  b.Total,
+			BTCValue:  b.BTCValue,
+			USDTValue: b.USDTValue,
+		})
+	}
+	return s
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Snapshots is a time series of portfolio snapshots persisted as one JSON
+// object per line, new snapshots are appended to the file.
+type Snapshots struct {
+	sync.Mutex // guards snaps
+
+	path  string
+	snaps []Snapshot // sorted by time
+}
+
+// NewSnapshots returns the snapshots stored at `path`, the file is created
+// when the first snapshot is added.
+func NewSnapshots(path string) (*Snapshots, error) {
+	s := &Snapshots{path: path, snaps: []Snapshot{}}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 1<<20)
+	for n := 1; sc.Scan(); n++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var snap Snapshot
+		if err := json.Unmarshal(sc.Bytes(), &snap); err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", path, n, err.Error())
+		}
+		s.snaps = append(s.snaps, snap)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(s.snaps, func(i, j int) bool { return s.snaps[i].TimeStamp.Before(s.snaps[j].TimeStamp) })
+	return s, nil
+}
+
+// Add appends the snapshot `snap` to the series.
+func (s *Snapshots) Add(snap Snapshot) error {
+	bs, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if n := len(s.snaps); n > 0 && snap.TimeStamp.Before(s.snaps[n-1].TimeStamp) {
+		return errors.New("snapshot is older than the latest one")
+	}
+
+	if dir := filepath.Dir(s.path); len(dir) > 0 {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(bs, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	s.snaps = append(s.snaps, snap)
+	return nil
+}
+
+// Range returns the snapshots from `from` to `to` inclusive, a zero time
+// leaves that end of the range open.
+func (s *Snapshots) Range(from, to time.Time) []Snapshot {
+	s.Lock()
+	defer s.Unlock()
+
+	ss := s.snaps
+	if !from.IsZero() {
+		i := sort.Search(len(ss), func(i int) bool { return !ss[i].TimeStamp.Before(from) })
+		ss = ss[i:]
+	}
+	if !to.IsZero() {
+		i := sort.Search(len(ss), func(i int) bool { return ss[i].TimeStamp.After(to) })
+		ss = ss[:i]
+	}
+	return append([]Snapshot{}, ss...)
+}
+
+// Latest returns the most recent snapshot, if any.
+func (s *Snapshots) Latest() (Snapshot, bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	if len(s.snaps) == 0 {
+		return Snapshot{}, false
+	}
+	return s.snaps[len(s.snaps)-1], true
+}
+
+// Opening returns the snapshot the `period` containing `t` is measured from,
+// the last snapshot of the previous period or else the period's first, if any.
+func (s *Snapshots) Opening(period string, t time.Time) (Snapshot, bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	start := periodStart(period, t)
+	i := sort.Search(len(s.snaps), func(i int) bool { return !s.snaps[i].TimeStamp.Before(start) })
+	switch {
+	case i > 0:
+		return s.snaps[i-1], true
+	case i < len(s.snaps) && s.snaps[i].TimeStamp.Before(start.AddDate(0, 0, 1)):
+		return s.snaps[i], true
+	}
+	return Snapshot{}, false
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Contribution is the change in value of a single currency over a period.
+type Contribution struct {
+	Currency      string
+	StartQuantity decimal.Decimal
+	EndQuantity   decimal.Decimal
+	PnL           decimal.Decimal // in BTC
+	PnLUSDT       decimal.Decimal
+	Percent       decimal.Decimal // of the portfolio's starting value
+}
+
+// Period is the change in value of the portfolio over a day or week.
+type Period struct {
+	From, To   time.Time // start of this period and of the next one
+	Start, End Snapshot  // snapshots the change is measured between
+
+	PnL        decimal.Decimal // in BTC
+	PnLUSDT    decimal.Decimal
+	PnLPercent decimal.Decimal // of the starting BTC value
+	Assets     []Contribution  // sorted by currency
+}
+
+// ValidatePeriod returns an error if `period` is not a known period.
+func ValidatePeriod(period string) error {
+	switch period {
+	case PeriodDay, PeriodWeek:
+		return nil
+	}
+	return fmt.Errorf("invalid period %q (want %s or %s)", period, PeriodDay, PeriodWeek)
+}
+
+// periodStart returns the start of the `period` (in UTC) which contains `t`,
+// weeks start on Monday.
+func periodStart(period string, t time.Time) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	if period == PeriodWeek {
+		day = day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	}
+	return day
+}
+
+// PnL splits the snapshots `ss` (sorted by time) into days or weeks and
+// returns the change in value over each one.  A period is measured from the
+// last snapshot of the previous period (or its own first snapshot) to its last
+// snapshot.  Deposits and withdrawals count towards the change.
+func PnL(ss []Snapshot, period string) ([]Period, error) {
+	if err := ValidatePeriod(period); err != nil {
+		return nil, err
+	}
+
+	ps := []Period{}
+	for i := 0; i < len(ss); {
+		from := periodStart(period, ss[i].TimeStamp)
+		to := from.AddDate(0, 0, 1)
+		if period == PeriodWeek {
+			to = from.AddDate(0, 0, 7)
+		}
+
+		j := i
+		for j < len(ss) && ss[j].TimeStamp.Before(to) {
+			j++
+		}
+
+		start := ss[i]
+		if i > 0 {
+			start = ss[i-1]
+		}
+		ps = append(ps, newPeriod(from, to, start, ss[j-1]))
+		i = j
+	}
+	return ps, nil
+}
+
+// newPeriod returns the change in value between the snapshots `start` and
+// `end`.
+func newPeriod(from, to time.Time, start, end Snapshot) Period {
+	p := Period{
+		From:    from,
+		To:      to,
+		Start:   start,
+		End:     end,
+		PnL:     end.BTCValue.Sub(start.BTCValue),
+		PnLUSDT: end.USDTValue.Sub(start.USDTValue),
+		Assets:  []Contribution{},
+	}
+	if start.BTCValue.Sign() > 0 {
+		p.PnLPercent = p.PnL.Div(start.BTCValue).Mul(hundred).Round(2)
+	}
+
+	cs := map[string]*Contribution{}
+	get := func(currency string) *Contribution {
+		c, ok := cs[currency]
+		if !ok {
+			c = &Contribution{Currency: currency}
+			cs[currency] = c
+		}
+		return c
+	}
+	for _, h := range start.Holdings {
+		c := get(h.Currency)
+		c.StartQuantity = h.Quantity
+		c.PnL = c.PnL.Sub(h.BTCValue)
+		c.PnLUSDT = c.PnLUSDT.Sub(h.USDTValue)
+	}
+	for _, h := range end.Holdings {
+		c := get(h.Currency)
+		c.EndQuantity = h.Quantity
+		c.PnL = c.PnL.Add(h.BTCValue)
+		c.PnLUSDT = c.PnLUSDT.Add(h.USDTValue)
+	}
+
+	for _, c := range cs {
+		if start.BTCValue.Sign() > 0 {
+			c.Percent = c.PnL.Div(start.BTCValue).Mul(hundred).Round(2)
+		}
+		p.Assets = append(p.Assets, *c)
+	}
+	sort.Slice(p.Assets, func(i, j int) bool { return p.Assets[i].Currency < p.Assets[j].Currency })
+	return p
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,337 @@
+// Package history keeps a local store of candles per market and interval so
+// that strategies, indicators and backtests do not need to fetch the entire
+// history from the exchange every time, along with the time series of
+// portfolio snapshots.
+package history
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sabhiram/trade-bot/exchange"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+var (
+	ErrOffline = errors.New("candle store has no exchange to fetch from")
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Store caches candles per market and interval.  Candles are backfilled from
+// GetTicks, appended from GetLatestTick, deduplicated by their timestamp and
+// persisted as one CSV file per market and interval in the store's directory.
+//
+// The store implements GetTicks and GetLatestTick, so it can stand in for the
+// exchange as the candle source of indicators.
+type Store struct {
+	sync.Mutex // guards sets
+
+	dir  string
+	md   exchange.MarketData // nil for an offline store
+	sets map[string]*set     // keyed by market and interval
+}
+
+// set is the candles of a single market and interval sorted by time.
+type set struct {
+	market   string
+	interval string
+	candles  []exchange.Candle
+}
+
+// New returns a store persisted in `dir` (created if needed) which fetches
+// candles from `md`.  `md` may be nil to only use stored and imported candles.
+func New(dir string, md exchange.MarketData) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Store{
+		dir:  dir,
+		md:   md,
+		sets: map[string]*set{},
+	}, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// GetTicks brings the candles of `market` up to date and returns all of them.
+func (s *Store) GetTicks(market, interval string) ([]exchange.Candle, error) {
+	if _, err := s.Update(market, interval); err != nil {
+		return nil, err
+	}
+	return s.Range(market, interval, time.Time{}, time.Time{})
+}
+
+// GetLatestTick brings the candles of `market` up to date and returns the most
+// recent one.
+func (s *Store) GetLatestTick(market, interval string) ([]exchange.Candle, error) {
+	if _, err := s.Update(market, interval); err != nil {
+		return nil, err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	st, err := s.get(market, interval)
+	if err != nil {
+		return nil, err
+	}
+	if len(st.candles) == 0 {
+		return []exchange.Candle{}, nil
+	}
+	return []exchange.Candle{st.candles[len(st.candles)-1]}, nil
+}
+
+// Backfill merges the exchange's candle history for `market` into the store
+// and returns the number of new candles.
+func (s *Store) Backfill(market, interval string) (int, error) {
+	if s.md == nil {
+		return 0, ErrOffline
+	}
+	if err := exchange.ValidateInterval(interval); err != nil {
+		return 0, err
+	}
+
+	cs, err := s.md.GetTicks(strings.ToUpper(market), interval)
+	if err != nil {
+		return 0, err
+	}
+	return s.Merge(market, interval, cs)
+}
+
+// Update appends the latest candle of `market` to the store, backfilling the
+// history if the store is empty or candles were missed since the last update.
+// It returns the number of new candles.
+func (s *Store) Update(market, interval string) (int, error) {
+	if s.md == nil {
+		return 0, ErrOffline
+	}
+	dur, ok := exchange.IntervalDuration(interval)
+	if !ok {
+		return 0, exchange.ValidateInterval(interval)
+	}
+
+	s.Lock()
+	st, err := s.get(market, interval)
+	last := time.Time{}
+	if err == nil && len(st.candles) > 0 {
+		last = st.candles[len(st.candles)-1].TimeStamp
+	}
+	s.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	if last.IsZero() {
+		return s.Backfill(market, interval)
+	}
+
+	cs, err := s.md.GetLatestTick(strings.ToUpper(market), interval)
+	if err != nil {
+		return 0, err
+	}
+	for _, c := range cs {
+		if c.TimeStamp.Sub(last) > dur {
+			return s.Backfill(market, interval)
+		}
+	}
+	return s.Merge(market, interval, cs)
+}
+
+// Merge adds the candles `cs` to the store, replacing stored candles with the
+// same timestamp, and persists the result if anything changed.  It returns
+// the number of new candles.
+func (s *Store) Merge(market, interval string, cs []exchange.Candle) (int, error) {
+	if err := exchange.ValidateInterval(interval); err != nil {
+		return 0, err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	st, err := s.get(market, interval)
+	if err != nil {
+		return 0, err
+	}
+
+	added, changed := st.merge(cs)
+	if !changed {
+		return 0, nil
+	}
+	return added, s.save(st)
+}
+
+// Range returns the stored candles of `market` from `from` to `to` inclusive,
+// a zero time leaves that end of the range open.
+func (s *Store) Range(market, interval string, from, to time.Time) ([]exchange.Candle, error) {
+	if err := exchange.ValidateInterval(interval); err != nil {
+		return nil, err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	st, err := s.get(market, interval)
+	if err != nil {
+		return nil, err
+	}
+
+	cs := st.candles
+	if !from.IsZero() {
+		i := sort.Search(len(cs), func(i int) bool { return !cs[i].TimeStamp.Before(from) })
+		cs = cs[i:]
+	}
+	if !to.IsZero() {
+		i := sort.Search(len(cs), func(i int) bool { return cs[i].TimeStamp.After(to) })
+		cs = cs[:i]
+	}
+	return append([]exchange.Candle{}, cs...), nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Import merges the candles in the CSV `r` (see exchange.ReadCandlesCSV) into
+// the store at `interval` and returns the number of new candles per market.
+func (s *Store) Import(r io.Reader, interval string) (map[string]int, error) {
+	if err := exchange.ValidateInterval(interval); err != nil {
+		return nil, err
+	}
+
+	data, err := exchange.ReadCandlesCSV(r)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := map[string]int{}
+	for m, cs := range data {
+		n, err := s.Merge(m, interval, cs)
+		if err != nil {
+			return nil, err
+		}
+		ret[m] = n
+	}
+	return ret, nil
+}
+
+// Export writes the stored candles of `market` from `from` to `to` (see Range)
+// to `w` as CSV.
+func (s *Store) Export(w io.Writer, market, interval string, from, to time.Time) error {
+	cs, err := s.Range(market, interval, from, to)
+	if err != nil {
+		return err
+	}
+	return exchange.WriteCandlesCSV(w, market, cs)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func (s *Store) path(market, interval string) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%s_%s.csv", market, interval))
+}
+
+// get returns the set for `market` at `interval`, loading it from disk the
+// first time.  Sets which are not stored yet are only kept once saved, so that
+// markets which fail to backfill are not cached.  Callers must hold the lock.
+func (s *Store) get(market, interval string) (*set, error) {
+	if err := exchange.ValidateMarket(market); err != nil {
+		return nil, err
+	}
+	market = strings.ToUpper(market)
+	if st, ok := s.sets[setKey(market, interval)]; ok {
+		return st, nil
+	}
+
+	st := &set{market: market, interval: interval, candles: []exchange.Candle{}}
+	f, err := os.Open(s.path(market, interval))
+	if os.IsNotExist(err) {
+		return st, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data, err := exchange.ReadCandlesCSV(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", s.path(market, interval), err.Error())
+	}
+	st.merge(data[market])
+
+	s.sets[setKey(market, interval)] = st
+	return st, nil
+}
+
+// save writes the set `st` to disk, replacing the previous file atomically,
+// and keeps it.  Callers must hold the lock.
+func (s *Store) save(st *set) error {
+	p := s.path(st.market, st.interval)
+	f, err := ioutil.TempFile(s.dir, filepath.Base(p)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	if err := exchange.WriteCandlesCSV(f, st.market, st.candles); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), p); err != nil {
+		return err
+	}
+
+	s.sets[setKey(st.market, st.interval)] = st
+	return nil
+}
+
+func setKey(market, interval string) string {
+	return market + "/" + interval
+}
+
+// merge adds `cs` to the set, candles with the timestamp of a stored candle
+// replace it.  It returns the number of new candles and whether the set
+// changed.
+func (st *set) merge(cs []exchange.Candle) (int, bool) {
+	added, changed := 0, false
+	for _, c := range cs {
+		c.TimeStamp = c.TimeStamp.UTC()
+
+		n := len(st.candles)
+		i := sort.Search(n, func(i int) bool { return !st.candles[i].TimeStamp.Before(c.TimeStamp) })
+		switch {
+		case i < n && st.candles[i].TimeStamp.Equal(c.TimeStamp):
+			if !sameCandle(st.candles[i], c) {
+				st.candles[i] = c
+				changed = true
+			}
+		case i == n:
+			st.candles = append(st.candles, c)
+			added, changed = added+1, true
+		default:
+			st.candles = append(st.candles, exchange.Candle{})
+			copy(st.candles[i+1:], st.candles[i:])
+			st.candles[i] = c
+			added, changed = added+1, true
+		}
+	}
+	return added, changed
+}
+
+func sameCandle(a, b exchange.Candle) bool {
+	return a.Open.Equal(b.Open) && a.High.Equal(b.High) && a.Low.Equal(b.Low) &&
+		a.Close.Equal(b.Close) && a.Volume.Equal(b.Volume) && a.BaseVolume.Equal(b.BaseVolume)
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,111 @@
+package history
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sabhiram/trade-bot/exchange"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// stubMarketData serves the candles of the markets it has and fails for any
+// other.  Calls it does not implement panic.
+type stubMarketData struct {
+	exchange.MarketData
+	candles map[string][]exchange.Candle
+}
+
+func (md *stubMarketData) GetTicks(market, interval string) ([]exchange.Candle, error) {
+	cs, ok := md.candles[market]
+	if !ok {
+		return nil, errors.New("INVALID_MARKET")
+	}
+	return cs, nil
+}
+
+func (md *stubMarketData) GetLatestTick(market, interval string) ([]exchange.Candle, error) {
+	cs, err := md.GetTicks(market, interval)
+	if err != nil || len(cs) == 0 {
+		return nil, err
+	}
+	return cs[len(cs)-1:], nil
+}
+
+func newTestStore(t *testing.T) (*Store, func()) {
+	dir, err := ioutil.TempDir("", "history")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Minute)
+	cs := []exchange.Candle{}
+	for i := 2; i >= 0; i-- {
+		cs = append(cs, exchange.Candle{TimeStamp: now.Add(-time.Duration(i) * time.Minute), Close: decimal.New(int64(i+1), 0)})
+	}
+
+	s, err := New(dir, &stubMarketData{candles: map[string][]exchange.Candle{"BTC-PIVX": cs}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, func() { os.RemoveAll(dir) }
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func TestStoreInvalidMarkets(t *testing.T) {
+	s, done := newTestStore(t)
+	defer done()
+
+	for _, m := range []string{"../../etc/passwd", "BTC-PIVX/../x", "BTC_PIVX", "BTC-", "", "BTC-PIVX-X"} {
+		if _, err := s.Range(m, exchange.IntervalOneMin, time.Time{}, time.Time{}); err == nil {
+			t.Fatalf("%q: expected an invalid market", m)
+		}
+		if _, err := s.Update(m, exchange.IntervalOneMin); err == nil {
+			t.Fatalf("%q: expected an invalid market", m)
+		}
+	}
+	if len(s.sets) != 0 {
+		t.Fatalf("expected no cached sets, got %d", len(s.sets))
+	}
+}
+
+func TestStoreCachesLoadedSets(t *testing.T) {
+	s, done := newTestStore(t)
+	defer done()
+
+	// Markets which fail to backfill are not cached.
+	if _, err := s.Update("BTC-NOPE", exchange.IntervalOneMin); err == nil {
+		t.Fatalf("expected the backfill to fail")
+	}
+	if len(s.sets) != 0 {
+		t.Fatalf("expected no cached sets, got %d", len(s.sets))
+	}
+
+	n, err := s.Update("btc-pivx", exchange.IntervalOneMin)
+	if err != nil || n != 3 {
+		t.Fatalf("expected 3 new candles, got %d (%v)", n, err)
+	}
+	if _, ok := s.sets["BTC-PIVX/"+exchange.IntervalOneMin]; !ok || len(s.sets) != 1 {
+		t.Fatalf("expected only BTC-PIVX to be cached, got %d sets", len(s.sets))
+	}
+
+	// A new store loads the candles saved by the first.
+	s2, err := New(s.dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs, err := s2.Range("BTC-PIVX", exchange.IntervalOneMin, time.Time{}, time.Time{})
+	if err != nil || len(cs) != 3 {
+		t.Fatalf("expected 3 stored candles, got %d (%v)", len(cs), err)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -3,26 +3,91 @@ package hub
 ////////////////////////////////////////////////////////////////////////////////
 
 import (
+	"strings"
+
 	"github.com/sabhiram/trade-bot/server/socket"
 )
 
 ////////////////////////////////////////////////////////////////////////////////
 
+// Topics that sockets can subscribe to.  Topics which are scoped to a market
+// or session are built with `TickerTopic` and `SessionTopic`.
+const (
+	TopicBalance        = "balance"        // account balances
+	TopicPortfolio      = "portfolio"      // estimated value of the balances
+	TopicSessions       = "sessions"       // updates to any session
+	TopicOrders         = "orders"         // open orders on the exchange
+	TopicReconciliation = "reconciliation" // orphaned orders of the last reconciliation
+	TopicRisk           = "risk"           // orders rejected by the risk checks
+	TopicKillSwitch     = "killswitch"     // state of the kill switch
+	TopicTicker         = "ticker"         // "ticker:<market>"
+	TopicSession        = "session"        // "session:<id>"
+)
+
+// TickerTopic returns the topic for ticker updates of `market`.
+func TickerTopic(market string) string {
+	return TopicTicker + ":" + strings.ToUpper(market)
+}
+
+// SessionTopic returns the topic for updates to the session `id`.
+func SessionTopic(id string) string {
+	return TopicSession + ":" + id
+}
+
+// ParseTopic splits `topic` into its kind and (optional) argument, ex:
+// "ticker:BTC-PIVX" -> ("ticker", "BTC-PIVX").
+func ParseTopic(topic string) (string, string) {
+	if i := strings.Index(topic, ":"); i >= 0 {
+		return topic[:i], topic[i+1:]
+	}
+	return topic, ""
+}
+
+// CanonicalTopic returns `topic` with the market of ticker topics upper-cased
+// so that "ticker:btc-pivx" and "ticker:BTC-PIVX" are the same topic.
+func CanonicalTopic(topic string) string {
+	if kind, arg := ParseTopic(topic); kind == TopicTicker {
+		return TickerTopic(arg)
+	}
+	return topic
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+type subscription struct {
+	socket   *socket.Socket
+	topic    string
+	snapshot []byte // optional, sent to the socket once subscribed
+}
+
+type topicMessage struct {
+	topic string
+	msg   []byte
+}
+
 type Hub struct {
-	sockets map[*socket.Socket]struct{}
+	sockets map[*socket.Socket]map[string]struct{} // socket -> topics
+	topics  map[string]map[*socket.Socket]struct{} // topic -> sockets
 
-	broadcastCh  chan []byte
-	registerCh   chan *socket.Socket
-	unregisterCh chan *socket.Socket
+	broadcastCh   chan []byte
+	publishCh     chan topicMessage
+	registerCh    chan *socket.Socket
+	unregisterCh  chan *socket.Socket
+	subscribeCh   chan subscription
+	unsubscribeCh chan subscription
 }
 
 func New() (*Hub, error) {
 	return &Hub{
-		sockets: map[*socket.Socket]struct{}{},
+		sockets: map[*socket.Socket]map[string]struct{}{},
+		topics:  map[string]map[*socket.Socket]struct{}{},
 
-		broadcastCh:  make(chan []byte),
-		registerCh:   make(chan *socket.Socket),
-		unregisterCh: make(chan *socket.Socket),
+		broadcastCh:   make(chan []byte),
+		publishCh:     make(chan topicMessage),
+		registerCh:    make(chan *socket.Socket),
+		unregisterCh:  make(chan *socket.Socket),
+		subscribeCh:   make(chan subscription),
+		unsubscribeCh: make(chan subscription),
 	}, nil
 }
 
@@ -36,24 +101,77 @@ func (h *Hub) UnregisterSocket(s *socket.Socket) {
 	h.unregisterCh <- s
 }
 
+// Subscribe adds the socket `s` to `topic`.  If `snapshot` is non-nil it is
+// sent to `s` before any message broadcast to `topic` after subscribing.
+func (h *Hub) Subscribe(s *socket.Socket, topic string, snapshot []byte) {
+	h.subscribeCh <- subscription{socket: s, topic: topic, snapshot: snapshot}
+}
+
+// Unsubscribe removes the socket `s` from `topic`.
+func (h *Hub) Unsubscribe(s *socket.Socket, topic string) {
+	h.unsubscribeCh <- subscription{socket: s, topic: topic}
+}
+
+// Broadcast sends `msg` to every registered socket.
 func (h *Hub) Broadcast(msg []byte) {
 	h.broadcastCh <- msg
 }
 
+// BroadcastTopic sends `msg` to the sockets subscribed to `topic`.
+func (h *Hub) BroadcastTopic(topic string, msg []byte) {
+	h.publishCh <- topicMessage{topic: topic, msg: msg}
+}
+
 func (h *Hub) Run() {
 	for {
 		select {
 		case socket := <-h.registerCh:
-			h.sockets[socket] = struct{}{}
+			if _, ok := h.sockets[socket]; !ok {
+				h.sockets[socket] = map[string]struct{}{}
+			}
 		case socket := <-h.unregisterCh:
-			if _, ok := h.sockets[socket]; ok {
+			if topics, ok := h.sockets[socket]; ok {
+				for topic := range topics {
+					h.removeFromTopic(socket, topic)
+				}
 				delete(h.sockets, socket)
 				socket.Close()
 			}
+		case sub := <-h.subscribeCh:
+			topics, ok := h.sockets[sub.socket]
+			if !ok {
+				break
+			}
+			topics[sub.topic] = struct{}{}
+			if _, ok := h.topics[sub.topic]; !ok {
+				h.topics[sub.topic] = map[*socket.Socket]struct{}{}
+			}
+			h.topics[sub.topic][sub.socket] = struct{}{}
+			if sub.snapshot != nil {
+				sub.socket.Send(sub.snapshot)
+			}
+		case sub := <-h.unsubscribeCh:
+			if topics, ok := h.sockets[sub.socket]; ok {
+				delete(topics, sub.topic)
+				h.removeFromTopic(sub.socket, sub.topic)
+			}
 		case msg := <-h.broadcastCh:
 			for socket := range h.sockets {
 				socket.Send(msg)
 			}
+		case tm := <-h.publishCh:
+			for socket := range h.topics[tm.topic] {
+				socket.Send(tm.msg)
+			}
+		}
+	}
+}
+
+func (h *Hub) removeFromTopic(s *socket.Socket, topic string) {
+	if subs, ok := h.topics[topic]; ok {
+		delete(subs, s)
+		if len(subs) == 0 {
+			delete(h.topics, topic)
 		}
 	}
 }
@@ -0,0 +1,105 @@
+package indicator
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"github.com/shopspring/decimal"
+
+	"github.com/sabhiram/trade-bot/exchange"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// SMA is the simple moving average of the last `n` closes.
+type SMA struct {
+	w   window
+	sum decimal.Decimal
+}
+
+// NewSMA returns a simple moving average over `n` candles.
+func NewSMA(n int) *SMA {
+	return &SMA{w: window{n: n}}
+}
+
+func (s *SMA) Update(c exchange.Candle) {
+	s.add(c.Close)
+}
+
+func (s *SMA) add(v decimal.Decimal) {
+	s.sum = s.sum.Add(v)
+	if old, ok := s.w.push(v); ok {
+		s.sum = s.sum.Sub(old)
+	}
+}
+
+func (s *SMA) value() (decimal.Decimal, bool) {
+	if !s.w.full() {
+		return decimal.Zero, false
+	}
+	return s.sum.Div(decimal.New(int64(s.w.n), 0)), true
+}
+
+func (s *SMA) Values() (Values, bool) {
+	v, ok := s.value()
+	if !ok {
+		return nil, false
+	}
+	return Values{Value: v}, true
+}
+
+func (s *SMA) Clone() Indicator {
+	c := *s
+	c.w = s.w.clone()
+	return &c
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// EMA is the exponential moving average of the closes, seeded with the simple
+// average of the first `n` closes and smoothed by 2 / (n + 1).
+type EMA struct {
+	n     int
+	count int
+	v     decimal.Decimal // running sum until seeded
+}
+
+// NewEMA returns an exponential moving average with period `n`.
+func NewEMA(n int) *EMA {
+	return &EMA{n: n}
+}
+
+func (e *EMA) Update(c exchange.Candle) {
+	e.add(c.Close)
+}
+
+func (e *EMA) add(v decimal.Decimal) {
+	e.count++
+	switch {
+	case e.count < e.n:
+		e.v = e.v.Add(v)
+	case e.count == e.n:
+		e.v = e.v.Add(v).Div(decimal.New(int64(e.n), 0))
+	default:
+		k := two.Div(decimal.New(int64(e.n+1), 0))
+		e.v = v.Sub(e.v).Mul(k).Add(e.v).Round(precision)
+	}
+}
+
+func (e *EMA) value() (decimal.Decimal, bool) {
+	return e.v, e.count >= e.n
+}
+
+func (e *EMA) Values() (Values, bool) {
+	v, ok := e.value()
+	if !ok {
+		return nil, false
+	}
+	return Values{Value: v}, true
+}
+
+func (e *EMA) Clone() Indicator {
+	c := *e
+	return &c
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,234 @@
+// Package indicator implements streaming technical indicators over candles.
+// Indicators are fed one candle at a time, so they can be seeded from the
+// exchange's candle history and kept current with the latest candle.
+package indicator
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sabhiram/trade-bot/exchange"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Output keys of the indicators.  Indicators with a single output use Value.
+const (
+	Value     = "value"
+	MACDLine  = "macd"
+	Signal    = "signal"
+	Histogram = "histogram"
+	Upper     = "upper"
+	Middle    = "middle"
+	Lower     = "lower"
+)
+
+const (
+	maxPeriod = 1000 // bounds the periods of all indicators
+	precision = 16   // decimal places kept by smoothed averages
+)
+
+// Values are the outputs of an indicator, keyed by output name.
+type Values map[string]decimal.Decimal
+
+// Indicator is a streaming technical indicator.
+type Indicator interface {
+	// Update feeds the next candle to the indicator.
+	Update(c exchange.Candle)
+
+	// Values returns the current outputs, false until the indicator has seen
+	// enough candles.
+	Values() (Values, bool)
+
+	// Clone returns an independent copy of the indicator's state.
+	Clone() Indicator
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// spec describes an indicator that can be created by name.
+type spec struct {
+	desc     string
+	defaults []decimal.Decimal // also the number of arguments
+	periods  int               // leading arguments which are periods
+	create   func(args []decimal.Decimal) Indicator
+}
+
+func d(vs ...int64) []decimal.Decimal {
+	ds := []decimal.Decimal{}
+	for _, v := range vs {
+		ds = append(ds, decimal.New(v, 0))
+	}
+	return ds
+}
+
+func period(v decimal.Decimal) int {
+	return int(v.IntPart())
+}
+
+var specs = map[string]spec{
+	"sma": {"simple moving average of the close", d(20), 1, func(a []decimal.Decimal) Indicator {
+		return NewSMA(period(a[0]))
+	}},
+	"ema": {"exponential moving average of the close", d(20), 1, func(a []decimal.Decimal) Indicator {
+		return NewEMA(period(a[0]))
+	}},
+	"rsi": {"relative strength index (0-100)", d(14), 1, func(a []decimal.Decimal) Indicator {
+		return NewRSI(period(a[0]))
+	}},
+	"macd": {"macd line, signal and histogram (fast, slow, signal)", d(12, 26, 9), 3, func(a []decimal.Decimal) Indicator {
+		return NewMACD(period(a[0]), period(a[1]), period(a[2]))
+	}},
+	"bb": {"bollinger bands (period, standard deviations)", d(20, 2), 1, func(a []decimal.Decimal) Indicator {
+		return NewBollinger(period(a[0]), a[1])
+	}},
+	"atr": {"average true range", d(14), 1, func(a []decimal.Decimal) Indicator {
+		return NewATR(period(a[0]))
+	}},
+	"vwap": {"volume weighted average price, reset daily (UTC)", d(), 0, func(a []decimal.Decimal) Indicator {
+		return NewVWAP()
+	}},
+	"roc": {"percent change of the close from the close n candles earlier", d(1), 1, func(a []decimal.Decimal) Indicator {
+		return NewROC(period(a[0]))
+	}},
+}
+
+// Names returns a description of each indicator keyed by its name.
+func Names() map[string]string {
+	ret := map[string]string{}
+	for n, s := range specs {
+		ret[n] = s.desc
+	}
+	return ret
+}
+
+// Canonical returns the spec `name(args...)` for the indicator `name` with the
+// arguments `args`, missing trailing arguments take their defaults.  The spec
+// is validated, ex: Canonical("macd", nil) is "macd(12,26,9)".
+func Canonical(name string, args []decimal.Decimal) (string, error) {
+	c, _, err := resolve(name, args)
+	return c, err
+}
+
+// Parse parses an indicator spec such as "sma(20)", "macd" or "bb(20, 2.5)"
+// and returns its canonical form.
+func Parse(str string) (string, error) {
+	c, _, err := parse(str)
+	return c, err
+}
+
+// New returns a new indicator for the spec `str` (see Parse).
+func New(str string) (Indicator, error) {
+	c, all, err := parse(str)
+	if err != nil {
+		return nil, err
+	}
+	name := c
+	if i := strings.Index(c, "("); i >= 0 {
+		name = c[:i]
+	}
+	return specs[name].create(all), nil
+}
+
+func parse(str string) (string, []decimal.Decimal, error) {
+	str = strings.TrimSpace(str)
+	name, rest := str, ""
+	if i := strings.Index(str, "("); i >= 0 {
+		if !strings.HasSuffix(str, ")") {
+			return "", nil, fmt.Errorf("invalid indicator %q", str)
+		}
+		name, rest = str[:i], strings.TrimSpace(str[i+1:len(str)-1])
+	}
+
+	args := []decimal.Decimal{}
+	if len(rest) > 0 {
+		for _, a := range strings.Split(rest, ",") {
+			v, err := decimal.NewFromString(strings.TrimSpace(a))
+			if err != nil {
+				return "", nil, fmt.Errorf("invalid indicator %q: %q is not a number", str, a)
+			}
+			args = append(args, v)
+		}
+	}
+	return resolve(strings.TrimSpace(name), args)
+}
+
+// resolve validates `args` for the indicator `name` and returns its canonical
+// spec along with all of its arguments.
+func resolve(name string, args []decimal.Decimal) (string, []decimal.Decimal, error) {
+	name = strings.ToLower(name)
+	s, ok := specs[name]
+	if !ok {
+		ns := []string{}
+		for n := range specs {
+			ns = append(ns, n)
+		}
+		sort.Strings(ns)
+		return "", nil, fmt.Errorf("unknown indicator %s (have: %s)", name, strings.Join(ns, ", "))
+	}
+	if len(args) > len(s.defaults) {
+		return "", nil, fmt.Errorf("%s takes at most %d argument(s), got %d", name, len(s.defaults), len(args))
+	}
+
+	all := append(append([]decimal.Decimal{}, args...), s.defaults[len(args):]...)
+	strs := []string{}
+	for i, a := range all {
+		if i < s.periods {
+			if !a.Equal(a.Truncate(0)) || a.IntPart() < 1 || a.IntPart() > maxPeriod {
+				return "", nil, fmt.Errorf("%s: period must be a whole number between 1 and %d", name, maxPeriod)
+			}
+		} else if a.Sign() <= 0 {
+			return "", nil, fmt.Errorf("%s: %s must be positive", name, a)
+		}
+		strs = append(strs, a.String())
+	}
+	if name == "macd" && all[0].GreaterThanOrEqual(all[1]) {
+		return "", nil, fmt.Errorf("macd: fast period must be below the slow period")
+	}
+
+	if len(strs) == 0 {
+		return name, all, nil
+	}
+	return name + "(" + strings.Join(strs, ",") + ")", all, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+var (
+	one     = decimal.New(1, 0)
+	two     = decimal.New(2, 0)
+	three   = decimal.New(3, 0)
+	hundred = decimal.New(100, 0)
+)
+
+// window is a fixed size FIFO of values.
+type window struct {
+	n  int
+	vs []decimal.Decimal
+}
+
+// push adds `v`, returning the evicted value (if any).
+func (w *window) push(v decimal.Decimal) (decimal.Decimal, bool) {
+	w.vs = append(w.vs, v)
+	if len(w.vs) <= w.n {
+		return decimal.Zero, false
+	}
+	old := w.vs[0]
+	w.vs = w.vs[1:]
+	return old, true
+}
+
+func (w *window) full() bool {
+	return len(w.vs) == w.n
+}
+
+func (w window) clone() window {
+	return window{n: w.n, vs: append([]decimal.Decimal{}, w.vs...)}
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,183 @@
+package indicator
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sabhiram/trade-bot/exchange"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+func dec(s string) decimal.Decimal {
+	v, err := decimal.NewFromString(s)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+var start = time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// closes returns candles a minute apart closing at `vs`, with a high and low
+// equal to the close and a volume of 1.
+func closes(vs ...string) []exchange.Candle {
+	cs := []exchange.Candle{}
+	for i, v := range vs {
+		c := dec(v)
+		cs = append(cs, exchange.Candle{TimeStamp: start.Add(time.Duration(i) * time.Minute), High: c, Low: c, Close: c, Volume: one})
+	}
+	return cs
+}
+
+// candle returns a candle at `ts` with the "high low close volume" in `hlcv`.
+func candle(ts time.Time, hlcv string) exchange.Candle {
+	fs := strings.Fields(hlcv)
+	return exchange.Candle{TimeStamp: ts, High: dec(fs[0]), Low: dec(fs[1]), Close: dec(fs[2]), Volume: dec(fs[3])}
+}
+
+// checkValues fails `t` unless `got` has exactly the values in `want`.
+func checkValues(t *testing.T, got, want Values) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for k, v := range want {
+		if g, ok := got[k]; !ok || !g.Equal(v) {
+			t.Fatalf("%s: expected %s, got %s", k, v, g)
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func TestIndicators(t *testing.T) {
+	day := start.Add(23 * time.Hour)
+	for _, tc := range []struct {
+		name    string
+		spec    string
+		candles []exchange.Candle
+		ready   int // candles needed for a value
+		want    Values
+	}{
+		{"sma", "sma(3)", closes("1", "2", "3", "4", "5"), 3, Values{Value: dec("4")}},
+
+		// Seeded with the average of 1, 2 and 3, then smoothed by 0.5.
+		{"ema", "ema(3)", closes("1", "2", "3", "4", "6"), 3, Values{Value: dec("4.5")}},
+
+		// Gains of 1, 0, 1, 1 and losses of 0, 1, 0, 0 average 0.875 and
+		// 0.125, a relative strength of 7.
+		{"rsi", "rsi(2)", closes("1", "2", "1", "2", "3"), 3, Values{Value: dec("87.5")}},
+		{"rsi without losses", "rsi(2)", closes("1", "2", "3"), 3, Values{Value: dec("100")}},
+
+		// The line is the close less the ema(3) (1 then 1.5), the signal
+		// their average.
+		{"macd", "macd(1,3,2)", closes("1", "2", "3", "5"), 4, Values{
+			MACDLine:  dec("1.5"),
+			Signal:    dec("1.25"),
+			Histogram: dec("0.25"),
+		}},
+
+		// A mean of 5 and a standard deviation of 2.
+		{"bb", "bb(8,2)", closes("2", "4", "4", "4", "5", "5", "7", "9"), 8, Values{
+			Upper:  dec("9"),
+			Middle: dec("5"),
+			Lower:  dec("1"),
+		}},
+
+		// True ranges of 1, 1.5 (from the previous close) and 0.2.
+		{"atr", "atr(2)", []exchange.Candle{
+			candle(start, "2 1 1.5 1"),
+			candle(start.Add(time.Minute), "3 2 2.5 1"),
+			candle(start.Add(2*time.Minute), "2.6 2.4 2.5 1"),
+		}, 2, Values{Value: dec("0.725")}},
+
+		// Typical prices of 2 and 4, weighted by volumes of 10 and 30.
+		{"vwap", "vwap", []exchange.Candle{
+			candle(day, "3 1 2 10"),
+			candle(day.Add(time.Minute), "6 3 3 30"),
+		}, 1, Values{Value: dec("3.5")}},
+		{"vwap resets daily", "vwap", []exchange.Candle{
+			candle(day, "3 1 2 10"),
+			candle(day.Add(time.Hour), "1 1 1 5"),
+		}, 1, Values{Value: dec("1")}},
+
+		{"roc", "roc(2)", closes("10", "11", "12"), 3, Values{Value: dec("20")}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ind, err := New(tc.spec)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err.Error())
+			}
+			for i, c := range tc.candles {
+				if _, ok := ind.Values(); ok != (i >= tc.ready) {
+					t.Fatalf("after %d candles: expected ready to be %t", i, i >= tc.ready)
+				}
+				ind.Update(c)
+			}
+			vs, ok := ind.Values()
+			if !ok {
+				t.Fatalf("expected a value")
+			}
+			checkValues(t, vs, tc.want)
+		})
+	}
+}
+
+func TestIndicatorsNotReady(t *testing.T) {
+	for _, tc := range []struct {
+		spec    string
+		candles []exchange.Candle
+	}{
+		{"vwap", []exchange.Candle{candle(start, "1 1 1 0")}}, // no volume
+		{"roc(1)", closes("0", "1")},                          // from zero
+	} {
+		ind, _ := New(tc.spec)
+		for _, c := range tc.candles {
+			ind.Update(c)
+		}
+		if vs, ok := ind.Values(); ok {
+			t.Fatalf("%s: expected no value, got %v", tc.spec, vs)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		src  string
+		want string
+		err  string
+	}{
+		{"sma", "sma(20)", ""},
+		{" SMA( 5 ) ", "sma(5)", ""},
+		{"macd(5)", "macd(5,26,9)", ""},
+		{"bb(20, 2.5)", "bb(20,2.5)", ""},
+		{"vwap", "vwap", ""},
+		{"foo(1)", "", "unknown indicator foo"},
+		{"sma(1, 2)", "", "sma takes at most 1 argument(s), got 2"},
+		{"sma(0)", "", "sma: period must be a whole number between 1 and 1000"},
+		{"sma(2.5)", "", "sma: period must be a whole number between 1 and 1000"},
+		{"bb(20, 0)", "", "bb: 0 must be positive"},
+		{"macd(26, 12)", "", "macd: fast period must be below the slow period"},
+		{"sma(x)", "", `"x" is not a number`},
+		{"sma(5", "", "invalid indicator"},
+	} {
+		got, err := Parse(tc.src)
+		if len(tc.err) > 0 {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Fatalf("%q: expected %q, got %v", tc.src, tc.err, err)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Fatalf("%q: expected %s, got %s (%v)", tc.src, tc.want, got, err)
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,159 @@
+package indicator
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"github.com/shopspring/decimal"
+
+	"github.com/sabhiram/trade-bot/exchange"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// wilder is an average smoothed using Wilder's method, seeded with the simple
+// average of the first `n` values.
+type wilder struct {
+	n     int
+	count int
+	v     decimal.Decimal
+}
+
+func (w *wilder) add(v decimal.Decimal) {
+	w.count++
+	N := decimal.New(int64(w.n), 0)
+	switch {
+	case w.count < w.n:
+		w.v = w.v.Add(v)
+	case w.count == w.n:
+		w.v = w.v.Add(v).Div(N)
+	default:
+		w.v = w.v.Mul(N.Sub(one)).Add(v).Div(N).Round(precision)
+	}
+}
+
+func (w *wilder) ready() bool {
+	return w.count >= w.n
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// RSI is the relative strength index of the closes over `n` periods.
+type RSI struct {
+	prev       decimal.Decimal
+	seen       bool
+	gain, loss wilder
+}
+
+// NewRSI returns a relative strength index with period `n`.
+func NewRSI(n int) *RSI {
+	return &RSI{gain: wilder{n: n}, loss: wilder{n: n}}
+}
+
+func (r *RSI) Update(c exchange.Candle) {
+	if r.seen {
+		g, l := decimal.Zero, decimal.Zero
+		if d := c.Close.Sub(r.prev); d.Sign() > 0 {
+			g = d
+		} else {
+			l = d.Neg()
+		}
+		r.gain.add(g)
+		r.loss.add(l)
+	}
+	r.prev, r.seen = c.Close, true
+}
+
+func (r *RSI) Values() (Values, bool) {
+	if !r.gain.ready() {
+		return nil, false
+	}
+	if r.loss.v.Sign() == 0 {
+		return Values{Value: hundred}, true
+	}
+	rs := r.gain.v.Div(r.loss.v)
+	return Values{Value: hundred.Sub(hundred.Div(one.Add(rs)))}, true
+}
+
+func (r *RSI) Clone() Indicator {
+	c := *r
+	return &c
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// MACD is the difference of a fast and slow EMA of the closes (the macd line),
+// the EMA of the macd line (signal) and their difference (histogram).
+type MACD struct {
+	fast, slow, signal EMA
+}
+
+// NewMACD returns a MACD with the given periods (usually 12, 26 and 9).
+func NewMACD(fast, slow, signal int) *MACD {
+	return &MACD{
+		fast:   EMA{n: fast},
+		slow:   EMA{n: slow},
+		signal: EMA{n: signal},
+	}
+}
+
+func (m *MACD) Update(c exchange.Candle) {
+	m.fast.add(c.Close)
+	m.slow.add(c.Close)
+	if line, ok := m.line(); ok {
+		m.signal.add(line)
+	}
+}
+
+func (m *MACD) line() (decimal.Decimal, bool) {
+	f, fok := m.fast.value()
+	s, sok := m.slow.value()
+	return f.Sub(s), fok && sok
+}
+
+func (m *MACD) Values() (Values, bool) {
+	line, _ := m.line()
+	sig, ok := m.signal.value()
+	if !ok {
+		return nil, false
+	}
+	return Values{
+		MACDLine:  line,
+		Signal:    sig,
+		Histogram: line.Sub(sig),
+	}, true
+}
+
+func (m *MACD) Clone() Indicator {
+	c := *m
+	return &c
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// ROC is the percent change of the close from the close `n` candles earlier.
+type ROC struct {
+	w window
+}
+
+// NewROC returns the rate of change over `n` candles.
+func NewROC(n int) *ROC {
+	return &ROC{w: window{n: n + 1}}
+}
+
+func (r *ROC) Update(c exchange.Candle) {
+	r.w.push(c.Close)
+}
+
+func (r *ROC) Values() (Values, bool) {
+	if !r.w.full() || r.w.vs[0].Sign() == 0 {
+		return nil, false
+	}
+	ref, last := r.w.vs[0], r.w.vs[len(r.w.vs)-1]
+	return Values{Value: last.Sub(ref).Div(ref).Mul(hundred)}, true
+}
+
+func (r *ROC) Clone() Indicator {
+	return &ROC{w: r.w.clone()}
+}
+
+////////////////////////////////////////////////////////////////////////////////
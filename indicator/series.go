@@ -0,0 +1,263 @@
+package indicator
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sabhiram/trade-bot/exchange"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+const (
+	// MaxCandles is the number of candles kept per series.
+	MaxCandles = 2000
+
+	// DefaultRefresh is how often a Source polls for the latest candle.
+	DefaultRefresh = 15 * time.Second
+)
+
+// Candles provides the candle history of markets, ex: an exchange or a local
+// candle store.
+type Candles interface {
+	GetTicks(market, interval string) ([]exchange.Candle, error)
+	GetLatestTick(market, interval string) ([]exchange.Candle, error)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Point is the value of an indicator at the close of a candle.
+type Point struct {
+	TimeStamp time.Time
+	Values    Values
+}
+
+// tracked is an indicator kept current by a series.  `base` has seen every
+// candle but the last, which may still be in progress and is re-applied to a
+// clone of `base` whenever it changes.
+type tracked struct {
+	base, cur Indicator
+}
+
+// Series is the candle history of a market at an interval along with the
+// indicators computed over it.
+type Series struct {
+	sync.Mutex
+
+	Market   string
+	Interval string
+
+	candles []exchange.Candle
+	inds    map[string]*tracked
+}
+
+// NewSeries returns a series for `market` seeded with the candles `cs`.
+func NewSeries(market, interval string, cs []exchange.Candle) *Series {
+	s := &Series{
+		Market:   strings.ToUpper(market),
+		Interval: interval,
+		inds:     map[string]*tracked{},
+	}
+	for _, c := range cs {
+		s.update(c)
+	}
+	return s
+}
+
+// Update adds the candle `c`.  A candle with the same timestamp as the last
+// one replaces it (ex: the in progress candle), older candles are ignored.
+func (s *Series) Update(c exchange.Candle) {
+	s.Lock()
+	defer s.Unlock()
+	s.update(c)
+}
+
+func (s *Series) update(c exchange.Candle) {
+	n := len(s.candles)
+	if n > 0 {
+		last := s.candles[n-1].TimeStamp
+		switch {
+		case c.TimeStamp.Before(last):
+			return
+		case c.TimeStamp.Equal(last):
+			s.candles[n-1] = c
+			for _, t := range s.inds {
+				t.cur = t.base.Clone()
+				t.cur.Update(c)
+			}
+			return
+		}
+	}
+
+	s.candles = append(s.candles, c)
+	if len(s.candles) > MaxCandles {
+		s.candles = s.candles[len(s.candles)-MaxCandles:]
+	}
+	for _, t := range s.inds {
+		t.base = t.cur
+		t.cur = t.base.Clone()
+		t.cur.Update(c)
+	}
+}
+
+// Last returns the timestamp of the last candle, the zero time if there are
+// none.
+func (s *Series) Last() time.Time {
+	s.Lock()
+	defer s.Unlock()
+
+	if len(s.candles) == 0 {
+		return time.Time{}
+	}
+	return s.candles[len(s.candles)-1].TimeStamp
+}
+
+// Candles returns (up to) the last `n` candles, all of them if `n` <= 0.
+func (s *Series) Candles(n int) []exchange.Candle {
+	s.Lock()
+	defer s.Unlock()
+
+	cs := s.candles
+	if n > 0 && len(cs) > n {
+		cs = cs[len(cs)-n:]
+	}
+	return append([]exchange.Candle{}, cs...)
+}
+
+// Value returns the current value of the indicator `spec` (see Parse).  The
+// indicator is computed over the series' history the first time it is asked
+// for and kept current from then on.
+func (s *Series) Value(spec string) (Values, error) {
+	c, err := Parse(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	t, ok := s.inds[c]
+	if !ok {
+		ind, _ := New(c)
+		t = &tracked{base: ind.Clone(), cur: ind}
+		for i, candle := range s.candles {
+			if i == len(s.candles)-1 {
+				t.base = ind.Clone()
+			}
+			ind.Update(candle)
+		}
+		s.inds[c] = t
+	}
+
+	vs, ok := t.cur.Values()
+	if !ok {
+		return nil, fmt.Errorf("%s: not enough candles (have %d)", c, len(s.candles))
+	}
+	return vs, nil
+}
+
+// Points returns the value of the indicator `spec` at each of (up to) the last
+// `n` candles, all of them if `n` <= 0.  Candles before the indicator has
+// enough history are skipped.
+func (s *Series) Points(spec string, n int) ([]Point, error) {
+	ind, err := New(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	ps := []Point{}
+	for _, c := range s.candles {
+		ind.Update(c)
+		if vs, ok := ind.Values(); ok {
+			ps = append(ps, Point{TimeStamp: c.TimeStamp, Values: vs})
+		}
+	}
+	if n > 0 && len(ps) > n {
+		ps = ps[len(ps)-n:]
+	}
+	return ps, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Source keeps a series per market and interval, seeded from the exchange's
+// candle history and updated with the latest candle at most once every
+// `refresh`.
+type Source struct {
+	sync.Mutex
+
+	md      Candles
+	refresh time.Duration
+	series  map[string]*sourced
+}
+
+type sourced struct {
+	series    *Series
+	updatedAt time.Time
+}
+
+// NewSource returns a source of series with candles from `md`.
+func NewSource(md Candles, refresh time.Duration) *Source {
+	return &Source{
+		md:      md,
+		refresh: refresh,
+		series:  map[string]*sourced{},
+	}
+}
+
+// Series returns the up to date series for `market` at `interval`.
+func (src *Source) Series(market, interval string) (*Series, error) {
+	dur, ok := exchange.IntervalDuration(interval)
+	if !ok {
+		return nil, exchange.ValidateInterval(interval)
+	}
+	market = strings.ToUpper(market)
+	key := market + "/" + interval
+
+	src.Lock()
+	defer src.Unlock()
+
+	e, ok := src.series[key]
+	if !ok {
+		cs, err := src.md.GetTicks(market, interval)
+		if err != nil {
+			return nil, err
+		}
+		e = &sourced{series: NewSeries(market, interval, cs), updatedAt: time.Now()}
+		src.series[key] = e
+		return e.series, nil
+	}
+
+	if time.Since(e.updatedAt) >= src.refresh {
+		cs, err := src.md.GetLatestTick(market, interval)
+		if err != nil {
+			return nil, err
+		}
+
+		// Candles closed since the last refresh are backfilled from the
+		// history.
+		last := e.series.Last()
+		for _, c := range cs {
+			if !last.IsZero() && c.TimeStamp.Sub(last) > dur {
+				if cs, err = src.md.GetTicks(market, interval); err != nil {
+					return nil, err
+				}
+				break
+			}
+		}
+		for _, c := range cs {
+			e.series.Update(c)
+		}
+		e.updatedAt = time.Now()
+	}
+	return e.series, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,210 @@
+package indicator
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sabhiram/trade-bot/exchange"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// allSpecs has every indicator, with short periods.
+var allSpecs = []string{"sma(5)", "ema(5)", "rsi(5)", "macd(3,6,4)", "bb(5,2)", "atr(5)", "vwap", "roc(3)"}
+
+// walk returns `n` five minute candles from 22:00 (so that they span a day)
+// with closes that rise and fall.
+func walk(n int) []exchange.Candle {
+	cs := []exchange.Candle{}
+	for i := 0; i < n; i++ {
+		c := decimal.New(int64(100+(i*37)%23), -3)
+		cs = append(cs, exchange.Candle{
+			TimeStamp: start.Add(22*time.Hour + time.Duration(i)*5*time.Minute),
+			Open:      c,
+			High:      c.Add(decimal.New(int64(i%4+1), -3)),
+			Low:       c.Sub(decimal.New(int64(i%3+1), -3)),
+			Close:     c,
+			Volume:    decimal.New(int64(i%5+1), 0),
+		})
+	}
+	return cs
+}
+
+// recompute returns the value of `spec` computed from scratch over `cs`.
+func recompute(t *testing.T, spec string, cs []exchange.Candle) Values {
+	t.Helper()
+	ind, err := New(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range cs {
+		ind.Update(c)
+	}
+	vs, ok := ind.Values()
+	if !ok {
+		t.Fatalf("%s: expected a value over %d candles", spec, len(cs))
+	}
+	return vs
+}
+
+// checkSeries fails `t` unless every indicator of `s` has the value computed
+// from scratch over its candles.
+func checkSeries(t *testing.T, s *Series) {
+	t.Helper()
+	for _, spec := range allSpecs {
+		vs, err := s.Value(spec)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", spec, err.Error())
+		}
+		checkValues(t, vs, recompute(t, spec, s.Candles(0)))
+	}
+}
+
+// stubCandles serves `candles` as the history, and `latest` as the latest
+// candle.
+type stubCandles struct {
+	candles []exchange.Candle
+	latest  exchange.Candle
+	history int // calls to GetTicks
+}
+
+func (sc *stubCandles) GetTicks(market, interval string) ([]exchange.Candle, error) {
+	if market != "BTC-PIVX" {
+		return nil, errors.New("INVALID_MARKET")
+	}
+	sc.history++
+	return sc.candles, nil
+}
+
+func (sc *stubCandles) GetLatestTick(market, interval string) ([]exchange.Candle, error) {
+	return []exchange.Candle{sc.latest}, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func TestSeriesUpdateLast(t *testing.T) {
+	cs := walk(40)
+	s := NewSeries("btc-pivx", exchange.IntervalFiveMin, cs[:30])
+	checkSeries(t, s)
+
+	// The last candle is updated in place while it is in progress, and then
+	// closed by the next candle.
+	for i := 30; i < len(cs); i++ {
+		c := cs[i]
+		for _, close := range []string{"0.09", "0.13", "0.11"} {
+			c.Close = dec(close)
+			c.High = decimal.Max(c.High, c.Close)
+			c.Low = decimal.Min(c.Low, c.Close)
+			c.Volume = c.Volume.Add(one)
+			s.Update(c)
+			checkSeries(t, s)
+		}
+		s.Update(cs[i])
+		checkSeries(t, s)
+	}
+
+	if n := len(s.Candles(0)); n != 40 {
+		t.Fatalf("expected 40 candles, got %d", n)
+	}
+}
+
+func TestSeriesTrackedBeforeCandles(t *testing.T) {
+	s := NewSeries("BTC-PIVX", exchange.IntervalFiveMin, nil)
+	if _, err := s.Value("sma(5)"); err == nil {
+		t.Fatalf("expected not enough candles")
+	}
+
+	cs := walk(10)
+	for i := range cs {
+		// An in progress update of each candle, then the candle itself.
+		c := cs[i]
+		c.Close = c.Close.Add(one)
+		s.Update(c)
+		s.Update(cs[i])
+	}
+	vs, err := s.Value("sma(5)")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	checkValues(t, vs, recompute(t, "sma(5)", cs))
+}
+
+func TestSeriesIgnoresOldCandles(t *testing.T) {
+	cs := walk(10)
+	s := NewSeries("BTC-PIVX", exchange.IntervalFiveMin, cs)
+	want, _ := s.Value("sma(5)")
+
+	old := cs[3]
+	old.Close = dec("5")
+	s.Update(old)
+
+	got, _ := s.Value("sma(5)")
+	checkValues(t, got, want)
+	if !s.Last().Equal(cs[9].TimeStamp) || !s.Candles(0)[3].Close.Equal(cs[3].Close) {
+		t.Fatalf("expected the old candle to be ignored")
+	}
+}
+
+func TestSeriesPoints(t *testing.T) {
+	cs := walk(10)
+	s := NewSeries("BTC-PIVX", exchange.IntervalFiveMin, cs)
+
+	// Points start at the fifth candle, the first with a value.
+	ps, err := s.Points("sma(5)", 0)
+	if err != nil || len(ps) != 6 || !ps[0].TimeStamp.Equal(cs[4].TimeStamp) {
+		t.Fatalf("expected 6 points from the fifth candle, got %d (%v)", len(ps), err)
+	}
+	ps, _ = s.Points("sma(5)", 2)
+	if len(ps) != 2 || !ps[1].TimeStamp.Equal(cs[9].TimeStamp) {
+		t.Fatalf("expected the last 2 points, got %d", len(ps))
+	}
+	checkValues(t, ps[1].Values, recompute(t, "sma(5)", cs))
+}
+
+func TestSource(t *testing.T) {
+	cs := walk(20)
+	sc := &stubCandles{candles: cs[:10], latest: cs[9]}
+	src := NewSource(sc, 0)
+
+	if _, err := src.Series("BTC-NOPE", exchange.IntervalFiveMin); err == nil {
+		t.Fatalf("expected an unknown market")
+	}
+	if _, err := src.Series("BTC-PIVX", "weekly"); err == nil {
+		t.Fatalf("expected an invalid interval")
+	}
+
+	s, err := src.Series("btc-pivx", exchange.IntervalFiveMin)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	checkSeries(t, s)
+
+	// Later calls add the latest candle to the same series.
+	for _, c := range cs[10:12] {
+		sc.latest = c
+		if s2, err := src.Series("BTC-PIVX", exchange.IntervalFiveMin); err != nil || s2 != s {
+			t.Fatalf("expected the same series, got %v", err)
+		}
+		checkSeries(t, s)
+	}
+	if len(s.Candles(0)) != 12 || sc.history != 1 {
+		t.Fatalf("expected 12 candles from one history, got %d from %d", len(s.Candles(0)), sc.history)
+	}
+
+	// Candles missed since the last refresh are backfilled from the history.
+	sc.candles, sc.latest = cs, cs[19]
+	if _, err := src.Series("BTC-PIVX", exchange.IntervalFiveMin); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if len(s.Candles(0)) != 20 || sc.history != 2 {
+		t.Fatalf("expected 20 candles from two histories, got %d from %d", len(s.Candles(0)), sc.history)
+	}
+	checkSeries(t, s)
+}
+
+////////////////////////////////////////////////////////////////////////////////
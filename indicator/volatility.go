@@ -0,0 +1,100 @@
+package indicator
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"math"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sabhiram/trade-bot/exchange"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Bollinger bands are the `n` period SMA of the closes (middle) plus and minus
+// `k` standard deviations (upper and lower).
+type Bollinger struct {
+	sma SMA
+	k   decimal.Decimal
+}
+
+// NewBollinger returns bollinger bands over `n` candles, `k` standard
+// deviations wide.
+func NewBollinger(n int, k decimal.Decimal) *Bollinger {
+	return &Bollinger{sma: SMA{w: window{n: n}}, k: k}
+}
+
+func (b *Bollinger) Update(c exchange.Candle) {
+	b.sma.add(c.Close)
+}
+
+func (b *Bollinger) Values() (Values, bool) {
+	mid, ok := b.sma.value()
+	if !ok {
+		return nil, false
+	}
+
+	// Population standard deviation, the square root is taken as a float.
+	sq := decimal.Zero
+	for _, v := range b.sma.w.vs {
+		d := v.Sub(mid)
+		sq = sq.Add(d.Mul(d))
+	}
+	f, _ := sq.Div(decimal.New(int64(b.sma.w.n), 0)).Float64()
+	dev := decimal.NewFromFloat(math.Sqrt(f)).Mul(b.k)
+
+	return Values{
+		Upper:  mid.Add(dev),
+		Middle: mid,
+		Lower:  mid.Sub(dev),
+	}, true
+}
+
+func (b *Bollinger) Clone() Indicator {
+	c := *b
+	c.sma.w = b.sma.w.clone()
+	return &c
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// ATR is the average true range over `n` periods (Wilder's smoothing).
+type ATR struct {
+	prev decimal.Decimal
+	seen bool
+	tr   wilder
+}
+
+// NewATR returns an average true range with period `n`.
+func NewATR(n int) *ATR {
+	return &ATR{tr: wilder{n: n}}
+}
+
+func (a *ATR) Update(c exchange.Candle) {
+	tr := c.High.Sub(c.Low)
+	if a.seen {
+		if v := c.High.Sub(a.prev).Abs(); v.GreaterThan(tr) {
+			tr = v
+		}
+		if v := c.Low.Sub(a.prev).Abs(); v.GreaterThan(tr) {
+			tr = v
+		}
+	}
+	a.tr.add(tr)
+	a.prev, a.seen = c.Close, true
+}
+
+func (a *ATR) Values() (Values, bool) {
+	if !a.tr.ready() {
+		return nil, false
+	}
+	return Values{Value: a.tr.v}, true
+}
+
+func (a *ATR) Clone() Indicator {
+	c := *a
+	return &c
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,50 @@
+package indicator
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sabhiram/trade-bot/exchange"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// VWAP is the volume weighted average of the typical price ((high + low +
+// close) / 3) since the start of the candle's day (UTC).
+type VWAP struct {
+	day     time.Time
+	pv, vol decimal.Decimal
+}
+
+// NewVWAP returns a daily volume weighted average price.
+func NewVWAP() *VWAP {
+	return &VWAP{}
+}
+
+func (v *VWAP) Update(c exchange.Candle) {
+	day := c.TimeStamp.UTC().Truncate(24 * time.Hour)
+	if !day.Equal(v.day) {
+		v.day, v.pv, v.vol = day, decimal.Zero, decimal.Zero
+	}
+
+	typical := c.High.Add(c.Low).Add(c.Close).Div(three)
+	v.pv = v.pv.Add(typical.Mul(c.Volume))
+	v.vol = v.vol.Add(c.Volume)
+}
+
+func (v *VWAP) Values() (Values, bool) {
+	if v.vol.Sign() <= 0 {
+		return nil, false
+	}
+	return Values{Value: v.pv.Div(v.vol)}, true
+}
+
+func (v *VWAP) Clone() Indicator {
+	c := *v
+	return &c
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -3,29 +3,82 @@ package main
 ////////////////////////////////////////////////////////////////////////////////
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/shopspring/decimal"
+
 	"github.com/sabhiram/trade-bot/app"
+	"github.com/sabhiram/trade-bot/exchange"
 	"github.com/sabhiram/trade-bot/hub"
 	"github.com/sabhiram/trade-bot/server"
+	"github.com/sabhiram/trade-bot/trade"
 	"github.com/sabhiram/trade-bot/types"
 )
 
 ////////////////////////////////////////////////////////////////////////////////
 
 const (
-	sitePath = "./site/build/default"
+	sitePath   = "./site/build/default"
+	listenAddr = ":8100" // address of the web UI and API
+
+	killSwitchTimeout = 10 * time.Second // wait on the server to halt or re-arm
 )
 
 ////////////////////////////////////////////////////////////////////////////////
 
 const usage = `trade-bot usage:
 
-  $ BITTREX_API_KEY=<key> BITTREX_SECRET=<secret> trade-bot
+  $ BITTREX_API_KEY=<key> BITTREX_SECRET=<secret> trade-bot [command]
+
+  Where 'command' can include:
+
+    server              -   run the web UI on :8100 (default)
+    version             -   print the version
+    usage               -   print this message
+    candles             -   manage the local candle store (see below)
+    backtest            -   replay a trade over candles (see below)
+    halt [exit]         -   engage the kill switch (see below)
+    rearm               -   re-arm trading after a halt
+%s
+  The server refreshes balances, tickers of watched markets and open
+  orders in the background, the intervals are set with:
+
+    -balance-refresh    -   balance refresh interval (default 30s)
+    -ticker-refresh     -   watched ticker refresh interval (default 5s)
+    -order-refresh      -   open order refresh interval (default 15s)
+
+  The portfolio is also snapshotted every '-snapshot-interval' (default
+  1h, 0 disables) to the '-snapshots' file (default snapshots.jsonl),
+  which backs the portfolio history and P&L APIs.
+
+  Additional trades can be defined in JSON strategy files, every file
+  in the '-strategies' directory is loaded at startup.
+
+  Candles are cached per market and interval as csv files in the
+  '-candles' directory (default "candles").  The store is backfilled
+  from the exchange and kept current as indicators are evaluated:
+
+    candles backfill <market> [interval]
+    candles import <csv> [interval]
+    candles export <market> <csv> [interval] [from] [to]
+
+  The interval defaults to "fiveMin", from and to are RFC3339 times.
+
+  Trade commands query the user for the coin to trade and the trade's
+  parameters, show the orders it would place and ask for confirmation,
+  then query the market every 'refresh' seconds (default 5s) until the
+  trade's conditions are met.
+
+  Passing -dry-run logs the orders (and cancels) trades would place
+  instead of sending them to the exchange.
 
   For authorizing transactions and conducting market queries, the API
   key and secret need to be provided as environment variables. The two
@@ -39,6 +92,63 @@ const usage = `trade-bot usage:
 
   Note: You must have 2-factor authentication enabled to make new keys.
 
+  Paper trading:
+  ==============
+
+  Passing -paper runs the bot against a simulated exchange which keeps
+  virtual balances and fills orders against a price feed.  The keys
+  are not required in paper mode.
+
+    -paper-balances     -   "BTC:1,PIVX:100" or a JSON file of balances
+    -paper-feed         -   "live" (bittrex prices), "synthetic" or the
+                            path to a csv of candles to replay
+    -paper-fee          -   commission charged per fill (default 0.0025)
+    -paper-slippage     -   fraction of the price lost per fill (default 0)
+
+  Kill switch:
+  ============
+
+  'halt' pauses every session, cancels the open orders placed by the
+  bot and refuses new orders until 'rearm' is run; 'halt exit' also
+  sells every balance with a BTC market at its bid.  The state is kept
+  in the session db, so a restart stays halted.  A running server is
+  asked to act over its API, otherwise the db is updated directly.
+
+  Risk checks:
+  ============
+
+  Every order is checked before it is sent to the exchange, orders
+  which fail a check are rejected with the reason.  Notionals are in
+  BTC and a limit of 0 disables the check:
+
+    -risk-max-order        -   max notional of a single order
+    -risk-market-max-order -   max order notional for specific markets,
+                               ex: "BTC-PIVX:0.5,BTC-ETH:1"
+    -risk-max-open         -   max notional of all open orders
+    -risk-max-deviation    -   max percent a sell may be below the bid,
+                               or a buy above the ask (default 10)
+    -risk-max-daily-loss   -   buys are refused once the portfolio has
+                               lost this much since midnight (UTC)
+
+  Orders are also rejected below the market's minimum trade size, or
+  when the available balance can not cover them.
+
+  Backtesting:
+  ============
+
+  The backtest command runs a trade over recorded candles on a paper
+  exchange, using the paper balances, fee and slippage:
+
+    backtest <trade> <market> [Input=value ...]
+
+  Inputs not given on the command line are prompted for.  The trade is
+  evaluated at every candle's close and the report lists its fills,
+  P&L, max drawdown and win rate.
+
+    -backtest-candles   -   csv of candles (default: the candle store)
+    -backtest-interval  -   interval of the candles (default fiveMin)
+    -backtest-equity    -   equity curve csv (default equity.csv)
+
   If you find this software useful, help out by filing issues or
   suggestions here: https://github.com/sabhiram/trade-bot/issues.
 
@@ -63,11 +173,21 @@ func fatalOnError(err error) {
 	}
 }
 
+// usageText returns the usage string including all registered trades.
+func usageText() string {
+	cmds := ""
+	for _, n := range trade.Names() {
+		t, _ := trade.New(n)
+		cmds += fmt.Sprintf("    %-20s-   %s\n", n, t.Description)
+	}
+	return fmt.Sprintf(usage, cmds)
+}
+
 func usageErr(err error) {
 	if err != nil {
-		log.Fatalf("Usage Error: %s\n%s", err.Error(), usage)
+		log.Fatalf("Usage Error: %s\n%s", err.Error(), usageText())
 	} else {
-		fmt.Printf(usage)
+		fmt.Print(usageText())
 	}
 }
 
@@ -81,19 +201,118 @@ func getenvFatal(key string) string {
 	return v
 }
 
+// newExchange returns the exchange selected by the config, either bittrex or
+// a paper exchange using the configured price feed.
+func newExchange() (exchange.Exchange, error) {
+	live := exchange.NewBittrex(config.ApiKey, config.Secret)
+	if !config.Paper {
+		return live, nil
+	}
+
+	var feed exchange.MarketData
+	switch config.PaperFeed {
+	case "live":
+		feed = live
+	case "synthetic":
+		feed = exchange.NewSyntheticFeed(nil, 0.01, config.RefreshInterval, time.Now().UnixNano())
+	default:
+		f, err := exchange.NewReplayFeed(config.PaperFeed, config.RefreshInterval)
+		if err != nil {
+			return nil, err
+		}
+		feed = f
+	}
+
+	bs, err := exchange.LoadPaperBalances(config.PaperBalances)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Paper trading with %s prices\n", config.PaperFeed)
+	return exchange.NewPaper(feed, bs, decimal.NewFromFloat(config.PaperFee), decimal.NewFromFloat(config.PaperSlippage)), nil
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 
 func main() {
+	// Strategy files are registered alongside the built-in trades.
+	if len(config.StrategyDir) > 0 {
+		names, err := trade.LoadStrategies(config.StrategyDir)
+		fatalOnError(err)
+		log.Printf("Loaded strategies: %s\n", strings.Join(names, ", "))
+	}
+
+	cmd := strings.ToLower(config.Args[0])
+	switch cmd {
+	case "version":
+		fmt.Printf("%s\n", version)
+		return
+	case "usage", "help", "-h":
+		usageErr(nil)
+		return
+	}
+
+	// Backtests run offline against recorded candles.
+	if cmd == "backtest" {
+		fatalOnError(runBacktestCmd(config.Args[1:]))
+		return
+	}
+
+	ex, err := newExchange()
+	fatalOnError(err)
+	if config.DryRun {
+		log.Printf("Dry run: orders are logged, not placed\n")
+		ex = exchange.NewDryRun(ex)
+	}
+
+	if cmd == "candles" {
+		fatalOnError(runCandlesCmd(ex, config.Args[1:]))
+		return
+	}
+
+	if cmd == "halt" || cmd == "rearm" {
+		fatalOnError(runKillSwitchCmd(ex, cmd, config.Args[1:]))
+		return
+	}
+
+	if cmd != "server" {
+		if _, err := trade.New(cmd); err != nil {
+			usageErr(fmt.Errorf("%s is an invalid command", cmd))
+		}
+		fatalOnError(runTradeCmd(ex, cmd))
+		return
+	}
+
 	h, err := hub.New()
 	fatalOnError(err)
 	go h.Run()
 
-	a, err := app.New(&config, h)
+	a, err := app.New(&config, h, ex)
 	fatalOnError(err)
 
-	s, err := server.New(":8100", h, a)
+	s, err := server.New(listenAddr, h, a)
 	fatalOnError(err)
 
+	// Run the background refreshers until we are interrupted, then stop them
+	// and the webserver.
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		a.Run(ctx)
+		close(done)
+	}()
+
+	go func() {
+		sigCh := make(chan os.Signal, 1)
+		signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+		<-sigCh
+
+		log.Printf("Shutting down...\n")
+		cancel()
+		<-done
+		s.Shutdown(context.Background())
+	}()
+
 	s.Start()
 }
 
@@ -104,18 +323,54 @@ func init() {
 	log.SetOutput(os.Stdout)
 	log.SetFlags(0)
 
-	config.ApiKey = getenvFatal("BITTREX_API_KEY")
-	config.Secret = getenvFatal("BITTREX_SECRET")
+	config.Version = version
 
 	var refIntStr string
 	flag.StringVar(&refIntStr, "refresh", "5s", "refresh interval duration")
 	flag.StringVar(&refIntStr, "r", "5s", "refresh interval duration (short)")
 
+	flag.DurationVar(&config.BalanceInterval, "balance-refresh", 30*time.Second, "balance refresh interval (0 disables)")
+	flag.DurationVar(&config.TickerInterval, "ticker-refresh", 5*time.Second, "watched ticker refresh interval (0 disables)")
+	flag.DurationVar(&config.OrderInterval, "order-refresh", 15*time.Second, "open order refresh interval (0 disables)")
+	flag.DurationVar(&config.SnapshotInterval, "snapshot-interval", time.Hour, "portfolio snapshot interval (0 disables)")
+	flag.DurationVar(&config.OrderRetention, "order-retention", 7*24*time.Hour, "how long closed orders of finished sessions are kept (0 keeps them)")
+
 	flag.StringVar(&config.DbPath, "dbpath", "db.json", "path to session database")
 	flag.StringVar(&config.DbPath, "d", "db.json", "path to session database (short)")
 
+	flag.StringVar(&config.StrategyDir, "strategies", "", "directory of strategy files to load")
+	flag.StringVar(&config.CandleDir, "candles", "candles", "directory of the local candle store")
+	flag.StringVar(&config.SnapshotPath, "snapshots", "snapshots.jsonl", "path to the portfolio snapshot series")
+
+	flag.BoolVar(&config.DryRun, "dry-run", false, "log the orders trades would place instead of placing them")
+
+	flag.BoolVar(&config.Paper, "paper", false, "trade against a simulated exchange")
+	flag.StringVar(&config.PaperBalances, "paper-balances", "BTC:1", "initial paper balances")
+	flag.StringVar(&config.PaperFeed, "paper-feed", "live", "paper price feed (live, synthetic or csv path)")
+	flag.Float64Var(&config.PaperFee, "paper-fee", 0.0025, "paper commission per fill")
+	flag.Float64Var(&config.PaperSlippage, "paper-slippage", 0, "paper slippage per fill")
+
+	flag.Float64Var(&config.RiskMaxOrder, "risk-max-order", 0, "max BTC notional of an order (0 disables)")
+	flag.StringVar(&config.RiskMarketMaxOrder, "risk-market-max-order", "", "per market max order notional (BTC-PIVX:0.5,...)")
+	flag.Float64Var(&config.RiskMaxOpen, "risk-max-open", 0, "max BTC notional of all open orders (0 disables)")
+	flag.Float64Var(&config.RiskMaxDeviation, "risk-max-deviation", 10, "max percent below the bid or above the ask (0 disables)")
+	flag.Float64Var(&config.RiskMaxDailyLoss, "risk-max-daily-loss", 0, "max BTC lost in a day before buys are refused (0 disables)")
+
+	flag.StringVar(&config.BacktestCandles, "backtest-candles", "", "csv of candles to backtest (blank for the candle store)")
+	flag.StringVar(&config.BacktestInterval, "backtest-interval", "fiveMin", "interval of the backtested candles")
+	flag.StringVar(&config.BacktestEquity, "backtest-equity", "equity.csv", "path to write the backtest equity curve to")
+
 	flag.Parse()
 
+	// The keys are only optional when paper trading or backtesting.
+	if config.Paper || (flag.NArg() > 0 && strings.EqualFold(flag.Arg(0), "backtest")) {
+		config.ApiKey = os.Getenv("BITTREX_API_KEY")
+		config.Secret = os.Getenv("BITTREX_SECRET")
+	} else {
+		config.ApiKey = getenvFatal("BITTREX_API_KEY")
+		config.Secret = getenvFatal("BITTREX_SECRET")
+	}
+
 	var err error
 	config.RefreshInterval, err = time.ParseDuration(refIntStr)
 	if err != nil {
@@ -124,7 +379,7 @@ func init() {
 
 	config.Args = flag.Args()
 	if len(config.Args) == 0 {
-		config.Args = []string{"usage"}
+		config.Args = []string{"server"}
 	}
 }
 
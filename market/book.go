@@ -0,0 +1,246 @@
+package market
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sabhiram/trade-bot/exchange"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+var (
+	ErrNotSynced = errors.New("order book not synced")
+)
+
+// NonceGapError is returned by Book.Apply when an update does not follow the
+// last applied nonce, ie: updates were missed and the book must be resynced.
+type NonceGapError struct {
+	Expected int
+	Got      int
+}
+
+func (e *NonceGapError) Error() string {
+	return fmt.Sprintf("nonce gap: expected %d, got %d", e.Expected, e.Got)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Level is a single price level of the book along with the cumulative volume
+// of all levels up to and including it (from the best price).
+type Level struct {
+	Rate           decimal.Decimal
+	Quantity       decimal.Decimal
+	Cumulative     decimal.Decimal // cumulative quantity
+	CumulativeBase decimal.Decimal // cumulative quantity * rate
+}
+
+// Depth is the top of the book for a market, best levels first.
+type Depth struct {
+	Market string
+	Nonce  int
+	Bids   []Level
+	Asks   []Level
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Book is the local order book and last trade price of a single market, built
+// from the exchange's update stream.
+//
+// Updates carry the absolute quantity at a rate, so re-applying an update that
+// is already reflected in the book (ex: after a resync) is harmless.
+type Book struct {
+	Market    string
+	Nonce     int             // nonce of the last applied update, 0 if unknown
+	Last      decimal.Decimal // rate of the most recent fill
+	UpdatedAt time.Time
+
+	bids   map[string]exchange.OrderBookEntry // keyed by rate
+	asks   map[string]exchange.OrderBookEntry // keyed by rate
+	synced bool                               // true while the book is complete
+}
+
+// NewBook returns an empty (unsynced) book for `market`.
+func NewBook(market string) *Book {
+	return &Book{
+		Market: market,
+		bids:   map[string]exchange.OrderBookEntry{},
+		asks:   map[string]exchange.OrderBookEntry{},
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Apply updates the book with the exchange state `st`.  Initial states replace
+// the book, others are applied as deltas in nonce order.  Stale updates are
+// ignored, while updates received before the book is synced or after a gap in
+// nonces mark the book unsynced and return an error; the caller should then
+// Reset the book from a fresh snapshot.
+func (b *Book) Apply(st exchange.ExchangeState) error {
+	// Fills are reported oldest first.
+	for _, f := range st.Fills {
+		b.Last = f.Rate
+	}
+
+	switch {
+	case st.Initial:
+		b.bids = map[string]exchange.OrderBookEntry{}
+		b.asks = map[string]exchange.OrderBookEntry{}
+		b.synced = true
+	case !b.synced:
+		return ErrNotSynced
+	case b.Nonce != 0 && st.Nonce <= b.Nonce:
+		return nil
+	case b.Nonce != 0 && st.Nonce != b.Nonce+1:
+		b.synced = false
+		return &NonceGapError{Expected: b.Nonce + 1, Got: st.Nonce}
+	}
+
+	applyUpdates(b.bids, st.Buys)
+	applyUpdates(b.asks, st.Sells)
+
+	b.Nonce = st.Nonce
+	b.UpdatedAt = time.Now()
+	return nil
+}
+
+// Reset replaces the book with the snapshot `ob`.  Snapshots fetched from the
+// REST API carry no nonce, so the next update is accepted as is.
+func (b *Book) Reset(ob exchange.OrderBook) {
+	b.bids = map[string]exchange.OrderBookEntry{}
+	b.asks = map[string]exchange.OrderBookEntry{}
+	for _, e := range ob.Buy {
+		b.bids[e.Rate.String()] = e
+	}
+	for _, e := range ob.Sell {
+		b.asks[e.Rate.String()] = e
+	}
+
+	b.Nonce = 0
+	b.synced = true
+	b.UpdatedAt = time.Now()
+}
+
+// Synced returns true if the book is complete.
+func (b *Book) Synced() bool {
+	return b.synced
+}
+
+func applyUpdates(side map[string]exchange.OrderBookEntry, us []exchange.OrderUpdate) {
+	for _, u := range us {
+		k := u.Rate.String()
+		if u.Type == exchange.UpdateTypeRemove || u.Quantity.Sign() <= 0 {
+			delete(side, k)
+		} else {
+			side[k] = u.OrderBookEntry
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// BestBid returns the highest bid, false if there are none.
+func (b *Book) BestBid() (exchange.OrderBookEntry, bool) {
+	return best(b.bids, true)
+}
+
+// BestAsk returns the lowest ask, false if there are none.
+func (b *Book) BestAsk() (exchange.OrderBookEntry, bool) {
+	return best(b.asks, false)
+}
+
+// Ticker returns the best bid, best ask and last price.  The second return is
+// false if the book is not synced or no trade has been seen yet.
+func (b *Book) Ticker() (exchange.Ticker, bool) {
+	if !b.synced || b.Last.Sign() <= 0 {
+		return exchange.Ticker{}, false
+	}
+
+	t := exchange.Ticker{Last: b.Last}
+	if e, ok := b.BestBid(); ok {
+		t.Bid = e.Rate
+	}
+	if e, ok := b.BestAsk(); ok {
+		t.Ask = e.Rate
+	}
+	return t, true
+}
+
+// Depth returns the best `n` levels of each side of the book (all levels if
+// `n` <= 0) with their cumulative volume.
+func (b *Book) Depth(n int) *Depth {
+	return &Depth{
+		Market: b.Market,
+		Nonce:  b.Nonce,
+		Bids:   levels(sorted(b.bids, true), n),
+		Asks:   levels(sorted(b.asks, false), n),
+	}
+}
+
+// OrderBook returns all levels of the book, best first.
+func (b *Book) OrderBook() exchange.OrderBook {
+	return exchange.OrderBook{
+		Buy:  sorted(b.bids, true),
+		Sell: sorted(b.asks, false),
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func best(side map[string]exchange.OrderBookEntry, highest bool) (exchange.OrderBookEntry, bool) {
+	var (
+		res exchange.OrderBookEntry
+		ok  bool
+	)
+	for _, e := range side {
+		if !ok || (highest && e.Rate.GreaterThan(res.Rate)) || (!highest && e.Rate.LessThan(res.Rate)) {
+			res, ok = e, true
+		}
+	}
+	return res, ok
+}
+
+// sorted returns the entries of a book side ordered by rate, best first.
+func sorted(side map[string]exchange.OrderBookEntry, desc bool) []exchange.OrderBookEntry {
+	es := make([]exchange.OrderBookEntry, 0, len(side))
+	for _, e := range side {
+		es = append(es, e)
+	}
+	sort.Slice(es, func(i, j int) bool {
+		if desc {
+			return es[i].Rate.GreaterThan(es[j].Rate)
+		}
+		return es[i].Rate.LessThan(es[j].Rate)
+	})
+	return es
+}
+
+// levels returns up to `n` levels for the sorted entries `es`.
+func levels(es []exchange.OrderBookEntry, n int) []Level {
+	if n > 0 && len(es) > n {
+		es = es[:n]
+	}
+
+	ls := make([]Level, 0, len(es))
+	cum, cumBase := decimal.Zero, decimal.Zero
+	for _, e := range es {
+		cum = cum.Add(e.Quantity)
+		cumBase = cumBase.Add(e.Quantity.Mul(e.Rate))
+		ls = append(ls, Level{
+			Rate:           e.Rate,
+			Quantity:       e.Quantity,
+			Cumulative:     cum,
+			CumulativeBase: cumBase,
+		})
+	}
+	return ls
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,231 @@
+package market
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sabhiram/trade-bot/exchange"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+func dec(s string) decimal.Decimal {
+	d, err := decimal.NewFromString(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func entry(rate, quantity string) exchange.OrderBookEntry {
+	return exchange.OrderBookEntry{Rate: dec(rate), Quantity: dec(quantity)}
+}
+
+func update(typ int, rate, quantity string) exchange.OrderUpdate {
+	return exchange.OrderUpdate{OrderBookEntry: entry(rate, quantity), Type: typ}
+}
+
+// synced returns a book synced from an initial state at `nonce` with bids at
+// 0.001 (5) and 0.0009 (3), and an ask at 0.0011 (2).
+func synced(t *testing.T, nonce int) *Book {
+	b := NewBook("BTC-PIVX")
+	err := b.Apply(exchange.ExchangeState{
+		Nonce:   nonce,
+		Initial: true,
+		Buys: []exchange.OrderUpdate{
+			update(exchange.UpdateTypeAdd, "0.001", "5"),
+			update(exchange.UpdateTypeAdd, "0.0009", "3"),
+		},
+		Sells: []exchange.OrderUpdate{
+			update(exchange.UpdateTypeAdd, "0.0011", "2"),
+		},
+		Fills: []exchange.Fill{{OrderBookEntry: entry("0.00105", "1")}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	return b
+}
+
+// checkSide fails `t` unless the `levels` have the rates and quantities of the
+// entries `want`, in order.
+func checkSide(t *testing.T, name string, levels []Level, want ...exchange.OrderBookEntry) {
+	t.Helper()
+	if len(levels) != len(want) {
+		t.Fatalf("%s: expected %d levels, got %d", name, len(want), len(levels))
+	}
+	for i, l := range levels {
+		if !l.Rate.Equal(want[i].Rate) || !l.Quantity.Equal(want[i].Quantity) {
+			t.Fatalf("%s[%d]: expected %s @ %s, got %s @ %s", name, i, want[i].Quantity, want[i].Rate, l.Quantity, l.Rate)
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func TestBookNotSynced(t *testing.T) {
+	b := NewBook("BTC-PIVX")
+	err := b.Apply(exchange.ExchangeState{
+		Nonce: 1,
+		Buys:  []exchange.OrderUpdate{update(exchange.UpdateTypeAdd, "0.001", "5")},
+	})
+	if err != ErrNotSynced {
+		t.Fatalf("expected ErrNotSynced, got %v", err)
+	}
+	if b.Synced() || b.Nonce != 0 {
+		t.Fatalf("expected an unsynced book, got synced %t at nonce %d", b.Synced(), b.Nonce)
+	}
+	if _, ok := b.BestBid(); ok {
+		t.Fatalf("expected the update to be dropped")
+	}
+	if _, ok := b.Ticker(); ok {
+		t.Fatalf("expected no ticker for an unsynced book")
+	}
+}
+
+func TestBookInitial(t *testing.T) {
+	b := synced(t, 10)
+
+	if !b.Synced() || b.Nonce != 10 {
+		t.Fatalf("expected a synced book at nonce 10, got synced %t at nonce %d", b.Synced(), b.Nonce)
+	}
+	tk, ok := b.Ticker()
+	if !ok || !tk.Bid.Equal(dec("0.001")) || !tk.Ask.Equal(dec("0.0011")) || !tk.Last.Equal(dec("0.00105")) {
+		t.Fatalf("unexpected ticker %#v (%t)", tk, ok)
+	}
+
+	d := b.Depth(0)
+	checkSide(t, "bids", d.Bids, entry("0.001", "5"), entry("0.0009", "3"))
+	checkSide(t, "asks", d.Asks, entry("0.0011", "2"))
+	if l := d.Bids[1]; !l.Cumulative.Equal(dec("8")) || !l.CumulativeBase.Equal(dec("0.0077")) {
+		t.Fatalf("unexpected cumulative volume %s (%s BTC)", l.Cumulative, l.CumulativeBase)
+	}
+	checkSide(t, "top bid", b.Depth(1).Bids, entry("0.001", "5"))
+}
+
+func TestBookApplyInOrder(t *testing.T) {
+	b := synced(t, 10)
+	err := b.Apply(exchange.ExchangeState{
+		Nonce: 11,
+		Buys: []exchange.OrderUpdate{
+			update(exchange.UpdateTypeUpdate, "0.001", "7"),
+			update(exchange.UpdateTypeRemove, "0.0009", "0"),
+		},
+		Sells: []exchange.OrderUpdate{
+			update(exchange.UpdateTypeAdd, "0.00105", "1"),
+			update(exchange.UpdateTypeUpdate, "0.0011", "0"), // zero quantity removes
+		},
+		Fills: []exchange.Fill{
+			{OrderBookEntry: entry("0.00101", "1")},
+			{OrderBookEntry: entry("0.00102", "1")},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	if b.Nonce != 11 || !b.Last.Equal(dec("0.00102")) {
+		t.Fatalf("expected nonce 11 and the latest fill, got %d and %s", b.Nonce, b.Last)
+	}
+	d := b.Depth(0)
+	checkSide(t, "bids", d.Bids, entry("0.001", "7"))
+	checkSide(t, "asks", d.Asks, entry("0.00105", "1"))
+}
+
+func TestBookStaleUpdates(t *testing.T) {
+	b := synced(t, 10)
+	if err := b.Apply(exchange.ExchangeState{Nonce: 11}); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	// Duplicate and older updates are dropped without unsyncing the book.
+	for _, nonce := range []int{11, 10, 3} {
+		err := b.Apply(exchange.ExchangeState{
+			Nonce: nonce,
+			Buys:  []exchange.OrderUpdate{update(exchange.UpdateTypeAdd, "0.002", "1")},
+		})
+		if err != nil {
+			t.Fatalf("nonce %d: unexpected error: %s", nonce, err.Error())
+		}
+	}
+	if !b.Synced() || b.Nonce != 11 {
+		t.Fatalf("expected a synced book at nonce 11, got synced %t at nonce %d", b.Synced(), b.Nonce)
+	}
+	checkSide(t, "bids", b.Depth(0).Bids, entry("0.001", "5"), entry("0.0009", "3"))
+}
+
+func TestBookNonceGap(t *testing.T) {
+	b := synced(t, 10)
+	err := b.Apply(exchange.ExchangeState{
+		Nonce: 12,
+		Buys:  []exchange.OrderUpdate{update(exchange.UpdateTypeAdd, "0.002", "1")},
+	})
+	gap, ok := err.(*NonceGapError)
+	if !ok || gap.Expected != 11 || gap.Got != 12 {
+		t.Fatalf("expected a gap from 11 to 12, got %v", err)
+	}
+	if b.Synced() || b.Nonce != 10 {
+		t.Fatalf("expected an unsynced book at nonce 10, got synced %t at nonce %d", b.Synced(), b.Nonce)
+	}
+	checkSide(t, "bids", b.Depth(0).Bids, entry("0.001", "5"), entry("0.0009", "3"))
+
+	// Nothing is applied until the book is synced again, not even the update
+	// which was missed.
+	if err := b.Apply(exchange.ExchangeState{Nonce: 11}); err != ErrNotSynced {
+		t.Fatalf("expected ErrNotSynced, got %v", err)
+	}
+
+	// A new initial state replaces the book.
+	err = b.Apply(exchange.ExchangeState{
+		Nonce:   20,
+		Initial: true,
+		Buys:    []exchange.OrderUpdate{update(exchange.UpdateTypeAdd, "0.0008", "4")},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if !b.Synced() || b.Nonce != 20 {
+		t.Fatalf("expected a synced book at nonce 20, got synced %t at nonce %d", b.Synced(), b.Nonce)
+	}
+	d := b.Depth(0)
+	checkSide(t, "bids", d.Bids, entry("0.0008", "4"))
+	checkSide(t, "asks", d.Asks)
+}
+
+func TestBookReset(t *testing.T) {
+	b := synced(t, 10)
+	if err := b.Apply(exchange.ExchangeState{Nonce: 15}); err == nil {
+		t.Fatalf("expected a nonce gap")
+	}
+
+	b.Reset(exchange.OrderBook{
+		Buy:  []exchange.OrderBookEntry{entry("0.00095", "6")},
+		Sell: []exchange.OrderBookEntry{entry("0.00097", "1"), entry("0.00096", "2")},
+	})
+	if !b.Synced() || b.Nonce != 0 {
+		t.Fatalf("expected a synced book without a nonce, got synced %t at nonce %d", b.Synced(), b.Nonce)
+	}
+	checkSide(t, "asks", b.Depth(0).Asks, entry("0.00096", "2"), entry("0.00097", "1"))
+
+	// Snapshots carry no nonce, so the next update is accepted as is and
+	// those after it must follow it.
+	err := b.Apply(exchange.ExchangeState{
+		Nonce: 14,
+		Buys:  []exchange.OrderUpdate{update(exchange.UpdateTypeAdd, "0.00094", "1")},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if err := b.Apply(exchange.ExchangeState{Nonce: 15}); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if err := b.Apply(exchange.ExchangeState{Nonce: 17}); err == nil {
+		t.Fatalf("expected a nonce gap")
+	}
+	checkSide(t, "bids", b.Depth(0).Bids, entry("0.00095", "6"), entry("0.00094", "1"))
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,297 @@
+// Package market streams live market data from the exchange and maintains a
+// local order book and last trade price for each subscribed market.
+package market
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sabhiram/trade-bot/exchange"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+const (
+	minBackoff = 1 * time.Second
+	maxBackoff = 2 * time.Minute
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// UpdateFunc is called with the new ticker of `market` whenever it changes.
+type UpdateFunc func(market string, t exchange.Ticker)
+
+// FillFunc is called with the trades streamed for `market`.
+type FillFunc func(market string, fs []exchange.Fill)
+
+// stream is the subscription to a single market.
+type stream struct {
+	refs   int                        // number of watchers
+	book   *Book                      // local book, guarded by the service
+	ticker exchange.Ticker            // last ticker published
+	wake   map[chan struct{}]struct{} // notified on ticker changes
+	stop   chan bool
+	done   chan struct{}
+
+	resyncedAt time.Time // last time the book was resynced
+}
+
+// Service subscribes to exchange updates for the markets it is asked to watch.
+type Service struct {
+	sync.Mutex // guards streams (and their books)
+
+	md       exchange.MarketData
+	onUpdate UpdateFunc
+	streams  map[string]*stream
+
+	// OnFills (if set) is called with the trades of every streamed update
+	// after the initial one, it must be set before any market is watched.
+	OnFills FillFunc
+}
+
+// New returns a market data service streaming from `md`.  `fn` (if set) is
+// called every time the ticker of a watched market changes.
+func New(md exchange.MarketData, fn UpdateFunc) *Service {
+	return &Service{
+		md:       md,
+		onUpdate: fn,
+		streams:  map[string]*stream{},
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Watch subscribes to `market` if it is not already streaming.  Every call to
+// Watch must be matched by a call to Unwatch.
+func (s *Service) Watch(market string) {
+	market = strings.ToUpper(market)
+
+	s.Lock()
+	defer s.Unlock()
+
+	if st, ok := s.streams[market]; ok {
+		st.refs++
+		return
+	}
+
+	st := &stream{
+		refs: 1,
+		book: NewBook(market),
+		wake: map[chan struct{}]struct{}{},
+		stop: make(chan bool),
+		done: make(chan struct{}),
+	}
+	s.streams[market] = st
+	go s.run(market, st)
+}
+
+// Unwatch releases a watch on `market`, the subscription is closed once the
+// last watcher is gone.
+func (s *Service) Unwatch(market string) {
+	market = strings.ToUpper(market)
+
+	s.Lock()
+	st, ok := s.streams[market]
+	if ok {
+		st.refs--
+		if st.refs > 0 {
+			ok = false
+		} else {
+			delete(s.streams, market)
+		}
+	}
+	s.Unlock()
+
+	if ok {
+		close(st.stop)
+		<-st.done
+	}
+}
+
+// Close stops all subscriptions.
+func (s *Service) Close() {
+	s.Lock()
+	ms := []string{}
+	for m, st := range s.streams {
+		st.refs = 1
+		ms = append(ms, m)
+	}
+	s.Unlock()
+
+	for _, m := range ms {
+		s.Unwatch(m)
+	}
+}
+
+// Ticker returns the streamed ticker for `market`.  The second return is
+// false if the market is not streaming or has not received a snapshot yet.
+func (s *Service) Ticker(market string) (exchange.Ticker, bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	st, ok := s.streams[strings.ToUpper(market)]
+	if !ok {
+		return exchange.Ticker{}, false
+	}
+	return st.book.Ticker()
+}
+
+// Depth returns the best `n` levels of the streamed book for `market`.  The
+// second return is false if the market is not streaming or its book is not
+// synced.
+func (s *Service) Depth(market string, n int) (*Depth, bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	st, ok := s.streams[strings.ToUpper(market)]
+	if !ok || !st.book.Synced() {
+		return nil, false
+	}
+	return st.book.Depth(n), true
+}
+
+// OrderBook returns the full streamed book for `market`.  The second return
+// is false if the market is not streaming or its book is not synced.
+func (s *Service) OrderBook(market string) (exchange.OrderBook, bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	st, ok := s.streams[strings.ToUpper(market)]
+	if !ok || !st.book.Synced() {
+		return exchange.OrderBook{}, false
+	}
+	return st.book.OrderBook(), true
+}
+
+// Wake returns a channel which receives whenever the ticker of `market`
+// changes along with a function to release it.  The market must be watched.
+func (s *Service) Wake(market string) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	s.Lock()
+	st, ok := s.streams[strings.ToUpper(market)]
+	if ok {
+		st.wake[ch] = struct{}{}
+	}
+	s.Unlock()
+
+	return ch, func() {
+		if ok {
+			s.Lock()
+			delete(st.wake, ch)
+			s.Unlock()
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// run keeps `market` subscribed until it is unwatched, reconnecting with an
+// exponential backoff whenever the subscription fails.
+func (s *Service) run(market string, st *stream) {
+	defer close(st.done)
+
+	backoff := minBackoff
+	for {
+		dataCh := make(chan exchange.ExchangeState, 64)
+		errCh := make(chan error, 1)
+		go func() {
+			errCh <- s.md.SubscribeExchangeUpdate(market, dataCh, st.stop)
+		}()
+
+	recv:
+		for {
+			select {
+			case es := <-dataCh:
+				s.apply(market, st, es)
+				backoff = minBackoff
+			case err := <-errCh:
+				if err == nil {
+					log.Printf("Market %s :: disconnected\n", market)
+				} else {
+					log.Printf("Market %s :: subscription failed :: %s\n", market, err.Error())
+				}
+				break recv
+			case <-st.stop:
+				return
+			}
+		}
+
+		// The book goes stale while disconnected.
+		s.Lock()
+		st.book.synced = false
+		s.Unlock()
+
+		log.Printf("Market %s :: reconnecting in %s\n", market, backoff)
+		select {
+		case <-time.After(backoff):
+		case <-st.stop:
+			return
+		}
+
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// apply updates the book of `st` (resyncing it if needed) and publishes the
+// ticker if it changed.
+func (s *Service) apply(market string, st *stream, es exchange.ExchangeState) {
+	s.Lock()
+	err := st.book.Apply(es)
+	s.Unlock()
+
+	if err != nil {
+		s.resync(market, st, err)
+	}
+
+	s.Lock()
+	t, ok := st.book.Ticker()
+	changed := ok && !t.Equal(st.ticker)
+	if changed {
+		st.ticker = t
+		for ch := range st.wake {
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+	}
+	s.Unlock()
+
+	if changed && s.onUpdate != nil {
+		s.onUpdate(market, t)
+	}
+	if len(es.Fills) > 0 && !es.Initial && s.OnFills != nil {
+		s.OnFills(market, es.Fills)
+	}
+}
+
+// resync replaces the book of `st` with a snapshot from the exchange.  Resyncs
+// are attempted at most once every `minBackoff`, until then the book stays
+// unsynced and its ticker unavailable.
+func (s *Service) resync(market string, st *stream, cause error) {
+	if time.Since(st.resyncedAt) < minBackoff {
+		return
+	}
+	st.resyncedAt = time.Now()
+
+	log.Printf("Market %s :: resyncing book :: %s\n", market, cause.Error())
+	ob, err := s.md.GetOrderBook(market)
+	if err != nil {
+		log.Printf("Market %s :: unable to resync book :: %s\n", market, err.Error())
+		return
+	}
+
+	s.Lock()
+	st.book.Reset(ob)
+	s.Unlock()
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,367 @@
+// Package orders tracks the orders placed by the bot through their lifecycle
+// on the exchange, from being placed until they are filled or cancelled.
+package orders
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sabhiram/trade-bot/exchange"
+	"github.com/sabhiram/trade-bot/types"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+const (
+	// minWakeInterval limits how often a market's orders are refreshed due
+	// to streamed fills.
+	minWakeInterval = time.Second
+)
+
+var (
+	ErrOrderNotFound = errors.New("order not tracked")
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Event is emitted when a tracked order is placed, fills or closes.
+type Event struct {
+	Order    *types.Order
+	Previous types.OrderState // empty for orders which were just tracked
+}
+
+// EventFunc is called with every event of the manager.
+type EventFunc func(e Event)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Manager records the orders placed by the bot and follows them on the
+// exchange.  Open orders are refreshed with GetOrder when polled, or when the
+// manager is woken by fills streamed for their market.
+type Manager struct {
+	sync.Mutex // guards orders and polled
+
+	ex      exchange.Exchange
+	onEvent EventFunc
+	orders  map[string]*types.Order // keyed by UUID
+	polled  map[string]time.Time    // last wake of each market
+	wake    chan string
+}
+
+// New returns a manager following orders on `ex`, which resumes tracking the
+// orders `tracked` (ex: from the db).  `fn` (if set) is called with every
+// event.
+func New(ex exchange.Exchange, tracked []*types.Order, fn EventFunc) *Manager {
+	m := &Manager{
+		ex:      ex,
+		onEvent: fn,
+		orders:  map[string]*types.Order{},
+		polled:  map[string]time.Time{},
+		wake:    make(chan string, 16),
+	}
+	for _, o := range tracked {
+		m.orders[o.UUID] = o.Clone()
+	}
+	return m
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Exchange returns `ex` with the orders placed through it tracked on behalf
+// of `session`, and the orders fetched through it refreshed.
+func (m *Manager) Exchange(ex exchange.Exchange, session types.UUID) exchange.Exchange {
+	return &recorder{Exchange: ex, m: m, session: session}
+}
+
+// recorder tracks the orders placed through its exchange.
+type recorder struct {
+	exchange.Exchange
+	m       *Manager
+	session types.UUID
+}
+
+func (r *recorder) BuyLimit(market string, quantity, rate decimal.Decimal) (string, error) {
+	uuid, err := r.Exchange.BuyLimit(market, quantity, rate)
+	if err == nil {
+		r.m.Track(r.session, uuid, market, exchange.OrderTypeLimitBuy, quantity, rate)
+	}
+	return uuid, err
+}
+
+func (r *recorder) SellLimit(market string, quantity, rate decimal.Decimal) (string, error) {
+	uuid, err := r.Exchange.SellLimit(market, quantity, rate)
+	if err == nil {
+		r.m.Track(r.session, uuid, market, exchange.OrderTypeLimitSell, quantity, rate)
+	}
+	return uuid, err
+}
+
+func (r *recorder) GetOrder(uuid string) (exchange.Order, error) {
+	o, err := r.Exchange.GetOrder(uuid)
+	if err == nil {
+		r.m.update(o)
+	}
+	return o, err
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Track records the order `uuid` which `session` just placed.
+func (m *Manager) Track(session types.UUID, uuid, market, typ string, quantity, limit decimal.Decimal) {
+	now := time.Now()
+	o := &types.Order{
+		UUID:      uuid,
+		Session:   session,
+		Market:    strings.ToUpper(market),
+		Type:      typ,
+		Quantity:  quantity.Round(8),
+		Limit:     limit.Round(8),
+		State:     types.OrderOpen,
+		PlacedAt:  now,
+		UpdatedAt: now,
+	}
+	m.add(o)
+}
+
+// Adopt starts tracking the exchange order `o` on behalf of `session`, ex:
+// an order which was placed before the manager knew of it.  Orders which are
+// already tracked are refreshed instead.
+func (m *Manager) Adopt(session types.UUID, o exchange.Order) *types.Order {
+	if ret, ok := m.update(o); ok {
+		return ret
+	}
+
+	ret := &types.Order{
+		UUID:     o.UUID,
+		Session:  session,
+		Market:   strings.ToUpper(o.Market),
+		Type:     o.Type,
+		Limit:    o.Limit,
+		PlacedAt: o.Opened,
+	}
+	if ret.PlacedAt.IsZero() {
+		ret.PlacedAt = time.Now()
+	}
+	apply(ret, o)
+	return m.add(ret)
+}
+
+// Refresh fetches the order `uuid` from the exchange and updates its state,
+// orders which are not yet tracked are adopted by `session`.
+func (m *Manager) Refresh(session types.UUID, uuid string) (*types.Order, error) {
+	o, err := m.ex.GetOrder(uuid)
+	if err != nil {
+		return nil, err
+	}
+	return m.Adopt(session, o), nil
+}
+
+// Poll refreshes every open order.
+func (m *Manager) Poll() error {
+	m.poll("")
+	return nil
+}
+
+// Wake asks the manager to refresh the open orders in `market`, ex: because
+// fills were streamed for it.  It does not block.
+func (m *Manager) Wake(market string) {
+	select {
+	case m.wake <- strings.ToUpper(market):
+	default:
+	}
+}
+
+// Run refreshes the orders of the markets the manager is woken for until
+// `ctx` is cancelled.
+func (m *Manager) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case market := <-m.wake:
+			m.Lock()
+			due := time.Since(m.polled[market]) >= minWakeInterval
+			if due {
+				m.polled[market] = time.Now()
+			}
+			m.Unlock()
+
+			if due {
+				m.poll(market)
+			}
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Get returns a copy of the tracked order `uuid`.
+func (m *Manager) Get(uuid string) (*types.Order, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	o, ok := m.orders[uuid]
+	if !ok {
+		return nil, ErrOrderNotFound
+	}
+	return o.Clone(), nil
+}
+
+// List returns copies of the orders placed by `session` (or all tracked
+// orders if it is empty), oldest first.
+func (m *Manager) List(session types.UUID) []*types.Order {
+	m.Lock()
+	ret := []*types.Order{}
+	for _, o := range m.orders {
+		if len(session) == 0 || o.Session == session {
+			ret = append(ret, o.Clone())
+		}
+	}
+	m.Unlock()
+
+	sort.Slice(ret, func(i, j int) bool { return ret[i].PlacedAt.Before(ret[j].PlacedAt) })
+	return ret
+}
+
+// Prune stops tracking the orders which closed before `before`, unless the
+// session which placed them is `active`.  It returns the UUIDs of the orders
+// no longer tracked.
+func (m *Manager) Prune(before time.Time, active func(session types.UUID) bool) []string {
+	m.Lock()
+	defer m.Unlock()
+
+	ret := []string{}
+	for uuid, o := range m.orders {
+		if o.IsOpen() || !o.ClosedAt.Before(before) || (len(o.Session) > 0 && active(o.Session)) {
+			continue
+		}
+		delete(m.orders, uuid)
+		ret = append(ret, uuid)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// add tracks the order `o` (unless it already is) and emits its event.  It
+// returns a copy of the tracked order.
+func (m *Manager) add(o *types.Order) *types.Order {
+	m.Lock()
+	if cur, ok := m.orders[o.UUID]; ok {
+		m.Unlock()
+		return cur.Clone()
+	}
+	m.orders[o.UUID] = o
+	ret := o.Clone()
+	m.Unlock()
+
+	m.emit(Event{Order: ret.Clone()})
+	return ret
+}
+
+// update applies the exchange's view `o` of a tracked order, emitting an event
+// if it changed.  It returns a copy of the order and false if the order is not
+// tracked.
+func (m *Manager) update(o exchange.Order) (*types.Order, bool) {
+	m.Lock()
+	cur, ok := m.orders[o.UUID]
+	if !ok {
+		m.Unlock()
+		return nil, false
+	}
+
+	prev := cur.State
+	next := cur.Clone()
+	apply(next, o)
+	changed := next.State != prev ||
+		!next.QuantityFilled.Equal(cur.QuantityFilled) ||
+		!next.Commission.Equal(cur.Commission)
+	if changed {
+		*cur = *next
+	}
+	ret := cur.Clone()
+	m.Unlock()
+
+	if changed {
+		m.emit(Event{Order: ret.Clone(), Previous: prev})
+	}
+	return ret, true
+}
+
+// poll refreshes the open orders in `market` (or all markets if empty).
+func (m *Manager) poll(market string) {
+	m.Lock()
+	uuids := []string{}
+	for _, o := range m.orders {
+		if o.IsOpen() && (len(market) == 0 || o.Market == market) {
+			uuids = append(uuids, o.UUID)
+		}
+	}
+	m.Unlock()
+
+	for _, uuid := range uuids {
+		o, err := m.ex.GetOrder(uuid)
+		if err != nil {
+			log.Printf("Orders :: unable to get order %s :: %s\n", uuid, err.Error())
+			continue
+		}
+		m.update(o)
+	}
+}
+
+func (m *Manager) emit(e Event) {
+	if m.onEvent != nil {
+		m.onEvent(e)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// apply copies the fills and state of the exchange order `o` into `rec`.
+func apply(rec *types.Order, o exchange.Order) {
+	filled := o.Quantity.Sub(o.QuantityRemaining)
+	if o.Quantity.Sign() > 0 {
+		rec.Quantity = o.Quantity
+	}
+	rec.QuantityFilled = filled
+	rec.Commission = o.CommissionPaid
+
+	// Bittrex only reports the price per unit of closed orders.
+	switch {
+	case o.PricePerUnit.Sign() > 0:
+		rec.AveragePrice = o.PricePerUnit
+	case filled.Sign() > 0:
+		rec.AveragePrice = o.Price.Div(filled).Round(8)
+	}
+
+	switch {
+	case o.IsOpen && filled.Sign() > 0:
+		rec.State = types.OrderPartiallyFilled
+	case o.IsOpen:
+		rec.State = types.OrderOpen
+	case o.QuantityRemaining.Sign() <= 0:
+		rec.State = types.OrderFilled
+	default:
+		rec.State = types.OrderCancelled
+	}
+
+	rec.UpdatedAt = time.Now()
+	if !o.IsOpen {
+		rec.ClosedAt = o.Closed
+		if rec.ClosedAt.IsZero() {
+			rec.ClosedAt = rec.UpdatedAt
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,252 @@
+package orders
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sabhiram/trade-bot/exchange"
+	"github.com/sabhiram/trade-bot/types"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// stubExchange serves the orders set by the test and places orders with
+// sequential UUIDs.  Calls it does not implement panic.
+type stubExchange struct {
+	exchange.Exchange
+	orders map[string]exchange.Order
+	placed int
+}
+
+func newStubExchange() *stubExchange {
+	return &stubExchange{orders: map[string]exchange.Order{}}
+}
+
+func (e *stubExchange) SellLimit(market string, quantity, rate decimal.Decimal) (string, error) {
+	e.placed++
+	uuid := "ORDER-" + string(rune('0'+e.placed))
+	e.orders[uuid] = exchange.Order{
+		UUID:              uuid,
+		Market:            market,
+		Type:              exchange.OrderTypeLimitSell,
+		Quantity:          quantity,
+		QuantityRemaining: quantity,
+		Limit:             rate,
+		IsOpen:            true,
+	}
+	return uuid, nil
+}
+
+func (e *stubExchange) GetOrder(uuid string) (exchange.Order, error) {
+	o, ok := e.orders[uuid]
+	if !ok {
+		return exchange.Order{}, errors.New("INVALID_ORDER")
+	}
+	return o, nil
+}
+
+func dec(s string) decimal.Decimal {
+	d, err := decimal.NewFromString(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// order returns an exchange order of 10 @ 0.001 with `remaining` unfilled.
+func order(uuid, remaining string, open bool) exchange.Order {
+	return exchange.Order{
+		UUID:              uuid,
+		Market:            "BTC-PIVX",
+		Type:              exchange.OrderTypeLimitSell,
+		Quantity:          dec("10"),
+		QuantityRemaining: dec(remaining),
+		Limit:             dec("0.001"),
+		IsOpen:            open,
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func TestApply(t *testing.T) {
+	closed := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		name    string
+		order   func() exchange.Order
+		state   types.OrderState
+		filled  string
+		average string
+	}{
+		{"open", func() exchange.Order {
+			return order("A", "10", true)
+		}, types.OrderOpen, "0", "0"},
+		// Open orders only report the total price of their fills.
+		{"partially filled", func() exchange.Order {
+			o := order("A", "6", true)
+			o.Price = dec("0.0041")
+			return o
+		}, types.OrderPartiallyFilled, "4", "0.001025"},
+		{"filled", func() exchange.Order {
+			o := order("A", "0", false)
+			o.Price, o.PricePerUnit, o.CommissionPaid = dec("0.0103"), dec("0.00103"), dec("0.00002575")
+			o.Closed = closed
+			return o
+		}, types.OrderFilled, "10", "0.00103"},
+		{"cancelled", func() exchange.Order {
+			o := order("A", "7", false)
+			o.Price = dec("0.003")
+			o.Closed = closed
+			return o
+		}, types.OrderCancelled, "3", "0.001"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			o := tc.order()
+			rec := &types.Order{UUID: o.UUID}
+			apply(rec, o)
+
+			if rec.State != tc.state || !rec.QuantityFilled.Equal(dec(tc.filled)) || !rec.AveragePrice.Equal(dec(tc.average)) {
+				t.Fatalf("expected %s with %s filled @ %s, got %s with %s filled @ %s",
+					tc.state, tc.filled, tc.average, rec.State, rec.QuantityFilled, rec.AveragePrice)
+			}
+			if !rec.Quantity.Equal(dec("10")) || !rec.Commission.Equal(o.CommissionPaid) {
+				t.Fatalf("unexpected quantity %s and commission %s", rec.Quantity, rec.Commission)
+			}
+			if rec.IsOpen() != o.IsOpen || (!o.IsOpen && !rec.ClosedAt.Equal(closed)) {
+				t.Fatalf("expected closed at %s, got %s", closed, rec.ClosedAt)
+			}
+		})
+	}
+}
+
+func TestApplyClosedWithoutTime(t *testing.T) {
+	rec := &types.Order{}
+	apply(rec, order("A", "10", false))
+	if rec.State != types.OrderCancelled || rec.ClosedAt.IsZero() {
+		t.Fatalf("expected a cancel at the time of the update, got %s at %s", rec.State, rec.ClosedAt)
+	}
+}
+
+func TestManagerLifecycle(t *testing.T) {
+	ex := newStubExchange()
+	events := []Event{}
+	m := New(ex, nil, func(e Event) {
+		events = append(events, e)
+	})
+	recorded := m.Exchange(ex, "SESSION")
+
+	uuid, err := recorded.SellLimit("btc-pivx", dec("10"), dec("0.001"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	o, err := m.Get(uuid)
+	if err != nil || o.Session != "SESSION" || o.Market != "BTC-PIVX" || o.State != types.OrderOpen {
+		t.Fatalf("expected an open order of the session, got %#v (%v)", o, err)
+	}
+
+	// Fetching the order through the exchange refreshes it, emitting events
+	// only when it changes.
+	ex.orders[uuid] = order(uuid, "4", true)
+	for i := 0; i < 2; i++ {
+		if _, err := recorded.GetOrder(uuid); err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+	}
+
+	// Polls only refresh open orders.
+	ex.orders[uuid] = order(uuid, "0", false)
+	if err := m.Poll(); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	delete(ex.orders, uuid)
+	m.Poll()
+
+	want := []types.OrderState{"", types.OrderOpen, types.OrderPartiallyFilled}
+	if len(events) != len(want) {
+		t.Fatalf("expected %d events, got %d", len(want), len(events))
+	}
+	for i, e := range events {
+		if e.Previous != want[i] {
+			t.Fatalf("event %d: expected a change from %q, got %q", i, want[i], e.Previous)
+		}
+	}
+	if o, _ := m.Get(uuid); o.State != types.OrderFilled || !o.QuantityFilled.Equal(dec("10")) {
+		t.Fatalf("expected the order to be filled, got %s", o.State)
+	}
+}
+
+func TestManagerAdopt(t *testing.T) {
+	ex := newStubExchange()
+	m := New(ex, []*types.Order{{UUID: "KNOWN", Session: "OLD", Market: "BTC-PIVX", State: types.OrderOpen}}, nil)
+
+	// Orders not yet tracked are adopted by the session.
+	opened := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	o := order("NEW", "10", true)
+	o.Opened = opened
+	rec := m.Adopt("SESSION", o)
+	if rec.Session != "SESSION" || rec.State != types.OrderOpen || !rec.PlacedAt.Equal(opened) {
+		t.Fatalf("expected the order to be adopted, got %#v", rec)
+	}
+
+	// Tracked orders are refreshed and keep their session.
+	rec = m.Adopt("SESSION", order("KNOWN", "0", false))
+	if rec.Session != "OLD" || rec.State != types.OrderFilled {
+		t.Fatalf("expected the tracked order to be refreshed, got %#v", rec)
+	}
+	if n := len(m.List("")); n != 2 {
+		t.Fatalf("expected 2 tracked orders, got %d", n)
+	}
+	if adopted := m.List("SESSION"); len(adopted) != 1 || adopted[0].UUID != "NEW" {
+		t.Fatalf("expected only the adopted order for the session, got %d", len(adopted))
+	}
+}
+
+func TestManagerRefresh(t *testing.T) {
+	ex := newStubExchange()
+	m := New(ex, nil, nil)
+
+	ex.orders["A"] = order("A", "5", true)
+	rec, err := m.Refresh("SESSION", "A")
+	if err != nil || rec.Session != "SESSION" || rec.State != types.OrderPartiallyFilled {
+		t.Fatalf("expected the order to be adopted, got %#v (%v)", rec, err)
+	}
+	if _, err := m.Refresh("SESSION", "MISSING"); err == nil {
+		t.Fatalf("expected an error for an unknown order")
+	}
+	if _, err := m.Get("MISSING"); err != ErrOrderNotFound {
+		t.Fatalf("expected ErrOrderNotFound, got %v", err)
+	}
+}
+
+func TestManagerPrune(t *testing.T) {
+	now := time.Now()
+	old, recent := now.Add(-48*time.Hour), now.Add(-time.Hour)
+	m := New(newStubExchange(), []*types.Order{
+		{UUID: "OLD-FINISHED", Session: "FINISHED", State: types.OrderFilled, ClosedAt: old},
+		{UUID: "OLD-ACTIVE", Session: "ACTIVE", State: types.OrderCancelled, ClosedAt: old},
+		{UUID: "OLD-ADOPTED", State: types.OrderFilled, ClosedAt: old},
+		{UUID: "RECENT", Session: "FINISHED", State: types.OrderFilled, ClosedAt: recent},
+		{UUID: "OPEN", Session: "FINISHED", State: types.OrderPartiallyFilled},
+	}, nil)
+
+	pruned := m.Prune(now.Add(-24*time.Hour), func(id types.UUID) bool {
+		return id == "ACTIVE"
+	})
+	if len(pruned) != 2 || pruned[0] != "OLD-ADOPTED" || pruned[1] != "OLD-FINISHED" {
+		t.Fatalf("expected the old orders of finished sessions to be pruned, got %v", pruned)
+	}
+	for _, uuid := range []string{"OLD-ACTIVE", "RECENT", "OPEN"} {
+		if _, err := m.Get(uuid); err != nil {
+			t.Fatalf("expected %s to be kept", uuid)
+		}
+	}
+	if _, err := m.Get("OLD-FINISHED"); err != ErrOrderNotFound {
+		t.Fatalf("expected OLD-FINISHED to be pruned, got %v", err)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
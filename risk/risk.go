@@ -0,0 +1,316 @@
+// Package risk checks every order before it is sent to the exchange against
+// position limits, the market's prices and the balances available, so that a
+// mistyped input can not dump a balance far from the market.
+package risk
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sabhiram/trade-bot/exchange"
+	"github.com/sabhiram/trade-bot/types"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+const (
+	marketsTTL = time.Hour // how long the markets' min trade sizes are cached
+)
+
+var (
+	hundred = decimal.New(100, 0)
+
+	// bittrexFee is the commission charged on every bittrex fill.
+	bittrexFee = decimal.New(25, -4)
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Limits are the limits every order is checked against.  Zero limits are not
+// enforced.  Amounts are in BTC.
+type Limits struct {
+	MaxOrder       decimal.Decimal            // notional of a single order
+	MarketMaxOrder map[string]decimal.Decimal // MaxOrder for specific markets
+	MaxOpen        decimal.Decimal            // notional of all open orders
+	MaxDeviation   decimal.Decimal            // percent below the bid (sells) or above the ask (buys)
+	MaxDailyLoss   decimal.Decimal            // loss since the start of the (UTC) day, buys only
+	Fee            decimal.Decimal            // commission held by buys
+}
+
+// NewLimits returns the limits set by the config `c`.
+func NewLimits(c *types.Config) (*Limits, error) {
+	l := &Limits{
+		MaxOrder:       decimal.NewFromFloat(c.RiskMaxOrder),
+		MarketMaxOrder: map[string]decimal.Decimal{},
+		MaxOpen:        decimal.NewFromFloat(c.RiskMaxOpen),
+		MaxDeviation:   decimal.NewFromFloat(c.RiskMaxDeviation),
+		MaxDailyLoss:   decimal.NewFromFloat(c.RiskMaxDailyLoss),
+		Fee:            bittrexFee,
+	}
+	if c.Paper {
+		l.Fee = decimal.NewFromFloat(c.PaperFee)
+	}
+
+	if len(c.RiskMarketMaxOrder) == 0 {
+		return l, nil
+	}
+	for _, pair := range strings.Split(c.RiskMarketMaxOrder, ",") {
+		kv := strings.SplitN(strings.TrimSpace(pair), ":", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid market limit %q (expected MARKET:amount)", pair)
+		}
+		v, err := decimal.NewFromString(kv[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid market limit %q: %s", pair, err.Error())
+		}
+		l.MarketMaxOrder[strings.ToUpper(kv[0])] = v
+	}
+	return l, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Rejection is the error returned for an order which failed a check.
+type Rejection struct {
+	TimeStamp time.Time
+	Session   types.UUID `json:"Session,omitempty"`
+	Market    string
+	Type      string
+	Quantity  decimal.Decimal
+	Rate      decimal.Decimal
+	Reason    string
+}
+
+func (r *Rejection) Error() string {
+	return fmt.Sprintf("risk check rejected %s of %s %s @ %s: %s",
+		r.Type, r.Quantity, r.Market, r.Rate.StringFixed(8), r.Reason)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Checker checks orders against its limits.  The market data and open orders
+// are read from its exchange.
+type Checker struct {
+	sync.Mutex // guards markets
+
+	limits  *Limits
+	ex      exchange.Exchange
+	markets map[string]exchange.Market
+	fetched time.Time // when markets were fetched
+
+	// Halted (if set) returns true while no orders may be placed.
+	Halted func() bool
+
+	// Balances returns the balances orders are checked against.
+	Balances func() ([]*types.Balance, error)
+
+	// DailyLoss (if set) returns the loss (in BTC) since the start of the day.
+	DailyLoss func() (decimal.Decimal, error)
+
+	// OnReject (if set) is called with every rejected order.
+	OnReject func(r *Rejection)
+}
+
+// New returns a checker enforcing `limits` using the exchange `ex`.
+func New(ex exchange.Exchange, limits *Limits) *Checker {
+	return &Checker{
+		limits:  limits,
+		ex:      ex,
+		markets: map[string]exchange.Market{},
+	}
+}
+
+// Limits returns the limits enforced by the checker.
+func (c *Checker) Limits() *Limits {
+	return c.limits
+}
+
+// Exchange returns `ex` with every order placed through it checked first, on
+// behalf of `session` (which may be empty).
+func (c *Checker) Exchange(ex exchange.Exchange, session types.UUID) exchange.Exchange {
+	return &checked{Exchange: ex, c: c, session: session}
+}
+
+// checked checks the orders placed through its exchange.
+type checked struct {
+	exchange.Exchange
+	c       *Checker
+	session types.UUID
+}
+
+func (e *checked) BuyLimit(market string, quantity, rate decimal.Decimal) (string, error) {
+	if err := e.c.Check(e.session, market, exchange.OrderTypeLimitBuy, quantity, rate); err != nil {
+		return "", err
+	}
+	return e.Exchange.BuyLimit(market, quantity, rate)
+}
+
+func (e *checked) SellLimit(market string, quantity, rate decimal.Decimal) (string, error) {
+	if err := e.c.Check(e.session, market, exchange.OrderTypeLimitSell, quantity, rate); err != nil {
+		return "", err
+	}
+	return e.Exchange.SellLimit(market, quantity, rate)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Check returns a *Rejection if the order described fails any check.
+func (c *Checker) Check(session types.UUID, market, typ string, quantity, rate decimal.Decimal) error {
+	market = strings.ToUpper(market)
+	reason, err := c.check(market, typ, quantity, rate)
+	if err != nil {
+		reason = "unable to check order: " + err.Error()
+	}
+	if len(reason) == 0 {
+		return nil
+	}
+
+	r := &Rejection{
+		TimeStamp: time.Now(),
+		Session:   session,
+		Market:    market,
+		Type:      typ,
+		Quantity:  quantity,
+		Rate:      rate,
+		Reason:    reason,
+	}
+	log.Printf("Risk :: %s\n", r.Error())
+	if c.OnReject != nil {
+		c.OnReject(r)
+	}
+	return r
+}
+
+// check returns the reason the order fails a check, if any.
+func (c *Checker) check(market, typ string, quantity, rate decimal.Decimal) (string, error) {
+	l := c.limits
+	buy := typ == exchange.OrderTypeLimitBuy
+	base, currency := splitMarket(market)
+	if c.Halted != nil && c.Halted() {
+		return "trading is halted by the kill switch", nil
+	}
+	if quantity.Sign() <= 0 || rate.Sign() <= 0 {
+		return "quantity and rate must be positive", nil
+	}
+
+	m, err := c.market(market)
+	if err != nil {
+		return "", err
+	}
+	if len(m.MarketName) == 0 {
+		return fmt.Sprintf("%s is not listed on the exchange", market), nil
+	}
+	if quantity.LessThan(m.MinTradeSize) {
+		return fmt.Sprintf("quantity is below the minimum trade size of %s", m.MinTradeSize), nil
+	}
+
+	notional := quantity.Mul(rate).Round(8)
+	max, ok := l.MarketMaxOrder[market]
+	if !ok {
+		max = l.MaxOrder
+	}
+	if max.Sign() > 0 && notional.GreaterThan(max) {
+		return fmt.Sprintf("notional of %s %s is above the order limit of %s", notional, base, max), nil
+	}
+
+	if l.MaxDeviation.Sign() > 0 {
+		t, err := c.ex.GetTicker(market)
+		if err != nil {
+			return "", err
+		}
+		if buy && t.Ask.Sign() > 0 && rate.GreaterThan(t.Ask) {
+			if dev := rate.Sub(t.Ask).Div(t.Ask).Mul(hundred).Round(2); dev.GreaterThan(l.MaxDeviation) {
+				return fmt.Sprintf("rate is %s%% above the ask of %s (limit %s%%)", dev, t.Ask.StringFixed(8), l.MaxDeviation), nil
+			}
+		}
+		if !buy && t.Bid.Sign() > 0 && rate.LessThan(t.Bid) {
+			if dev := t.Bid.Sub(rate).Div(t.Bid).Mul(hundred).Round(2); dev.GreaterThan(l.MaxDeviation) {
+				return fmt.Sprintf("rate is %s%% below the bid of %s (limit %s%%)", dev, t.Bid.StringFixed(8), l.MaxDeviation), nil
+			}
+		}
+	}
+
+	if c.Balances != nil {
+		bs, err := c.Balances()
+		if err != nil {
+			return "", err
+		}
+		need, cur := quantity, currency
+		if buy {
+			need, cur = notional.Mul(decimal.New(1, 0).Add(l.Fee)).Round(8), base
+		}
+		avail := decimal.Zero
+		for _, b := range bs {
+			if b.Currency == cur {
+				avail = b.Available
+			}
+		}
+		if need.GreaterThan(avail) {
+			return fmt.Sprintf("needs %s %s but only %s is available", need, cur, avail), nil
+		}
+	}
+
+	if l.MaxOpen.Sign() > 0 {
+		open, err := c.ex.GetOpenOrders(exchange.AllMarkets)
+		if err != nil {
+			return "", err
+		}
+		total := notional
+		for _, o := range open {
+			total = total.Add(o.QuantityRemaining.Mul(o.Limit))
+		}
+		if total = total.Round(8); total.GreaterThan(l.MaxOpen) {
+			return fmt.Sprintf("open orders would total %s %s, above the limit of %s", total, base, l.MaxOpen), nil
+		}
+	}
+
+	if buy && l.MaxDailyLoss.Sign() > 0 && c.DailyLoss != nil {
+		loss, err := c.DailyLoss()
+		if err != nil {
+			return "", err
+		}
+		if loss.GreaterThanOrEqual(l.MaxDailyLoss) {
+			return fmt.Sprintf("today's loss of %s BTC has reached the limit of %s", loss, l.MaxDailyLoss), nil
+		}
+	}
+	return "", nil
+}
+
+// market returns the exchange's market `name`, refetching the markets when
+// they are stale.  A zero market is returned if it is not listed.
+func (c *Checker) market(name string) (exchange.Market, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	if time.Since(c.fetched) > marketsTTL {
+		ms, err := c.ex.GetMarkets()
+		if err != nil {
+			return exchange.Market{}, err
+		}
+		c.markets = map[string]exchange.Market{}
+		for _, m := range ms {
+			c.markets[strings.ToUpper(m.MarketName)] = m
+		}
+		c.fetched = time.Now()
+	}
+	return c.markets[name], nil
+}
+
+// splitMarket splits a market name (ex: "BTC-PIVX") into its base and market
+// currencies.
+func splitMarket(market string) (string, string) {
+	parts := strings.SplitN(market, "-", 2)
+	if len(parts) != 2 {
+		return market, ""
+	}
+	return parts[0], parts[1]
+}
+
+////////////////////////////////////////////////////////////////////////////////
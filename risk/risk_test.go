@@ -0,0 +1,281 @@
+package risk
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sabhiram/trade-bot/app/db"
+	"github.com/sabhiram/trade-bot/exchange"
+	"github.com/sabhiram/trade-bot/types"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// stubExchange serves fixed markets, tickers and open orders, and records the
+// orders placed through it.  Calls it does not implement panic.
+type stubExchange struct {
+	exchange.Exchange
+
+	markets   []exchange.Market
+	tickers   map[string]exchange.Ticker
+	open      []exchange.Order
+	tickerErr error
+	calls     int      // calls for market data and open orders
+	placed    []string // markets of the orders placed
+}
+
+func (e *stubExchange) GetMarkets() ([]exchange.Market, error) {
+	e.calls++
+	return e.markets, nil
+}
+
+func (e *stubExchange) GetTicker(market string) (exchange.Ticker, error) {
+	e.calls++
+	return e.tickers[market], e.tickerErr
+}
+
+func (e *stubExchange) GetOpenOrders(market string) ([]exchange.Order, error) {
+	e.calls++
+	return e.open, nil
+}
+
+func (e *stubExchange) BuyLimit(market string, quantity, rate decimal.Decimal) (string, error) {
+	e.placed = append(e.placed, market)
+	return "BUY-UUID", nil
+}
+
+func (e *stubExchange) SellLimit(market string, quantity, rate decimal.Decimal) (string, error) {
+	e.placed = append(e.placed, market)
+	return "SELL-UUID", nil
+}
+
+func dec(s string) decimal.Decimal {
+	d, err := decimal.NewFromString(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func newStubExchange() *stubExchange {
+	return &stubExchange{
+		markets: []exchange.Market{
+			{MarketName: "BTC-PIVX", MinTradeSize: dec("1")},
+			{MarketName: "BTC-DOGE", MinTradeSize: dec("100")},
+		},
+		tickers: map[string]exchange.Ticker{
+			"BTC-PIVX": {Bid: dec("0.00099"), Ask: dec("0.00101"), Last: dec("0.001")},
+			"BTC-DOGE": {Bid: dec("0.0000002"), Ask: dec("0.00000021"), Last: dec("0.0000002")},
+		},
+		open: []exchange.Order{
+			{UUID: "OPEN", Market: "BTC-PIVX", Quantity: dec("60"), QuantityRemaining: dec("50"), Limit: dec("0.001"), IsOpen: true},
+		},
+	}
+}
+
+// newChecker returns a checker of orders placed on `ex` with 0.05 BTC and 20
+// PIVX available, 0.05 BTC of orders open and no loss today.
+func newChecker(ex exchange.Exchange) *Checker {
+	c := New(ex, &Limits{
+		MaxOrder:       dec("0.1"),
+		MarketMaxOrder: map[string]decimal.Decimal{"BTC-DOGE": dec("0.01")},
+		MaxOpen:        dec("0.08"),
+		MaxDeviation:   dec("10"),
+		MaxDailyLoss:   dec("0.05"),
+		Fee:            dec("0.0025"),
+	})
+	c.Balances = func() ([]*types.Balance, error) {
+		return []*types.Balance{
+			{Currency: "BTC", Available: dec("0.05")},
+			{Currency: "PIVX", Available: dec("20")},
+			{Currency: "DOGE", Available: dec("1000000")},
+		}, nil
+	}
+	c.DailyLoss = func() (decimal.Decimal, error) {
+		return decimal.Zero, nil
+	}
+	return c
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func TestCheck(t *testing.T) {
+	buy, sell := exchange.OrderTypeLimitBuy, exchange.OrderTypeLimitSell
+	for _, tc := range []struct {
+		name     string
+		market   string
+		typ      string
+		quantity string
+		rate     string
+		reason   string // empty if the order passes
+	}{
+		{"buy", "BTC-PIVX", buy, "29", "0.001", ""},
+		{"sell", "BTC-PIVX", sell, "20", "0.00099", ""},
+		{"lower case market", "btc-pivx", sell, "20", "0.00099", ""},
+		{"zero quantity", "BTC-PIVX", sell, "0", "0.001", "quantity and rate must be positive"},
+		{"negative rate", "BTC-PIVX", buy, "10", "-0.001", "quantity and rate must be positive"},
+		{"unlisted market", "BTC-NOPE", sell, "10", "0.001", "BTC-NOPE is not listed on the exchange"},
+		{"min trade size", "BTC-PIVX", sell, "0.5", "0.001", "below the minimum trade size of 1"},
+
+		// Order size, per market and globally.
+		{"max order", "BTC-PIVX", buy, "101", "0.001", "notional of 0.101 BTC is above the order limit of 0.1"},
+		{"market max order", "BTC-DOGE", sell, "60000", "0.0000002", "notional of 0.012 BTC is above the order limit of 0.01"},
+		{"under market max order", "BTC-DOGE", sell, "40000", "0.0000002", ""},
+
+		// Deviation from the bid (sells) and ask (buys).
+		{"buy near the ask", "BTC-PIVX", buy, "10", "0.00111", ""},
+		{"buy above the ask", "BTC-PIVX", buy, "10", "0.0012", "rate is 18.81% above the ask of 0.00101000 (limit 10%)"},
+		{"sell near the bid", "BTC-PIVX", sell, "10", "0.0009", ""},
+		{"sell below the bid", "BTC-PIVX", sell, "10", "0.00089", "rate is 10.1% below the bid of 0.00099000 (limit 10%)"},
+		{"sell above the bid", "BTC-PIVX", sell, "10", "0.002", ""},
+
+		// Balances, buys hold the fee as well.
+		{"buy without the fee", "BTC-PIVX", buy, "50", "0.001", "needs 0.050125 BTC but only 0.05 is available"},
+		{"sell more than held", "BTC-PIVX", sell, "21", "0.001", "needs 21 PIVX but only 20 is available"},
+
+		// Open orders total 0.05 BTC.
+		{"max open", "BTC-PIVX", buy, "31", "0.001", "open orders would total 0.081 BTC, above the limit of 0.08"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newChecker(newStubExchange())
+			err := c.Check("", tc.market, tc.typ, dec(tc.quantity), dec(tc.rate))
+			if len(tc.reason) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected rejection: %s", err.Error())
+				}
+				return
+			}
+
+			r, ok := err.(*Rejection)
+			if !ok {
+				t.Fatalf("expected a *Rejection, got %#v", err)
+			}
+			if !strings.Contains(r.Reason, tc.reason) {
+				t.Fatalf("expected %q, got %q", tc.reason, r.Reason)
+			}
+		})
+	}
+}
+
+func TestCheckDailyLoss(t *testing.T) {
+	c := newChecker(newStubExchange())
+	c.DailyLoss = func() (decimal.Decimal, error) {
+		return dec("0.05"), nil
+	}
+
+	err := c.Check("", "BTC-PIVX", exchange.OrderTypeLimitBuy, dec("10"), dec("0.001"))
+	if r, ok := err.(*Rejection); !ok || !strings.Contains(r.Reason, "today's loss of 0.05 BTC has reached the limit") {
+		t.Fatalf("expected the buy to be rejected, got %v", err)
+	}
+
+	// Sells reduce exposure and are still allowed.
+	if err := c.Check("", "BTC-PIVX", exchange.OrderTypeLimitSell, dec("10"), dec("0.001")); err != nil {
+		t.Fatalf("unexpected rejection: %s", err.Error())
+	}
+}
+
+func TestCheckErrors(t *testing.T) {
+	ex := newStubExchange()
+	ex.tickerErr = errors.New("connection reset")
+	c := newChecker(ex)
+
+	err := c.Check("", "BTC-PIVX", exchange.OrderTypeLimitSell, dec("10"), dec("0.001"))
+	if r, ok := err.(*Rejection); !ok || r.Reason != "unable to check order: connection reset" {
+		t.Fatalf("expected the order to be rejected, got %v", err)
+	}
+}
+
+func TestCheckHalted(t *testing.T) {
+	ex := newStubExchange()
+	c := newChecker(ex)
+	c.Halted = func() bool { return true }
+
+	err := c.Check("", "BTC-PIVX", exchange.OrderTypeLimitSell, dec("10"), dec("0.001"))
+	if r, ok := err.(*Rejection); !ok || r.Reason != "trading is halted by the kill switch" {
+		t.Fatalf("expected the order to be rejected, got %v", err)
+	}
+	if ex.calls != 0 {
+		t.Fatalf("expected no exchange calls while halted, got %d", ex.calls)
+	}
+}
+
+func TestExchange(t *testing.T) {
+	ex := newStubExchange()
+	c := newChecker(ex)
+	rejected := []*Rejection{}
+	c.OnReject = func(r *Rejection) {
+		rejected = append(rejected, r)
+	}
+	checked := c.Exchange(ex, types.UUID("SESSION"))
+
+	if _, err := checked.SellLimit("BTC-PIVX", dec("10"), dec("0.001")); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if _, err := checked.BuyLimit("BTC-PIVX", dec("10"), dec("0.002")); err == nil {
+		t.Fatalf("expected the buy to be rejected")
+	}
+
+	if len(ex.placed) != 1 {
+		t.Fatalf("expected only the sell to be placed, got %d orders", len(ex.placed))
+	}
+	if len(rejected) != 1 || rejected[0].Session != "SESSION" || rejected[0].Type != exchange.OrderTypeLimitBuy {
+		t.Fatalf("expected the buy to be reported, got %#v", rejected)
+	}
+}
+
+// TestExchangeKillSwitch checks orders against a kill switch persisted in a
+// session db, as the command line does, engaging it from another handle on
+// the db (ie: the server) while the orders are being placed.
+func TestExchangeKillSwitch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "risk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "db.json")
+
+	ex := newStubExchange()
+	c := newChecker(ex)
+	c.Halted = func() bool {
+		return db.KillSwitchEngaged(path)
+	}
+	checked := c.Exchange(ex, "")
+
+	// No db yet, trading is not halted.
+	if _, err := checked.SellLimit("BTC-PIVX", dec("10"), dec("0.001")); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	d, err := db.New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetKillSwitch(types.KillSwitch{Engaged: true, EngagedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := checked.SellLimit("BTC-PIVX", dec("10"), dec("0.001")); err == nil {
+		t.Fatalf("expected the order to be rejected once halted")
+	}
+
+	if err := d.SetKillSwitch(types.KillSwitch{RearmedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := checked.SellLimit("BTC-PIVX", dec("10"), dec("0.001")); err != nil {
+		t.Fatalf("unexpected error once re-armed: %s", err.Error())
+	}
+
+	if len(ex.placed) != 2 {
+		t.Fatalf("expected 2 orders to be placed, got %d", len(ex.placed))
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
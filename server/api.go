@@ -0,0 +1,468 @@
+package server
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sabhiram/trade-bot/app"
+	"github.com/sabhiram/trade-bot/app/db"
+	"github.com/sabhiram/trade-bot/exchange"
+	"github.com/sabhiram/trade-bot/history"
+	"github.com/sabhiram/trade-bot/indicator"
+	"github.com/sabhiram/trade-bot/types"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+const (
+	apiPrefix = "/api/"
+
+	defaultBookDepth = 20 // levels per side returned by /api/book
+
+	defaultChartInterval   = "fiveMin" // candle interval of /api/chart
+	defaultChartLimit      = 200       // candles returned by /api/chart
+	defaultCandlesInterval = "fiveMin" // candle interval of /api/candles
+
+	defaultPnLPeriod = history.PeriodDay // period of /api/portfolio/pnl
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// apiResponse is the envelope every API response is wrapped in.  Exactly one
+// of `Data` or `Error` is set.
+type apiResponse struct {
+	Data  interface{} `json:"Data,omitempty"`
+	Error *apiError   `json:"Error,omitempty"`
+}
+
+type apiError struct {
+	Status  int    `json:"Status"`
+	Message string `json:"Message"`
+}
+
+// resolveOrphanRequest is the body expected by POST /api/reconciliation/<uuid>.
+type resolveOrphanRequest struct {
+	Action  string     `json:"Action"`  // "adopt", "cancel" or "dismiss"
+	Session types.UUID `json:"Session"` // session to adopt into (optional)
+}
+
+// haltRequest is the (optional) body of POST /api/killswitch/halt.
+type haltRequest struct {
+	Exit bool `json:"Exit"` // sell balances to BTC after cancelling orders
+}
+
+// createSessionRequest is the body expected by POST /api/sessions and
+// /api/sessions/preview.
+type createSessionRequest struct {
+	Strategy string            `json:"Strategy"`
+	Currency string            `json:"Currency"`
+	Params   map[string]string `json:"Params"`
+}
+
+// apiFunc handles an API request and returns the data to respond with.
+type apiFunc func(r *http.Request) (interface{}, error)
+
+// created wraps data returned by an apiFunc that created a new resource.
+type created struct {
+	data interface{}
+}
+
+// statusError is an error that maps to a specific HTTP status.
+type statusError struct {
+	status int
+	msg    string
+}
+
+func (e *statusError) Error() string {
+	return e.msg
+}
+
+func errorf(status int, format string, args ...interface{}) error {
+	return &statusError{status: status, msg: fmt.Sprintf(format, args...)}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func writeJSON(w http.ResponseWriter, status int, resp *apiResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		fmt.Printf("apiHandler :: unable to write response :: %s\n", err.Error())
+	}
+}
+
+// errorStatus maps errors returned by the app to HTTP status codes.
+func errorStatus(err error) int {
+	switch e := err.(type) {
+	case *statusError:
+		return e.status
+	case *app.ValidationError:
+		return http.StatusBadRequest
+	}
+
+	if err == db.ErrSessionNotFound {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// handle wraps `fns` (keyed by HTTP method) into a handler which writes the
+// result (or error) using the API envelope.
+func handle(fns map[string]apiFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fn, ok := fns[r.Method]
+		if !ok {
+			writeJSON(w, http.StatusMethodNotAllowed, &apiResponse{
+				Error: &apiError{http.StatusMethodNotAllowed, "method not allowed"},
+			})
+			return
+		}
+
+		data, err := fn(r)
+		if err != nil {
+			status := errorStatus(err)
+			writeJSON(w, status, &apiResponse{
+				Error: &apiError{status, err.Error()},
+			})
+			return
+		}
+
+		if c, ok := data.(created); ok {
+			writeJSON(w, http.StatusCreated, &apiResponse{Data: c.data})
+			return
+		}
+		writeJSON(w, http.StatusOK, &apiResponse{Data: data})
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func (s *Server) getHealth(r *http.Request) (interface{}, error) {
+	return map[string]string{
+		"Status":   "ok",
+		"Version":  s.app.Version(),
+		"Exchange": s.app.ExchangeName(),
+	}, nil
+}
+
+func (s *Server) getVersion(r *http.Request) (interface{}, error) {
+	return s.app.Version(), nil
+}
+
+func (s *Server) getBalances(r *http.Request) (interface{}, error) {
+	return s.app.GetBalances()
+}
+
+func (s *Server) getPortfolio(r *http.Request) (interface{}, error) {
+	return s.app.GetPortfolio()
+}
+
+func (s *Server) postRefresh(r *http.Request) (interface{}, error) {
+	if err := s.app.UpdateBalances(true); err != nil {
+		return nil, err
+	}
+	return s.app.GetBalances()
+}
+
+func (s *Server) getMarkets(r *http.Request) (interface{}, error) {
+	return s.app.GetMarkets()
+}
+
+func (s *Server) getTickers(r *http.Request) (interface{}, error) {
+	markets := r.URL.Query()["market"]
+	if len(markets) == 0 {
+		return nil, errorf(http.StatusBadRequest, "at least one market query parameter is required")
+	}
+
+	ts := map[string]exchange.Ticker{}
+	for _, m := range markets {
+		t, err := s.app.GetTicker(strings.ToUpper(m))
+		if err != nil {
+			return nil, err
+		}
+		ts[strings.ToUpper(m)] = t
+	}
+	return ts, nil
+}
+
+func (s *Server) getBook(r *http.Request) (interface{}, error) {
+	m := r.URL.Query().Get("market")
+	if len(m) == 0 {
+		return nil, errorf(http.StatusBadRequest, "market query parameter is required")
+	}
+
+	n := defaultBookDepth
+	if v := r.URL.Query().Get("depth"); len(v) > 0 {
+		var err error
+		if n, err = strconv.Atoi(v); err != nil || n < 0 {
+			return nil, errorf(http.StatusBadRequest, "invalid depth %q", v)
+		}
+	}
+	return s.app.GetDepth(m, n)
+}
+
+func (s *Server) getIndicators(r *http.Request) (interface{}, error) {
+	return indicator.Names(), nil
+}
+
+func (s *Server) getChart(r *http.Request) (interface{}, error) {
+	q := r.URL.Query()
+	m := q.Get("market")
+	if len(m) == 0 {
+		return nil, errorf(http.StatusBadRequest, "market query parameter is required")
+	}
+
+	interval := q.Get("interval")
+	if len(interval) == 0 {
+		interval = defaultChartInterval
+	}
+
+	n := defaultChartLimit
+	if v := q.Get("limit"); len(v) > 0 {
+		var err error
+		if n, err = strconv.Atoi(v); err != nil || n < 0 {
+			return nil, errorf(http.StatusBadRequest, "invalid limit %q", v)
+		}
+	}
+	return s.app.GetChart(m, interval, q["indicator"], n)
+}
+
+func (s *Server) getCandles(r *http.Request) (interface{}, error) {
+	q := r.URL.Query()
+	m := q.Get("market")
+	if len(m) == 0 {
+		return nil, errorf(http.StatusBadRequest, "market query parameter is required")
+	}
+
+	interval := q.Get("interval")
+	if len(interval) == 0 {
+		interval = defaultCandlesInterval
+	}
+
+	from, to, err := timeRange(r)
+	if err != nil {
+		return nil, err
+	}
+	return s.app.GetCandles(m, interval, from, to)
+}
+
+func (s *Server) getPortfolioHistory(r *http.Request) (interface{}, error) {
+	from, to, err := timeRange(r)
+	if err != nil {
+		return nil, err
+	}
+	return s.app.GetPortfolioHistory(from, to)
+}
+
+func (s *Server) getPortfolioPnL(r *http.Request) (interface{}, error) {
+	period := r.URL.Query().Get("period")
+	if len(period) == 0 {
+		period = defaultPnLPeriod
+	}
+
+	from, to, err := timeRange(r)
+	if err != nil {
+		return nil, err
+	}
+	return s.app.GetPortfolioPnL(period, from, to)
+}
+
+func (s *Server) getOpenOrders(r *http.Request) (interface{}, error) {
+	return s.app.GetOpenOrders(marketParam(r))
+}
+
+func (s *Server) getOrderHistory(r *http.Request) (interface{}, error) {
+	return s.app.GetOrderHistory(marketParam(r))
+}
+
+func (s *Server) getTrackedOrders(r *http.Request) (interface{}, error) {
+	return s.app.GetTrackedOrders(types.UUID(r.URL.Query().Get("session")))
+}
+
+func (s *Server) getReconciliation(r *http.Request) (interface{}, error) {
+	return s.app.GetReconciliation()
+}
+
+func (s *Server) postReconciliation(r *http.Request) (interface{}, error) {
+	return s.app.Reconcile()
+}
+
+func (s *Server) postResolveOrphan(r *http.Request) (interface{}, error) {
+	var req resolveOrphanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, errorf(http.StatusBadRequest, "invalid request body: %s", err.Error())
+	}
+	if len(req.Action) == 0 {
+		return nil, errorf(http.StatusBadRequest, "Action is required")
+	}
+
+	uuid := strings.TrimPrefix(r.URL.Path, apiPrefix+"reconciliation/")
+	return s.app.ResolveOrphan(uuid, req.Action, req.Session)
+}
+
+func (s *Server) getKillSwitch(r *http.Request) (interface{}, error) {
+	return s.app.GetKillSwitch()
+}
+
+func (s *Server) postHalt(r *http.Request) (interface{}, error) {
+	var req haltRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return nil, errorf(http.StatusBadRequest, "invalid request body: %s", err.Error())
+		}
+	}
+	return s.app.Halt(req.Exit)
+}
+
+func (s *Server) postRearm(r *http.Request) (interface{}, error) {
+	return s.app.Rearm()
+}
+
+func (s *Server) getRisk(r *http.Request) (interface{}, error) {
+	return s.app.GetRisk()
+}
+
+func (s *Server) getSessions(r *http.Request) (interface{}, error) {
+	return s.app.GetSessions()
+}
+
+func (s *Server) postSession(r *http.Request) (interface{}, error) {
+	var req createSessionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, errorf(http.StatusBadRequest, "invalid request body: %s", err.Error())
+	}
+	if len(req.Strategy) == 0 || len(req.Currency) == 0 {
+		return nil, errorf(http.StatusBadRequest, "Strategy and Currency are required")
+	}
+
+	ses, err := s.app.CreateSession(req.Strategy, req.Currency, req.Params)
+	if err != nil {
+		return nil, err
+	}
+	return created{ses}, nil
+}
+
+func (s *Server) postSessionPreview(r *http.Request) (interface{}, error) {
+	var req createSessionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, errorf(http.StatusBadRequest, "invalid request body: %s", err.Error())
+	}
+	if len(req.Strategy) == 0 || len(req.Currency) == 0 {
+		return nil, errorf(http.StatusBadRequest, "Strategy and Currency are required")
+	}
+	return s.app.PreviewSession(req.Strategy, req.Currency, req.Params)
+}
+
+func (s *Server) getSession(r *http.Request) (interface{}, error) {
+	return s.app.GetSession(sessionID(r))
+}
+
+func (s *Server) deleteSession(r *http.Request) (interface{}, error) {
+	id := sessionID(r)
+	return id, s.app.DeleteSession(id)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// marketParam returns the "market" query parameter, defaulting to all markets.
+func marketParam(r *http.Request) string {
+	m := r.URL.Query().Get("market")
+	if len(m) == 0 {
+		return exchange.AllMarkets
+	}
+	return strings.ToUpper(m)
+}
+
+// timeParam returns the RFC3339 time query parameter `key`, the zero time if
+// it is not set.
+func timeParam(r *http.Request, key string) (time.Time, error) {
+	v := r.URL.Query().Get(key)
+	if len(v) == 0 {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, errorf(http.StatusBadRequest, "invalid %s %q (want RFC3339)", key, v)
+	}
+	return t, nil
+}
+
+// timeRange returns the "from" and "to" time query parameters, see timeParam.
+func timeRange(r *http.Request) (time.Time, time.Time, error) {
+	from, err := timeParam(r, "from")
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	to, err := timeParam(r, "to")
+	return from, to, err
+}
+
+// sessionID returns the session id from a /api/sessions/<id> path.
+func sessionID(r *http.Request) types.UUID {
+	return types.UUID(strings.TrimPrefix(r.URL.Path, apiPrefix+"sessions/"))
+}
+
+// apiHandler returns the handler for all routes under `apiPrefix`.
+func (s *Server) apiHandler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.Handle(apiPrefix+"health", handle(map[string]apiFunc{"GET": s.getHealth}))
+	mux.Handle(apiPrefix+"version", handle(map[string]apiFunc{"GET": s.getVersion}))
+	mux.Handle(apiPrefix+"balances", handle(map[string]apiFunc{"GET": s.getBalances}))
+	mux.Handle(apiPrefix+"portfolio", handle(map[string]apiFunc{"GET": s.getPortfolio}))
+	mux.Handle(apiPrefix+"portfolio/history", handle(map[string]apiFunc{"GET": s.getPortfolioHistory}))
+	mux.Handle(apiPrefix+"portfolio/pnl", handle(map[string]apiFunc{"GET": s.getPortfolioPnL}))
+	mux.Handle(apiPrefix+"refresh", handle(map[string]apiFunc{"POST": s.postRefresh}))
+	mux.Handle(apiPrefix+"markets", handle(map[string]apiFunc{"GET": s.getMarkets}))
+	mux.Handle(apiPrefix+"tickers", handle(map[string]apiFunc{"GET": s.getTickers}))
+	mux.Handle(apiPrefix+"book", handle(map[string]apiFunc{"GET": s.getBook}))
+	mux.Handle(apiPrefix+"indicators", handle(map[string]apiFunc{"GET": s.getIndicators}))
+	mux.Handle(apiPrefix+"chart", handle(map[string]apiFunc{"GET": s.getChart}))
+	mux.Handle(apiPrefix+"candles", handle(map[string]apiFunc{"GET": s.getCandles}))
+	mux.Handle(apiPrefix+"orders", handle(map[string]apiFunc{"GET": s.getTrackedOrders}))
+	mux.Handle(apiPrefix+"orders/open", handle(map[string]apiFunc{"GET": s.getOpenOrders}))
+	mux.Handle(apiPrefix+"orders/history", handle(map[string]apiFunc{"GET": s.getOrderHistory}))
+	mux.Handle(apiPrefix+"reconciliation", handle(map[string]apiFunc{
+		"GET":  s.getReconciliation,
+		"POST": s.postReconciliation,
+	}))
+	mux.Handle(apiPrefix+"reconciliation/", handle(map[string]apiFunc{"POST": s.postResolveOrphan}))
+	mux.Handle(apiPrefix+"killswitch", handle(map[string]apiFunc{"GET": s.getKillSwitch}))
+	mux.Handle(apiPrefix+"killswitch/halt", handle(map[string]apiFunc{"POST": s.postHalt}))
+	mux.Handle(apiPrefix+"killswitch/rearm", handle(map[string]apiFunc{"POST": s.postRearm}))
+	mux.Handle(apiPrefix+"risk", handle(map[string]apiFunc{"GET": s.getRisk}))
+	mux.Handle(apiPrefix+"sessions", handle(map[string]apiFunc{
+		"GET":  s.getSessions,
+		"POST": s.postSession,
+	}))
+	mux.Handle(apiPrefix+"sessions/preview", handle(map[string]apiFunc{"POST": s.postSessionPreview}))
+	mux.Handle(apiPrefix+"sessions/", handle(map[string]apiFunc{
+		"GET":    s.getSession,
+		"DELETE": s.deleteSession,
+	}))
+	mux.HandleFunc(apiPrefix, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusNotFound, &apiResponse{
+			Error: &apiError{http.StatusNotFound, r.URL.Path + " not found"},
+		})
+	})
+
+	return mux
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// NotRunning returns true if `err` from a request to the API means that no
+// server is listening, as opposed to a server which failed to respond.
+func NotRunning(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED)
+}
+
+////////////////////////////////////////////////////////////////////////////////
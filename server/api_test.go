@@ -0,0 +1,54 @@
+package server
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+func TestNotRunning(t *testing.T) {
+	// Nothing listens on the address of a closed listener.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	// A server which accepts the request but never responds.
+	stall := make(chan struct{})
+	stalled := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-stall
+	}))
+	defer stalled.Close()
+	defer close(stall)
+
+	client := &http.Client{Timeout: 100 * time.Millisecond}
+	for _, tc := range []struct {
+		name string
+		url  string
+		down bool
+	}{
+		{"not running", "http://" + addr + "/api/killswitch/halt", true},
+		{"stalled", stalled.URL + "/api/killswitch/halt", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := client.Post(tc.url, "application/json", nil)
+			if err == nil {
+				resp.Body.Close()
+				t.Fatalf("expected the request to fail")
+			}
+			if got := NotRunning(err); got != tc.down {
+				t.Fatalf("expected NotRunning to be %t for %q", tc.down, err.Error())
+			}
+		})
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
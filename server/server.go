@@ -16,6 +16,7 @@ package server
 import (
 	"fmt"
 	"net/http"
+	"sync"
 
 	"github.com/gorilla/websocket"
 
@@ -43,8 +44,12 @@ var (
 type Server struct {
 	*http.Server
 
-	app *app.App // app engine
-	hub *hub.Hub // websocket hub
+	app   *app.App          // app engine
+	hub   *hub.Hub          // websocket hub
+	wsFns map[string]wsFunc // websocket request handlers
+
+	sync.Mutex                                        // guards tickers
+	tickers    map[*socket.Socket]map[string]struct{} // markets watched by each socket
 }
 
 // New returns an instance of Server.
@@ -54,29 +59,24 @@ func New(addr string, h *hub.Hub, a *app.App) (*Server, error) {
 			Addr: addr,
 		},
 
-		app: a,
-		hub: h,
+		app:     a,
+		hub:     h,
+		tickers: map[*socket.Socket]map[string]struct{}{},
 	}
 
+	s.wsFns = s.wsHandlers()
 	return s, s.setupRoutes()
 }
 
 func (s *Server) Start() {
 	fmt.Printf("Kicking off webserver at: %s\n", s.Addr)
-	if err := s.ListenAndServe(); err != nil {
+	if err := s.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		fmt.Printf("error :: webserver died :: %s\n", err.Error())
 	}
 }
 
 ////////////////////////////////////////////////////////////////////////////////
 
-func (s *Server) todoHandler() http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		fmt.Printf("TODO handler hit!\n")
-		w.Write([]byte("TODO"))
-	}
-}
-
 func (s *Server) wsHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		c, err := wsUpgrader.Upgrade(w, r, nil)
@@ -85,16 +85,15 @@ func (s *Server) wsHandler() http.HandlerFunc {
 			return
 		}
 
-		sock := socket.New(c)
+		sock := socket.New(c, s.handleSocketMessage)
 
 		s.hub.RegisterSocket(sock)
+		s.openTickers(sock)
 		defer func() {
 			s.hub.UnregisterSocket(sock)
+			s.releaseTickers(sock)
 		}()
 
-		// Send the current balance(s) to the client.
-		s.app.SendBalances(sock)
-
 		go sock.Read()
 		sock.Write()
 	}
@@ -105,7 +104,7 @@ func (s *Server) setupRoutes() error {
 
 	mux.Handle("/", http.FileServer(static.FS(cUseLocalFS)))
 	mux.Handle("/ws", s.wsHandler())
-	mux.Handle("/api", s.todoHandler())
+	mux.Handle(apiPrefix, s.apiHandler())
 
 	s.Handler = mux
 	return nil
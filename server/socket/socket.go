@@ -4,6 +4,7 @@ package socket
 
 import (
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -11,15 +12,25 @@ import (
 
 ////////////////////////////////////////////////////////////////////////////////
 
+// Handler is invoked for every text message read from a socket.
+type Handler func(s *Socket, msg []byte)
+
 type Socket struct {
-	conn   *websocket.Conn
-	sendCh chan []byte
+	conn    *websocket.Conn
+	sendCh  chan []byte
+	handler Handler
+
+	mu     sync.Mutex // guards closed
+	closed bool
 }
 
-func New(c *websocket.Conn) *Socket {
+// New returns a socket wrapping the connection `c`.  Incoming text messages
+// are passed to `h` (if set).
+func New(c *websocket.Conn, h Handler) *Socket {
 	return &Socket{
-		conn:   c,
-		sendCh: make(chan []byte, 1024),
+		conn:    c,
+		sendCh:  make(chan []byte, 1024),
+		handler: h,
 	}
 }
 
@@ -27,7 +38,7 @@ func New(c *websocket.Conn) *Socket {
 
 func (s *Socket) Read() {
 	defer s.conn.Close()
-	s.conn.SetReadLimit(1024)
+	s.conn.SetReadLimit(8192)
 	s.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
 	s.conn.SetPongHandler(func(string) error {
 		s.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
@@ -47,7 +58,11 @@ func (s *Socket) Read() {
 
 		switch mt {
 		case websocket.TextMessage:
-			fmt.Printf("wsHandler :: got message :: %s\n", string(msg))
+			if s.handler != nil {
+				s.handler(s, msg)
+			} else {
+				fmt.Printf("wsHandler :: got message :: %s\n", string(msg))
+			}
 		default:
 			fmt.Printf("wsHandler :: unknown message type :: %d\n", mt)
 		}
@@ -72,20 +87,9 @@ func (s *Socket) Write() {
 				return
 			}
 
-			// Write the message to the next websocket writer available.
-			w, err := s.conn.NextWriter(websocket.TextMessage)
-			if err != nil {
-				return
-			}
-			w.Write(msg)
-
-			// Drain the buffered send channel.
-			n := len(s.sendCh)
-			for i := 0; i < n; i++ {
-				w.Write(<-s.sendCh)
-			}
-
-			if err := w.Close(); err != nil {
+			// Each message is its own frame so that clients can decode queued
+			// messages (ex: a snapshot followed by a response) individually.
+			if err := s.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
 				return
 			}
 
@@ -100,12 +104,31 @@ func (s *Socket) Write() {
 
 ////////////////////////////////////////////////////////////////////////////////
 
+// Send queues `msg` to be written to the socket.  Messages sent after the
+// socket has been closed, or while its send buffer is full, are dropped.
 func (s *Socket) Send(msg []byte) {
-	s.sendCh <- msg
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+
+	select {
+	case s.sendCh <- msg:
+	default:
+		fmt.Printf("wsHandler :: send buffer full, dropping message\n")
+	}
 }
 
 func (s *Socket) Close() {
-	close(s.sendCh)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.closed {
+		s.closed = true
+		close(s.sendCh)
+	}
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -11506,32 +11506,80 @@ IV3iYxoKiZkxPlAp+L8BAAD//3qy991dzgEA
 
 	"/index.html": {
 		local: "static/index.html",
-		size:  3983,
+		size:  16329,
 		compressed: `
-H4sIAAAAAAAA/6xXa0/jzBX+zq84O6u+CnqxDYiqqxCnKixSW70qK0KFKpoPY89JMjCe8c6cxElR/ns1
-vsVOYO9IyHM55znPucYevft4e33/n083sKBMjY9G/gGK63nMUDN/gFyMjwAARiRJ4fgKidCuR1G1ra4y
-JA6aZxizlcQiN5YYpEYTaopZIQUtYoErmWJQbk5AakmSq8ClXGF8Fp6yGkpJ/QwWVczcwlhKlwQyNZrB
-wuIsZhF3DimS2Tya8ZW/CXM9ZxCNjyr9d0EAD5hAarLcaNTkQCMKFDAzFj4ZtcnQQhDU5lxqZU7gbBqz
-CNeEVnMVFZjs9J9cfx8oSRg+OTYeRZX6IXXaKHQLRGp5t9iJMeTI8jxKndvtwkzqMHWu48oOT2ZVSPex
-8sqd5hn69JUA36gvrdGBT95u9WMYyqScpNH93a/A+rxEuwlybnnmfgyPP/F1tbL4eYmOdjBfw1GY+YxH
-lOZcBNoIDFCT3ewQRlHVIUejxIiNJzYqkw/SxSxdOjJZUB4wkCJmOZ/j9WRSF7tHOSlXXhleyiXAAuV8
-QUM4Oz3902V9lnE7l3oIp81BzoWQet45MSu0M2WKYDMEviRzcL4ewkIKgbq62XYsN3ABmXwIfznN15f1
-fUjeQbQtu5nRFDj5PxzC2XlOl3ukL0pdJTUGvaOudlFfJEaJ5iIxVqANEkNksiGc52twRkkB7z98+NCP
-Qit01gI3XK0pXiV6dkj0/JDoeYfonqnzPUuarxJuIfRDjkvdic+XXd8P3LaqwfcJV1ynXrEX7JpFmZUu
-uzejlSiePrdSPH2eW7PUYgjvEfE1Jhe7yLQl9ec9ZxtykjBrqe1ROMvXILhb4B6Hfa9h39hF19goKpul
-7MwRYZYrTlUvCZMFidSi6iPKuNTNT0ZvakA5MOKXl3JkTMhKPd9ua8n+gGn6/2DO1BQ9Sb8NXIkSs8fH
-Duh0yvblTPKEKcWsNu62W9Yz3LXRGNd8BanizsWsrqnqEQic8aWiZjuTaxS+EGpIgJGQrWpbhqz5gYZ7
-ywUGV4ZGkZCrhofmzTKxY/9f03gdq7G0OB//bcWl4olCuKqqwQ1H0eL8NTLWFFWW+kXdwu2bU8HaBRds
-fL20FnW66RB+W7jl803S94a46kn2NwelZjFHTgx8yTuf+doXN52+4YcfPd1G6Yi9xerx0QuGjd/T6Z4v
-X9FrQ/C9imU0DpT2wtOEpKmcXRE1ldOXOtq9TdEmx5gRril64itenbK61GZLnZaNOkd6cH83jgbH7VCx
-SEurYcAWRLkbMohjECZd+p/hsH2tyK0hkxoFfwVWODeMIgZDv/SrY/j9FZWFcQS/A4sKx3qTt6XjUIsH
-V/X2oHAn4MjuiBUu9AIDf/i2/m05AEptkzzttA+w/zm5/VdYjRU52wy8cB+2kFqYIuRC3KxQ0x/SEWq0
-A/aAyXX7KnqHXGzYSUtigDubK26h9DruRrrN9gkUDmLQWPjX5YlJn5EGXn4ncnlUL6Of+GswyokdFpi4
-0hTEULjL3l3TYQAxPE5/qfHChUabHDXEnVitaBct2M/fy/0mxyGwyb+vJtd3/7i6Ydvjhu/2sgecKuPw
-C8ip0c4oDJWZD9jDBK7/uJ3cfHz3X83eQszQOT7/EqbPruDEIa5qKefWoRcK/WmLCyBnMGDeFwZSVyq/
-/VY+H6vjqe8xVg911rVxkJi41vvIibPp5YGgQxo0Q9+xk550h9IWUDnsGeqFaKmftSl0OUZalIprF6UJ
-XehfCwa0kO64H0W01tjvyMvN3d3t3ZCdgJc7zMxPFWIJVYLuPhpHUfXNMIqqr++j/wcAAP//8u3giY8P
-AAA=
+H4sIAAAAAAAC/81bbXfbuLH+nl+BIKd7pLsSJTvZbq5sOdd2tDe5dda+lnfTHtenhUhIYkyRLAFJVlP9
+984AIAm+ybKTD83ZtUkCMxjMDJ4ZDODjl+8vz2/+cjUic7kITl4c4y8SsHA2pDyk+IEz7+QFgX/H0pcB
+PznjUvLk4binX3XTgktGQrbgQ7ry+TqOEkmJG4WSh3JI174n50OPr3yXd9VLh/ihL30WdIXLAj48cPrU
+sAr88J4kPBhSMQc27lISHzhRMk/4dEh7TAgue/5i1puyFbY4cTijpHfyQtO/7HbJZz6B0RdxFML4goSc
+e9wj0yghV1GwWfCEdLtmOOEmfiyJSFzgzR9gaiELems+yem/iOJ7N/Ald74IenLc0+RV0eUm4GLOuczk
+znhPokgKmbC45wqRvzkLP3TgizWVnJ+/0Cot84r1dNLfDppPMdiT3k+isIvGy5+exyOIXCb9KCy+fQ9e
+/1jyZNONWcIW4nn82Bf2oJ8SDtyEzNk8xifgC7R4T7ox87ph5PEuvCebnMNxT6+QF8eTyNugYMfK+MQX
+Q+ouhYwWXfWBEt8b0pjN+Pl4bJwduXTUExKTr+oRPnN/NpcDctDv/+HIfFuwZOaHA9JPP4BAnh/OrC/R
+iifTIFp3NwPCljKqfH8YkLnveTzULVtr5JRdV0bxgPzcjx+OTLsjcYKwZFLpprCsu8L/JwcBD2N5VBL6
+jaIFlfJu4ZNNvTYNkyjw0oZJlMAo3UkkQWUDchg/EBEFvkdevX37tqiFrNNBxjiVNYnWtYIeVAU9rAp6
+aAlaGuqwNFLIVhOWEAdBjgGPXD+7p15W3Fb74KsJA9R1kRCV3SGv4jDIX6IknrMwf0/4F+7iGrH6Jxyh
+t1uylpmGMqs9vUZ1TwLm3me94HmWRMvQG5BXnPO6qbzJVZv55E8lbaWzA+BcZKKVRDgAETwGoFmSoaw2
+Uh7sTXGwTBMovJdEcTZgHAkflTYgU/+BZ56ndNMHV+BTqR4SbTt4SmXr1ykkmU1Yq98h5j/np3ba659d
+P/T4A2q836+VbRF5LCgZSS14UIK9dhfsQUdMXJS2+Sw51nNQa8UEh/2yWgDZpmDiqOvOWSKzwQ17G2zy
+9VDxGG0nszJd120YAhdBvhD9IBiQEKJnygsiXnQPBn31+vXPbPJz8XM64cN87BV4e5R0+XQKD4qVShwQ
+sDRNLgbEZIRbhe3H4G5xwKRGYw+geAKG0UgsF7Bs06SjEHeICjnDr19V0BnLBIbZbk3PYohKI0glUhm5
+0R74ilL6mFTd3lpM7+5ouV80wYU9pGZwsd3SwsD2GOngAEXEDSAvGlKDSvpX1+NTtgxk+qqcHpHAsARS
+z89IMyDLWgkxuR65SQBTumeRzFqORczClDReBkFXLRqLtk77/hR0P0UtvLwHnxBrX7pzZxTOICp6oA2b
+GugnS1h92SgTGRL4v+tBdgpSEtCGG/ju/ZDOWQAjf4CfSlLQ7HFP0xbE6aXy7Cvk82UUS9flmMvlQiac
+JQt6cs278PupcoJTg74zs/XAbqlbgHHN4yQ5wf+NV+w07TfM2mYMqTsAifqZmsWeiZkkQfsAqjNJ6rif
+yru7DhGgLlhQgrCEw2JYCiQIPVjqROGOaYDAAA3LUPoBZGyoSu45lpoyxRT1mH6aH56crpgfsAlkaGc6
+KIkB5HCHdUsCkgmNFcXg3KAMNwq6D6J7SE/Ol0nCQ3dTEKepcybPXr2veKj9Zo++N5FkwV49z27Oye8s
+WO4nw2/j9zc13YsvFQdLeMwZpNaYAggFhGmwcFJDNPoZZnV2CkGJ2nwiF3x1zpNNLKNTz0vAi0prtH4O
+KaGx1N1daeaP0GVGeyqhsd9TyZQpn0oEVlVWeiod2reesHF97Vg7eU4gcRK7F89bejIS0l8wxIv9/bfg
+TE2zfpy0aeLmZQ/sTDhgresHvt7+Xqq0XTgBD2dyXnRvgBzdDDO9VAhXwKEGbRY2Anv4+Z8g39nT+p9Y
+cs/lnp1vNjHfs+v/LxnAtdyQ/yEX/sLfd4SxDgh79t7lqHuhUb3ldmDJY5ikbOr89tvH99WkYdfqQ4vV
+rNhHqPRo2oTPpUabPpc2NfLdHZi50KJs/nS2xvxPICx02cvmGsrVPhotTRimNOq1wq0x03sQOinVqXYx
+4YNd0oprT8J5adY4o2rS15ygVpy56t1VIK5JfXailqkmNCLVterxJKQqlyj2AKsbf8H/c8DqGpS1D9Ub
+TOqZqEDVczAotcM34E62cJ4COqj5sWSL+OkL9bmY8zy0qcMZNNS+nN5knLTN6nKj56wuWA6/8jUxyt+5
+o9iZkbwu2t0P46VMu0yjZNHFvVwSBVRvheZRAEtrSMcyAXFmG9LCqlOAkNsVPAjalKwwocGCQsjXabfB
+QDHOigt1034MY/eWLc2xtWxXH3//c0mqtMPzpPrpeVJdqRKKlmkMmlJhath3+v2DDkm9bHjQL8mqyb6L
+/urjSZxA9pts7EBiaobGt2APqN+rYeSZSavhX919qfS9VEyt4pLdS5U1y8Azf31yHoVTP1mQbDAndUVY
+yKCE/HsOJ0BW5BOfXALokWM38vhJTgG8PT+NrKoN5kgWXHaw4uAq55IE9Ao7TCLnPC01aH/AWBY3w0a+
+jSmU16vZRn0O63u8BpeaVn7qdk8gqQ1SzQL9GqGiKruqXSSwH3PIL7xulLpPe+z7jd10KlGJU49Eu5rE
+bGcaCRaojQ3NKq1GGsvXmusFe7BsDFSPTiO12/OowXoNhLVGbchCY2trPuWwcCy9wAhgSQJ77+pqehx5
+nPfJ5noZ1rlCnE5K8gfZXbMk9MMZPQECkizDgV0bDKLZjHsdEkbS1AmdqjBNk9sbjF2NZBkYnwKqZVvV
+ury+qYpd3TC46OWBQXd6cq5e6yvE+1VlrOTkKi1y6MIdaYGp2sU0RaxmpYKNOieC+AfinEUPQ9onffLH
+fh+PhSCawv6GJyt+KmJIWq9x2zykeMZjR5GYyXmJKZ4MUQKfcNOO7bnkIEFB6PfMDzbk6gfIS48uHq/S
+5iemj+ZY79l+xVkztlbX0yiwmLQHyQE9+cPjvSBtPduQPJOqiPPk4msY7F9tfWQDlAPcL0m0eHJFNLx4
+Bglqdz+yA5vsiicuZAP7Ub6hT45tuqKAN5TyggK+VYFNnefc3qpWK6wgqOpvRi/2uc/Oc6wnVGrt86P0
+0KiCHOnNKAn7NA2/vS9sxfRXatbpdBmqDSuZcflZfIiEbLWzY9+Ey2USkhadSxmLASXDIfEid4lXapzs
+ilCcRDICjZN3hK6FGPR6lAzwEZ/a5McakjmMAw20txa0cIsiE0fw0Pss9Clray06eLKcC7YWDnZo4cdm
++kt1FKuoo8mXnLrC+//Gl786+oDXn25a2LmBLWgJO7eWSdAh7iTnuWIJqOsfZEhgj0H+/OniA6jsWt9W
+amXXCqCHE4VBxDzomDK1FJ7yETG0K6lilgjeQjr8GoWC34AhM4YE4jBpYdMtHSVJlNA7mxvBK3wiCjio
+ftaip1cfyej6+vJ6QDtETaFIeWQRatvnX7bZkzsxA75nkllU28IsYx626P+ObvRIBQ0o0xUV3OsRL2Hr
+PMjFQSR1so9HW2oDR6Kpzv5DFos5Nv9dPf7dKdqowKiluhTtpK42WJ4MRh3pe2Jnm49eqxzqMtlR1Yqd
+KbLhcujb6sbuMDt5KsGXIOrzFvVg/pRami3qdfvCkgtmNNSzcxYsbmX+geKnaxF0zo1TiFuaVX3QDGTb
+zkbpkNUezBSfX8AdJTJLz12qvGQfeH2CSK+uOLI4DjatcBmA/0jRhh8HWTN7KDfbIjWyWSGbVSObVYEN
+rh2a37vIbxklpIVq9KG9fwS/joltLfjy44/lpfYAfUH8E5ziO5Ua/RdpSXHr35EufGuTHrwemOcBed3v
+W0ukQzZAvkLyFZIf/Hcfeh68VUxWhslKM1kdmGd1T8diknuGR34ckpavvAqx9JOC0QsFoQ+OjH7B2x+t
+A3ylHQo/N9bH3KF2uqLXgGsJn8KanmfL5oMvZJRsLGhKkY/2WOz3siXSm+ueyNted5lATXSQv7yLeeJH
+3tBjSJ55qL1cCVG3fHAmLUwPoR8YFBJsjiugXXTtuAh9gFCYztA7MFL27IjlBJAeb30d9GsAj8QW5LVz
+tRb1tvZDL1o7zPNGK4CNC9ABD3nSop/55Dy7ZnwNqWxhZryIQyoKDu3Ia3n5WphYAizHkXsPCsD+bcvv
+zWPvG/6lPLSW13wi1FAw9FocFdpMPikItN3eFdsyq0Lb1+xSBnTblvqFgRFe88gmQD6hKhKOqR3JiugE
+9mlCOgUWeYW9yCNttc8AURpzDFgjTOF0h9jxmJdRIsr6cGcReTxwME0sIIE+GrK76C+FTmndamg43tJ0
+F3pXiwgYcAxjAAXKvAgSN/LDD+Sl4VR0+Jy98U/IzBYxLJxTJNQ7bYLAkY6uCjj07pbiISesEwAW4ocy
+SjkNaGGFoDj5yM0JQin3+ooHBYBk16Px5cXvo79dXl99OP0V1gXmDwPyFQcfNMnUIfp4b2A03Mkq9KmQ
+262dgeQuNS7cR9J7cqwu4J0kyME2xE24KoVEWJPExGIJ22FiygOi6HaGHpckRKSiIxk5TLK3K7HTt/7Q
+Lbe53lqaS1aaJv/6F2YMjogDH2zXgUcIbSPmznOku18VLZ+GvfuVo+6tXk5bdFg1ng+RCkKQFuMWOudg
+6LcdCBSLVvtOszEtPvjEQdpkI2M5oSFfs6MJa0bZqYaZk+bTyfbBdt9sb1zqawr2RuptJdssGGicLYH6
+1dzgmlfXo98/jj7/bTwajz9e5r5ZZ+BWe9tuEKJYWtoJKZjgFyQ/ekzG8+vR6c2oIqKl9zirydsajrPN
+qaVL58pcTrUMaUdaU8LqKHdvnK5d7mqc7V5sC3zzG4a4VMwlwwGZskDwkgh4MbFxZIVXBgqNaVpUXTKV
++l7jO3IaBI0XFwESfMB+2MikRUo94YB7Dm1XARDNyh98meNvNuhpIBBUYTDMXDbZPXYCWIv7GyYVAE18
+7529ahs84cPpxU1u/xEMOVADbxsdU11dfZqezDVXoymlEIiYsGFSQLzKDmHEuzpdNIaA0+tPtB6wvz2J
+WQvYXCt72TNdyT0AYPzb2fj8+uPZKNfrTRT7LiYO6eVR3MllmQ6+FLMN9cUX9/g792B6ty2CZUOeXdWI
+mo0bRILvmE5he/95TM4vLsej9y//GtImjgswG6ynHTzRjz3QQbEEAZ0c/FoqPVBUIGYNmgRyE/x9qz/f
+qbTFJIS0GLJKWeXQ0OmawlGlo8KPtDduNqzedmAiHEBiX8kyM9TKpiHLMvh3GfO66DSNA1ec6zuNnqbP
+u0bO+hRHzfdd3z5+7fDLUMz96S4Rnj2wicnp2UyzvbMQ9T2HLY2Xbh/x2n0r7aMyc3vQW5on5aKmdSyZ
+XIpvEO5PgFJjjVKN+rCQ7DupBAMwraav8x0QUNRX8Y8SBkoz81t6ngZncFRTn0PVlUN3B/tXTl/NP2CD
+4VQUWaigbviYc8kdPFpzU1C1uLwj9K8hgLKWNGv9EvlhiyJYY6WHPn9Z6QLuDifTFNU67zPxcmxKsKUh
+H41u2YCNJepleB9G61AdWmQep0VoV/eaWwf/HKwl575oF8Mcx6k+IXBmZXHs953Tk3zHlP+5+XFP/7Xx
+cU//3f6LfwPU2ZMsyT8AAA==
 `,
 	},
 
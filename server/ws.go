@@ -0,0 +1,300 @@
+package server
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/sabhiram/trade-bot/hub"
+	"github.com/sabhiram/trade-bot/server/socket"
+	"github.com/sabhiram/trade-bot/types"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Request types understood over the websocket.
+const (
+	reqSubscribe      = "SUBSCRIBE"       // {Topics} (optional)
+	reqUnsubscribe    = "UNSUBSCRIBE"     // {Topics}
+	reqGetBalances    = "GET_BALANCES"    // no data
+	reqRefresh        = "REFRESH"         // no data
+	reqGetSessions    = "GET_SESSIONS"    // no data
+	reqPreviewSession = "PREVIEW_SESSION" // {Strategy, Currency, Params}
+	reqCreateSession  = "CREATE_SESSION"  // {Strategy, Currency, Params}
+	reqCancelSession  = "CANCEL_SESSION"  // {ID}
+	reqResolveOrphan  = "RESOLVE_ORPHAN"  // {UUID, Action, Session}
+	reqHalt           = "HALT"            // {Exit} (optional)
+	reqRearm          = "REARM"           // no data
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// wsFunc handles a single websocket request and returns the type and data of
+// the response to send back to the requesting socket.
+type wsFunc func(sock *socket.Socket, data json.RawMessage) (string, interface{}, error)
+
+type subscribeRequest struct {
+	Topics []string `json:"Topics"`
+}
+
+type cancelSessionRequest struct {
+	ID types.UUID `json:"ID"`
+}
+
+type wsResolveOrphanRequest struct {
+	UUID string `json:"UUID"`
+	resolveOrphanRequest
+}
+
+// decode unmarshals the (optional) request `data` into `v`.
+func decode(data json.RawMessage, v interface{}) error {
+	if len(data) == 0 || string(data) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("invalid request data: %s", err.Error())
+	}
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// wsSubscribe subscribes `sock` to the requested topics, each subscription is
+// followed by a snapshot of the topic's current state.
+func (s *Server) wsSubscribe(sock *socket.Socket, data json.RawMessage) (string, interface{}, error) {
+	var req subscribeRequest
+	if err := decode(data, &req); err != nil {
+		return "", nil, err
+	}
+
+	// A bare subscribe just asks for balance updates.
+	if len(req.Topics) == 0 {
+		req.Topics = []string{hub.TopicBalance}
+	}
+
+	// Build every snapshot first so that an invalid topic fails the request
+	// without leaving the socket partially subscribed.
+	topics := []string{}
+	snaps := [][]byte{}
+	for _, topic := range req.Topics {
+		topic = hub.CanonicalTopic(topic)
+		snap, err := s.app.Snapshot(topic)
+		if err != nil {
+			return "", nil, err
+		}
+		bs, err := snap.Marshal()
+		if err != nil {
+			return "", nil, err
+		}
+		topics = append(topics, topic)
+		snaps = append(snaps, bs)
+	}
+
+	for i, topic := range topics {
+		s.hub.Subscribe(sock, topic, snaps[i])
+	}
+	s.watchTickers(sock, topics)
+	return "Subscribed", topics, nil
+}
+
+func (s *Server) wsUnsubscribe(sock *socket.Socket, data json.RawMessage) (string, interface{}, error) {
+	var req subscribeRequest
+	if err := decode(data, &req); err != nil {
+		return "", nil, err
+	}
+
+	topics := []string{}
+	for _, topic := range req.Topics {
+		topic = hub.CanonicalTopic(topic)
+		s.hub.Unsubscribe(sock, topic)
+		topics = append(topics, topic)
+	}
+	s.unwatchTickers(sock, topics)
+	return "Unsubscribed", topics, nil
+}
+
+// openTickers starts tracking the markets watched by `sock`.
+func (s *Server) openTickers(sock *socket.Socket) {
+	s.Lock()
+	defer s.Unlock()
+	s.tickers[sock] = map[string]struct{}{}
+}
+
+// watchTickers watches the market of each ticker topic in `topics` for
+// `sock`, once per market however often it subscribes.  Sockets which have
+// disconnected no longer watch markets.
+func (s *Server) watchTickers(sock *socket.Socket, topics []string) {
+	s.Lock()
+	defer s.Unlock()
+
+	ms, ok := s.tickers[sock]
+	if !ok {
+		return
+	}
+	for _, topic := range topics {
+		if kind, m := hub.ParseTopic(topic); kind == hub.TopicTicker {
+			if _, ok := ms[m]; !ok {
+				ms[m] = struct{}{}
+				s.app.WatchMarket(m)
+			}
+		}
+	}
+}
+
+// unwatchTickers releases the markets of the ticker topics in `topics`
+// watched by `sock`.
+func (s *Server) unwatchTickers(sock *socket.Socket, topics []string) {
+	s.Lock()
+	defer s.Unlock()
+
+	ms := s.tickers[sock]
+	for _, topic := range topics {
+		if kind, m := hub.ParseTopic(topic); kind == hub.TopicTicker {
+			if _, ok := ms[m]; ok {
+				delete(ms, m)
+				s.app.UnwatchMarket(m)
+			}
+		}
+	}
+}
+
+// releaseTickers releases every market watched by `sock` once it disconnects.
+func (s *Server) releaseTickers(sock *socket.Socket) {
+	s.Lock()
+	defer s.Unlock()
+
+	for m := range s.tickers[sock] {
+		s.app.UnwatchMarket(m)
+	}
+	delete(s.tickers, sock)
+}
+
+func (s *Server) wsGetBalances(sock *socket.Socket, data json.RawMessage) (string, interface{}, error) {
+	bs, err := s.app.GetBalances()
+	return "Balance", bs, err
+}
+
+func (s *Server) wsRefresh(sock *socket.Socket, data json.RawMessage) (string, interface{}, error) {
+	if err := s.app.UpdateBalances(false); err != nil {
+		return "", nil, err
+	}
+	return s.wsGetBalances(sock, data)
+}
+
+func (s *Server) wsGetSessions(sock *socket.Socket, data json.RawMessage) (string, interface{}, error) {
+	ss, err := s.app.GetSessions()
+	return "Sessions", ss, err
+}
+
+func (s *Server) wsPreviewSession(sock *socket.Socket, data json.RawMessage) (string, interface{}, error) {
+	var req createSessionRequest
+	if err := decode(data, &req); err != nil {
+		return "", nil, err
+	}
+	if len(req.Strategy) == 0 || len(req.Currency) == 0 {
+		return "", nil, errors.New("Strategy and Currency are required")
+	}
+
+	p, err := s.app.PreviewSession(req.Strategy, req.Currency, req.Params)
+	return "SessionPreview", p, err
+}
+
+func (s *Server) wsCreateSession(sock *socket.Socket, data json.RawMessage) (string, interface{}, error) {
+	var req createSessionRequest
+	if err := decode(data, &req); err != nil {
+		return "", nil, err
+	}
+	if len(req.Strategy) == 0 || len(req.Currency) == 0 {
+		return "", nil, errors.New("Strategy and Currency are required")
+	}
+
+	ses, err := s.app.CreateSession(req.Strategy, req.Currency, req.Params)
+	return "Session", ses, err
+}
+
+func (s *Server) wsCancelSession(sock *socket.Socket, data json.RawMessage) (string, interface{}, error) {
+	var req cancelSessionRequest
+	if err := decode(data, &req); err != nil {
+		return "", nil, err
+	}
+	if len(req.ID) == 0 {
+		return "", nil, errors.New("ID is required")
+	}
+
+	ses, err := s.app.CancelSession(req.ID)
+	return "Session", ses, err
+}
+
+func (s *Server) wsResolveOrphan(sock *socket.Socket, data json.RawMessage) (string, interface{}, error) {
+	var req wsResolveOrphanRequest
+	if err := decode(data, &req); err != nil {
+		return "", nil, err
+	}
+	if len(req.UUID) == 0 || len(req.Action) == 0 {
+		return "", nil, errors.New("UUID and Action are required")
+	}
+
+	r, err := s.app.ResolveOrphan(req.UUID, req.Action, req.Session)
+	return "Reconciliation", r, err
+}
+
+func (s *Server) wsHalt(sock *socket.Socket, data json.RawMessage) (string, interface{}, error) {
+	var req haltRequest
+	if err := decode(data, &req); err != nil {
+		return "", nil, err
+	}
+
+	h, err := s.app.Halt(req.Exit)
+	return "Halt", h, err
+}
+
+func (s *Server) wsRearm(sock *socket.Socket, data json.RawMessage) (string, interface{}, error) {
+	k, err := s.app.Rearm()
+	return "KillSwitch", k, err
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func (s *Server) wsHandlers() map[string]wsFunc {
+	return map[string]wsFunc{
+		reqSubscribe:      s.wsSubscribe,
+		reqUnsubscribe:    s.wsUnsubscribe,
+		reqGetBalances:    s.wsGetBalances,
+		reqRefresh:        s.wsRefresh,
+		reqGetSessions:    s.wsGetSessions,
+		reqPreviewSession: s.wsPreviewSession,
+		reqCreateSession:  s.wsCreateSession,
+		reqCancelSession:  s.wsCancelSession,
+		reqResolveOrphan:  s.wsResolveOrphan,
+		reqHalt:           s.wsHalt,
+		reqRearm:          s.wsRearm,
+	}
+}
+
+// handleSocketMessage parses `msg` as a types.SocketRequest, dispatches it to
+// the matching handler and sends the response (or error) back to `sock` only.
+func (s *Server) handleSocketMessage(sock *socket.Socket, msg []byte) {
+	var req types.SocketRequest
+	var resp *types.SocketMessage
+
+	if err := json.Unmarshal(msg, &req); err != nil {
+		resp = types.NewSocketError("", fmt.Errorf("invalid request: %s", err.Error()))
+	} else if fn, ok := s.wsFns[req.Type]; !ok {
+		resp = types.NewSocketError(req.ID, fmt.Errorf("unknown request type %q", req.Type))
+	} else if t, data, err := fn(sock, req.Data); err != nil {
+		resp = types.NewSocketError(req.ID, err)
+	} else {
+		resp = types.NewSocketResponse(req.ID, t, data)
+	}
+
+	bs, err := resp.Marshal()
+	if err != nil {
+		fmt.Printf("wsHandler :: unable to marshal response :: %s\n", err.Error())
+		return
+	}
+	sock.Send(bs)
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,114 @@
+package server
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sabhiram/trade-bot/app"
+	"github.com/sabhiram/trade-bot/exchange"
+	"github.com/sabhiram/trade-bot/hub"
+	"github.com/sabhiram/trade-bot/server/socket"
+	"github.com/sabhiram/trade-bot/types"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// newTestServer returns a server for an app over a temporary db, trading on a
+// paper exchange which quotes BTC-PIVX and BTC-LTC, and a function that
+// removes the db.
+func newTestServer(t *testing.T) (*Server, func()) {
+	dir, err := ioutil.TempDir("", "server")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cs := []exchange.Candle{{TimeStamp: time.Now().Add(-time.Minute), Close: decimal.New(1, -3)}}
+	feed := exchange.NewSteppedFeed(map[string][]exchange.Candle{"BTC-PIVX": cs, "BTC-LTC": cs}, time.Minute)
+	ex := exchange.NewPaper(feed, nil, decimal.Zero, decimal.Zero)
+
+	h, _ := hub.New()
+	go h.Run()
+	a, err := app.New(&types.Config{
+		DbPath:       filepath.Join(dir, "db.json"),
+		CandleDir:    filepath.Join(dir, "candles"),
+		SnapshotPath: filepath.Join(dir, "snapshots.json"),
+	}, h, ex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := New("127.0.0.1:0", h, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, func() { os.RemoveAll(dir) }
+}
+
+// request sends the topics `ts` to the websocket handler `fn` for `sock`.
+func request(s *Server, fn wsFunc, sock *socket.Socket, ts ...string) error {
+	bs, _ := json.Marshal(subscribeRequest{Topics: ts})
+	_, _, err := fn(sock, bs)
+	return err
+}
+
+// checkWatched fails `t` unless the app watches exactly the markets `want`.
+func checkWatched(t *testing.T, s *Server, want ...string) {
+	t.Helper()
+	if got := s.app.WatchedMarkets(); !reflect.DeepEqual(got, append([]string{}, want...)) {
+		t.Fatalf("expected %v to be watched, got %v", want, got)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func TestTickerWatches(t *testing.T) {
+	s, cleanup := newTestServer(t)
+	defer cleanup()
+
+	a, b := socket.New(nil, nil), socket.New(nil, nil)
+	for _, sock := range []*socket.Socket{a, b} {
+		s.hub.RegisterSocket(sock)
+		s.openTickers(sock)
+	}
+
+	// Subscribing again does not watch the market twice.
+	for i := 0; i < 2; i++ {
+		if err := request(s, s.wsSubscribe, a, "ticker:btc-pivx"); err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+	}
+	if err := request(s, s.wsSubscribe, b, "ticker:BTC-PIVX", "ticker:BTC-LTC"); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	checkWatched(t, s, "BTC-LTC", "BTC-PIVX")
+
+	// Markets are watched until their last subscriber unsubscribes.
+	for i := 0; i < 2; i++ {
+		request(s, s.wsUnsubscribe, a, "ticker:BTC-PIVX")
+		checkWatched(t, s, "BTC-LTC", "BTC-PIVX")
+	}
+	request(s, s.wsUnsubscribe, b, "ticker:BTC-PIVX")
+	checkWatched(t, s, "BTC-LTC")
+
+	// A failed subscription watches nothing.
+	if err := request(s, s.wsSubscribe, a, "ticker:BTC-LTC", "nope"); err == nil {
+		t.Fatalf("expected an unknown topic")
+	}
+
+	// Disconnecting releases the socket's markets, and they are not watched
+	// again by a request still in flight.
+	s.releaseTickers(b)
+	checkWatched(t, s)
+	request(s, s.wsSubscribe, b, "ticker:BTC-LTC")
+	checkWatched(t, s)
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,293 @@
+package trade
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sabhiram/trade-bot/expr"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+var hundred = decimal.New(100, 0)
+
+var quantityInput = &Input{
+	Prompt: "Quantity to sell (blank for all available): ",
+	Key:    "Quantity",
+}
+
+// parseQuantity resolves the "Quantity" input, defaulting to the entire
+// available balance of the target currency.
+func parseQuantity(t *Trade, args map[string]interface{}) (decimal.Decimal, error) {
+	avail := decimal.Zero
+	if t.TargetBalance != nil {
+		avail = t.TargetBalance.Available
+	}
+
+	q, err := parseDecimalArg(args, "Quantity", true, avail)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	if q.Sign() <= 0 {
+		return decimal.Zero, fmt.Errorf("no %s available to sell", t.Currency)
+	}
+	return q, nil
+}
+
+// arg returns the decimal argument `key`, which the trade's update has parsed.
+func arg(args map[string]interface{}, key string) decimal.Decimal {
+	d, _ := args[key].(decimal.Decimal)
+	return d
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func init() {
+	Register(&Trade{
+		Name:        "limit-sell",
+		Description: "regular on-limit sale",
+		Inputs: []*Input{
+			{Prompt: "Sell Limit (in BTC): ", Key: "SellLimit"},
+			{Prompt: "Sell Price (in BTC, blank for the limit): ", Key: "SellPrice"},
+			quantityInput,
+		},
+		evaluate: expr.MustParse("last >= SellLimit"),
+		update: func(t *Trade, args map[string]interface{}) error {
+			limit, err := parseDecimalArg(args, "SellLimit", false, decimal.Zero)
+			if err != nil {
+				return err
+			}
+			if _, err := parseDecimalArg(args, "SellPrice", true, limit); err != nil {
+				return err
+			}
+			_, err = parseQuantity(t, args)
+			return err
+		},
+		execute: func(t *Trade, args map[string]interface{}) error {
+			return t.SellLimit(args, arg(args, "Quantity"), arg(args, "SellPrice"))
+		},
+	})
+
+	Register(&Trade{
+		Name:        "stop-loss",
+		Description: "simple stop loss",
+		Inputs: []*Input{
+			{Prompt: "Stop Price (in BTC): ", Key: "StopPrice"},
+			{Prompt: "Limit offset below stop (in BTC, blank for none): ", Key: "LimitOffset"},
+			quantityInput,
+		},
+		evaluate: expr.MustParse("last <= StopPrice"),
+		update: func(t *Trade, args map[string]interface{}) error {
+			stop, err := parseDecimalArg(args, "StopPrice", false, decimal.Zero)
+			if err != nil {
+				return err
+			}
+			offset, err := parseDecimalArg(args, "LimitOffset", true, decimal.Zero)
+			if err != nil {
+				return err
+			}
+			if stop.Sub(offset).Sign() <= 0 {
+				return errors.New("limit offset must be smaller than the stop price")
+			}
+			_, err = parseQuantity(t, args)
+			return err
+		},
+		execute: func(t *Trade, args map[string]interface{}) error {
+			rate := arg(args, "StopPrice").Sub(arg(args, "LimitOffset"))
+			return t.SellLimit(args, arg(args, "Quantity"), rate)
+		},
+	})
+
+	Register(&Trade{
+		Name:        "high-low",
+		Description: "stop-loss + limit-sell (first one wins)",
+		Inputs: []*Input{
+			{Prompt: "High Price (in BTC): ", Key: "HighPrice"},
+			{Prompt: "Low Price (in BTC): ", Key: "LowPrice"},
+			{Prompt: "Limit offset below low (in BTC, blank for none): ", Key: "LimitOffset"},
+			quantityInput,
+		},
+		evaluate: expr.MustParse("TargetFilled or last <= LowPrice"),
+		update: func(t *Trade, args map[string]interface{}) error {
+			high, err := parseDecimalArg(args, "HighPrice", false, decimal.Zero)
+			if err != nil {
+				return err
+			}
+			low, err := parseDecimalArg(args, "LowPrice", false, decimal.Zero)
+			if err != nil {
+				return err
+			}
+			offset, err := parseDecimalArg(args, "LimitOffset", true, decimal.Zero)
+			if err != nil {
+				return err
+			}
+			if high.LessThanOrEqual(low) {
+				return errors.New("high price must be above the low price")
+			}
+			if low.Sub(offset).Sign() <= 0 {
+				return errors.New("limit offset must be smaller than the low price")
+			}
+			qty, err := parseQuantity(t, args)
+			if err != nil {
+				return err
+			}
+			if _, err := parseDecimalArg(args, "StopQuantity", true, qty); err != nil {
+				return err
+			}
+			args["TargetFilled"] = false
+
+			// The high leg is placed by arm once the trade is running.
+			target, _ := args["TargetOrder"].(string)
+			if len(target) == 0 {
+				return nil
+			}
+
+			// The low leg is watched locally and only sells what the high leg
+			// has not filled yet.
+			o, err := t.Exchange.GetOrder(target)
+			if err != nil {
+				t.logf("%s :: unable to get order %s :: %s\n", t.Name, target, err.Error())
+				return nil
+			}
+			if !o.IsOpen && o.QuantityRemaining.Sign() > 0 {
+				return fmt.Errorf("target order %s was cancelled outside of the trade", target)
+			}
+			args["StopQuantity"] = o.QuantityRemaining
+			args["TargetFilled"] = !o.IsOpen
+			return nil
+		},
+		execute: func(t *Trade, args map[string]interface{}) error {
+			if args["TargetFilled"].(bool) {
+				t.logf("%s :: high leg filled, cancelling low leg\n", t.Name)
+				args["Leg"] = "high"
+				return nil
+			}
+
+			// Cancel the high leg before selling the rest at the low leg.
+			t.logf("%s :: low leg triggered, cancelling high leg\n", t.Name)
+			args["Leg"] = "low"
+			qty := arg(args, "StopQuantity")
+			if target, _ := args["TargetOrder"].(string); len(target) > 0 {
+				o, err := t.CancelOrder(target)
+				if err != nil {
+					return err
+				}
+				qty = o.QuantityRemaining
+				args["StopQuantity"] = qty
+			}
+			if qty.Sign() <= 0 {
+				t.logf("%s :: high leg filled while cancelling\n", t.Name)
+				args["Leg"] = "high"
+				return nil
+			}
+
+			return t.SellLimit(args, qty, arg(args, "LowPrice").Sub(arg(args, "LimitOffset")))
+		},
+		arm: func(t *Trade, args map[string]interface{}) error {
+			// The high leg rests on the exchange as a limit sell.
+			if target, _ := args["TargetOrder"].(string); len(target) > 0 {
+				return nil
+			}
+			if err := t.SellLimit(args, arg(args, "Quantity"), arg(args, "HighPrice")); err != nil {
+				return err
+			}
+			args["TargetOrder"] = args["OrderUUID"]
+			return nil
+		},
+		state: []string{"TargetOrder", "StopQuantity", "Leg"},
+	})
+
+	Register(&Trade{
+		Name:        "trailing-stop",
+		Description: "stop loss which trails the highest price",
+		Inputs: []*Input{
+			{Prompt: "Trail by percent (blank to trail by amount): ", Key: "TrailPercent"},
+			{Prompt: "Trail by amount (in BTC, blank to trail by percent): ", Key: "TrailAmount"},
+			{Prompt: "Activation price (in BTC, blank to trail immediately): ", Key: "ActivationPrice"},
+			{Prompt: "Limit offset below stop (in BTC, blank for none): ", Key: "LimitOffset"},
+			quantityInput,
+		},
+		evaluate: expr.MustParse("Active and last <= StopPrice"),
+		update: func(t *Trade, args map[string]interface{}) error {
+			pct, err := parseDecimalArg(args, "TrailPercent", true, decimal.Zero)
+			if err != nil {
+				return err
+			}
+			amt, err := parseDecimalArg(args, "TrailAmount", true, decimal.Zero)
+			if err != nil {
+				return err
+			}
+			if (pct.Sign() > 0) == (amt.Sign() > 0) {
+				return errors.New("exactly one of trail percent or trail amount is required")
+			}
+			if pct.Sign() < 0 || pct.GreaterThanOrEqual(hundred) || amt.Sign() < 0 {
+				return errors.New("trail must be a positive amount or a percent below 100")
+			}
+			activation, err := parseDecimalArg(args, "ActivationPrice", true, decimal.Zero)
+			if err != nil {
+				return err
+			}
+			offset, err := parseDecimalArg(args, "LimitOffset", true, decimal.Zero)
+			if err != nil {
+				return err
+			}
+			if _, err := parseQuantity(t, args); err != nil {
+				return err
+			}
+
+			// The high-water mark and activation are restored from the
+			// session's state across restarts.
+			hwm, err := parseDecimalArg(args, "HighWaterMark", true, decimal.Zero)
+			if err != nil {
+				return err
+			}
+			active := parseBoolArg(args, "Active")
+
+			if last, ok := args["Last"].(decimal.Decimal); ok {
+				if !active && last.GreaterThanOrEqual(activation) {
+					t.logf("%s :: trailing from %s\n", t.Name, last.StringFixed(8))
+					active = true
+				}
+				if active && last.GreaterThan(hwm) {
+					hwm = last
+				}
+			}
+
+			// Until the trade is active its stop is the one it activates
+			// with, so that a trail too large for the activation price is
+			// rejected before the trade runs.
+			from := hwm
+			if !active {
+				from = activation
+			}
+			stop := decimal.Zero
+			if from.Sign() > 0 {
+				if pct.Sign() > 0 {
+					stop = from.Mul(hundred.Sub(pct)).Div(hundred).Round(8)
+				} else {
+					stop = from.Sub(amt)
+				}
+				if stop.Sub(offset).Sign() <= 0 {
+					return fmt.Errorf("trail and limit offset must be smaller than the price trailed from (%s)", from.StringFixed(8))
+				}
+			}
+
+			args["Active"] = active
+			args["HighWaterMark"] = hwm
+			args["StopPrice"] = stop
+			return nil
+		},
+		execute: func(t *Trade, args map[string]interface{}) error {
+			t.logf("%s :: retraced from %s to %s\n", t.Name, arg(args, "HighWaterMark").StringFixed(8), arg(args, "Last").StringFixed(8))
+			rate := arg(args, "StopPrice").Sub(arg(args, "LimitOffset"))
+			return t.SellLimit(args, arg(args, "Quantity"), rate)
+		},
+		state: []string{"Active", "HighWaterMark"},
+	})
+}
+
+////////////////////////////////////////////////////////////////////////////////
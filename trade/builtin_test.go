@@ -0,0 +1,358 @@
+package trade
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sabhiram/trade-bot/exchange"
+	"github.com/sabhiram/trade-bot/indicator"
+	"github.com/sabhiram/trade-bot/types"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+func dec(s string) decimal.Decimal {
+	d, err := decimal.NewFromString(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// newTestTrade returns the trade `name` on BTC-PIVX, bound to a paper exchange
+// holding 100 PIVX (without fees or slippage) over a feed which steps through
+// candles closing at `closes`.  The feed quotes a bid and an ask 0.1% either
+// side of the close.
+func newTestTrade(t *testing.T, name string, closes ...string) (*Trade, *exchange.Paper, *exchange.Stepped) {
+	t.Helper()
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	cs := []exchange.Candle{}
+	for i, c := range closes {
+		cs = append(cs, exchange.Candle{TimeStamp: start.Add(time.Duration(i) * time.Minute), Close: dec(c)})
+	}
+
+	feed := exchange.NewSteppedFeed(map[string][]exchange.Candle{"BTC-PIVX": cs}, time.Minute)
+	ex := exchange.NewPaper(feed, map[string]decimal.Decimal{"PIVX": dec("100")}, decimal.Zero, decimal.Zero)
+
+	tr, err := New(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr.Indicators = indicator.NewSource(feed, 0)
+	target := &types.Balance{Currency: "PIVX", Available: dec("100"), Total: dec("100")}
+	if err := tr.Setup(ex, "PIVX", target, &types.Balance{Currency: "BTC"}, &types.Balance{Currency: "USDT"}); err != nil {
+		t.Fatal(err)
+	}
+	return tr, ex, feed
+}
+
+// params returns the trade arguments "Key=Value ..." in `s`.
+func params(s string) map[string]interface{} {
+	args := map[string]interface{}{}
+	for _, kv := range strings.Fields(s) {
+		parts := strings.SplitN(kv, "=", 2)
+		args[parts[0]] = parts[1]
+	}
+	return args
+}
+
+// runTrade steps `tr` once per candle of `feed` until it executes and returns
+// the number of steps taken.  It fails `t` unless the trade executes by the
+// last candle.
+func runTrade(t *testing.T, tr *Trade, feed *exchange.Stepped, args map[string]interface{}) int {
+	t.Helper()
+	for n := 1; ; n++ {
+		done, err := tr.Step(args)
+		if err != nil {
+			t.Fatalf("step %d: unexpected error: %s", n, err.Error())
+		}
+		if done {
+			return n
+		}
+		if !feed.Step() {
+			t.Fatalf("expected the trade to execute by the last candle")
+		}
+	}
+}
+
+// checkOrders fails `t` unless the trade placed a sell of each quantity @
+// rate in `want` ("100@1.1"), in order, and returns the orders.
+func checkOrders(t *testing.T, tr *Trade, want ...string) []exchange.Order {
+	t.Helper()
+	if len(tr.Orders) != len(want) {
+		t.Fatalf("expected %d orders, got %d", len(want), len(tr.Orders))
+	}
+	ret := []exchange.Order{}
+	for i, uuid := range tr.Orders {
+		o, err := tr.Exchange.GetOrder(uuid)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+		parts := strings.SplitN(want[i], "@", 2)
+		if o.Type != exchange.OrderTypeLimitSell || !o.Quantity.Equal(dec(parts[0])) || !o.Limit.Equal(dec(parts[1])) {
+			t.Fatalf("order %d: expected a sell of %s, got %s %s @ %s", i, want[i], o.Type, o.Quantity, o.Limit)
+		}
+		ret = append(ret, o)
+	}
+	return ret
+}
+
+// partialExchange reports the first order placed through it as partly filled
+// by `filled`, as the paper exchange only fills orders in full.
+type partialExchange struct {
+	*exchange.Paper
+	first  string
+	filled decimal.Decimal
+}
+
+func (e *partialExchange) SellLimit(market string, quantity, rate decimal.Decimal) (string, error) {
+	uuid, err := e.Paper.SellLimit(market, quantity, rate)
+	if len(e.first) == 0 {
+		e.first = uuid
+	}
+	return uuid, err
+}
+
+func (e *partialExchange) GetOrder(uuid string) (exchange.Order, error) {
+	o, err := e.Paper.GetOrder(uuid)
+	if err == nil && uuid == e.first && o.QuantityRemaining.Sign() > 0 {
+		o.QuantityRemaining = o.QuantityRemaining.Sub(e.filled)
+	}
+	return o, err
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func TestResolve(t *testing.T) {
+	for _, tc := range []struct {
+		trade  string
+		params string
+		err    string // empty if the params are valid
+	}{
+		{"limit-sell", "SellLimit=1.1", ""},
+		{"limit-sell", "SellLimit=abc", `SellLimit: invalid number "abc"`},
+		{"limit-sell", "SellLimit=1.1 Quantity=0", "no PIVX available to sell"},
+		{"stop-loss", "LimitOffset=0.1", "StopPrice is required"},
+		{"stop-loss", "StopPrice=0.9 LimitOffset=0.9", "limit offset must be smaller than the stop price"},
+		{"high-low", "HighPrice=0.9 LowPrice=0.9", "high price must be above the low price"},
+		{"high-low", "HighPrice=1.1 LowPrice=0.9 LimitOffset=1", "limit offset must be smaller than the low price"},
+		{"trailing-stop", "TrailPercent=10", ""},
+		{"trailing-stop", "", "exactly one of trail percent or trail amount is required"},
+		{"trailing-stop", "TrailPercent=10 TrailAmount=0.1", "exactly one of trail percent or trail amount is required"},
+		{"trailing-stop", "TrailPercent=100", "trail must be a positive amount or a percent below 100"},
+
+		// Trails too large for the market are rejected before the trade runs,
+		// against the current price (1) or the activation price.
+		{"trailing-stop", "TrailAmount=1", "smaller than the price trailed from (1.00000000)"},
+		{"trailing-stop", "TrailAmount=0.5 LimitOffset=0.5", "smaller than the price trailed from (1.00000000)"},
+		{"trailing-stop", "TrailAmount=1.2 ActivationPrice=1.2", "smaller than the price trailed from (1.20000000)"},
+		{"trailing-stop", "TrailAmount=1.1 ActivationPrice=1.2", ""},
+	} {
+		t.Run(tc.trade+" "+tc.params, func(t *testing.T) {
+			tr, _, _ := newTestTrade(t, tc.trade, "1")
+			_, err := tr.Resolve(params(tc.params))
+			if len(tc.err) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err.Error())
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Fatalf("expected %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestResolveDefaults(t *testing.T) {
+	tr, _, _ := newTestTrade(t, "limit-sell", "1")
+	ps, err := tr.Resolve(params("SellLimit=1.1"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if ps["SellPrice"] != "1.1" || ps["Quantity"] != "100" {
+		t.Fatalf("expected the limit and all available PIVX, got %v", ps)
+	}
+	if _, ok := ps["Last"]; ok {
+		t.Fatalf("expected only the trade's inputs, got %v", ps)
+	}
+}
+
+func TestLimitSell(t *testing.T) {
+	tr, _, feed := newTestTrade(t, "limit-sell", "1", "1.05", "1.1", "1.2")
+	args := params("SellLimit=1.1 Quantity=40")
+	if err := tr.Start(args); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if n := runTrade(t, tr, feed, args); n != 3 {
+		t.Fatalf("expected the trade to execute at 1.1, executed on step %d", n)
+	}
+	checkOrders(t, tr, "40@1.1")
+
+	// The order rests until the bid reaches the limit.
+	feed.Step()
+	if placed := checkOrders(t, tr, "40@1.1"); placed[0].IsOpen || !placed[0].PricePerUnit.Equal(dec("1.1988")) {
+		t.Fatalf("expected the order to fill at the bid of 1.1988, got %#v", placed[0])
+	}
+}
+
+func TestStopLoss(t *testing.T) {
+	tr, _, feed := newTestTrade(t, "stop-loss", "1", "0.95", "0.9")
+	args := params("StopPrice=0.92 LimitOffset=0.01")
+	if err := tr.Start(args); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if n := runTrade(t, tr, feed, args); n != 3 {
+		t.Fatalf("expected the trade to execute at 0.9, executed on step %d", n)
+	}
+	checkOrders(t, tr, "100@0.91")
+}
+
+func TestHighLowHighLeg(t *testing.T) {
+	tr, _, feed := newTestTrade(t, "high-low", "1", "1.05", "1.2", "1.2")
+	args := params("HighPrice=1.1 LowPrice=0.9")
+	if err := tr.Start(args); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if len(tr.Orders) != 0 {
+		t.Fatalf("expected no order before the trade runs, got %d", len(tr.Orders))
+	}
+
+	// The high leg rests from the first step and fills at 1.2, after which
+	// the trade completes without placing the low leg.
+	runTrade(t, tr, feed, args)
+	if placed := checkOrders(t, tr, "100@1.1"); placed[0].IsOpen || placed[0].QuantityRemaining.Sign() != 0 {
+		t.Fatalf("expected the high leg to fill, got %#v", placed[0])
+	}
+	if args["Leg"] != "high" || args["TargetOrder"] != tr.Orders[0] {
+		t.Fatalf("expected the high leg to win, got %v", args["Leg"])
+	}
+}
+
+func TestHighLowLowLeg(t *testing.T) {
+	tr, _, feed := newTestTrade(t, "high-low", "1", "1", "0.85")
+	args := params("HighPrice=1.1 LowPrice=0.9 LimitOffset=0.01")
+	if err := tr.Start(args); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if n := runTrade(t, tr, feed, args); n != 3 {
+		t.Fatalf("expected the trade to execute at 0.85, executed on step %d", n)
+	}
+
+	// The high leg is cancelled before the low leg sells everything.
+	placed := checkOrders(t, tr, "100@1.1", "100@0.89")
+	if placed[0].IsOpen || !placed[0].CancelInitiated {
+		t.Fatalf("expected the high leg to be cancelled, got %#v", placed[0])
+	}
+	if args["Leg"] != "low" {
+		t.Fatalf("expected the low leg to win, got %v", args["Leg"])
+	}
+}
+
+func TestHighLowPartialFill(t *testing.T) {
+	tr, paper, feed := newTestTrade(t, "high-low", "1", "1", "0.85")
+	tr.Exchange = &partialExchange{Paper: paper, filled: dec("40")}
+	args := params("HighPrice=1.1 LowPrice=0.9")
+	if err := tr.Start(args); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	if done, err := tr.Step(args); done || err != nil {
+		t.Fatalf("expected the trade to run, got %t (%v)", done, err)
+	}
+	if q := arg(args, "StopQuantity"); !q.Equal(dec("60")) {
+		t.Fatalf("expected the low leg to cover the 60 unfilled, got %s", q)
+	}
+
+	// Only what the high leg has not sold is sold by the low leg.
+	feed.Step()
+	runTrade(t, tr, feed, args)
+	checkOrders(t, tr, "100@1.1", "60@0.9")
+}
+
+func TestTrailingStopRestart(t *testing.T) {
+	tr, _, feed := newTestTrade(t, "trailing-stop", "1", "1.2", "1.25", "1.15", "1.1")
+	inputs := "TrailPercent=10 ActivationPrice=1.1"
+	args := params(inputs)
+	if err := tr.Start(args); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	// Not active at 1, then trailing from 1.2.
+	for _, active := range []bool{false, true} {
+		if done, err := tr.Step(args); done || err != nil {
+			t.Fatalf("expected the trade to run, got %t (%v)", done, err)
+		}
+		if args["Active"] != active {
+			t.Fatalf("expected active to be %t", active)
+		}
+		feed.Step()
+	}
+	if !arg(args, "StopPrice").Equal(dec("1.08")) {
+		t.Fatalf("expected a stop of 1.08, got %s", arg(args, "StopPrice"))
+	}
+
+	// A restarted trade resumes from its persisted state.
+	state := tr.State(args)
+	if state["Active"] != "true" || state["HighWaterMark"] != "1.2" {
+		t.Fatalf("unexpected state %v", state)
+	}
+	tr2, err := New("trailing-stop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr2.Indicators = tr.Indicators
+	tr2.Setup(tr.Exchange, "PIVX", tr.TargetBalance, tr.BTCBalance, tr.USDTBalance)
+	args = params(inputs)
+	for k, v := range state {
+		args[k] = v
+	}
+	if err := tr2.Start(args); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if args["Active"] != true || !arg(args, "StopPrice").Equal(dec("1.08")) {
+		t.Fatalf("expected an active stop at 1.08, got %v at %s", args["Active"], arg(args, "StopPrice"))
+	}
+
+	// It trails up to 1.25 and sells at 10% below once the price retraces.
+	if n := runTrade(t, tr2, feed, args); n != 3 {
+		t.Fatalf("expected the trade to execute at 1.1, executed on step %d", n)
+	}
+	if !arg(args, "HighWaterMark").Equal(dec("1.25")) {
+		t.Fatalf("expected a high-water mark of 1.25, got %s", arg(args, "HighWaterMark"))
+	}
+	checkOrders(t, tr2, "100@1.125")
+}
+
+func TestPreviewTrailingStop(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		params string
+		rate   string
+	}{
+		{"trailing", "TrailPercent=10", "0.9"},
+		{"not active", "TrailPercent=10 ActivationPrice=1.2", "1.08"},
+		{"not active with an offset", "TrailAmount=0.1 ActivationPrice=1.2 LimitOffset=0.05", "1.05"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tr, ex, _ := newTestTrade(t, "trailing-stop", "1")
+			placed, err := tr.Preview(params(tc.params))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err.Error())
+			}
+			if len(placed) != 1 || placed[0].Type != exchange.OrderTypeLimitSell || !placed[0].Limit.Equal(dec(tc.rate)) || !placed[0].Quantity.Equal(dec("100")) {
+				t.Fatalf("expected a sell of 100 @ %s, got %#v", tc.rate, placed)
+			}
+			if open, _ := ex.GetOpenOrders(exchange.AllMarkets); len(open) != 0 || len(tr.Orders) != 0 {
+				t.Fatalf("expected no orders to be placed, got %d", len(open))
+			}
+		})
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
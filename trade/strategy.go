@@ -0,0 +1,380 @@
+package trade
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sabhiram/trade-bot/expr"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Input types supported by strategy files.
+const (
+	InputNumber = "number"
+	InputString = "string"
+)
+
+// Action types supported by strategy files.
+const (
+	ActionBuy    = "buy"
+	ActionSell   = "sell"
+	ActionCancel = "cancel"
+	ActionNotify = "notify"
+)
+
+// DefaultAvailable as the default of a number input resolves to the available
+// balance of the trade's currency.
+const DefaultAvailable = "available"
+
+////////////////////////////////////////////////////////////////////////////////
+
+// StrategyInput describes a single input of a strategy file.
+type StrategyInput struct {
+	Key      string           `json:"Key"`
+	Prompt   string           `json:"Prompt"`
+	Type     string           `json:"Type"`     // "number" (default) or "string"
+	Default  string           `json:"Default"`  // value used when left blank
+	Optional bool             `json:"Optional"` // blank is allowed (strings only)
+	Min      *decimal.Decimal `json:"Min"`      // numbers only
+	Max      *decimal.Decimal `json:"Max"`      // numbers only
+	Options  []string         `json:"Options"`  // strings only, allowed values
+}
+
+// StrategyAction is a single step run, in order, once a strategy's condition
+// is met.  `Quantity` and `Rate` are either numbers or the key of an argument
+// (an input, or one of "Last", "Bid" and "Ask").
+type StrategyAction struct {
+	Type     string `json:"Type"`
+	Quantity string `json:"Quantity"` // buy and sell
+	Rate     string `json:"Rate"`     // buy and sell
+	Order    string `json:"Order"`    // cancel: argument holding the order uuid, blank for all
+	Message  string `json:"Message"`  // notify: text/template rendered with the arguments
+}
+
+// Strategy is a trade defined in a strategy file.
+type Strategy struct {
+	Name        string            `json:"Name"`
+	Description string            `json:"Description"`
+	Inputs      []*StrategyInput  `json:"Inputs"`
+	Evaluate    string            `json:"Evaluate"` // condition, see package expr
+	Actions     []*StrategyAction `json:"Actions"`
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// LoadStrategies registers every strategy file ("*.json") found in `dir` and
+// returns the names of the strategies loaded.  Strategies may not replace an
+// already registered trade.  Only JSON is loaded, no YAML library is vendored.
+func LoadStrategies(dir string) ([]string, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, p := range paths {
+		t, err := loadStrategy(p)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", p, err.Error())
+		}
+		Register(t)
+		names = append(names, t.Name)
+	}
+	return names, nil
+}
+
+func loadStrategy(path string) (*Trade, error) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var s Strategy
+	dec := json.NewDecoder(bytes.NewReader(bs))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&s); err != nil {
+		return nil, err
+	}
+
+	if _, ok := tradeMap[s.Name]; ok {
+		return nil, fmt.Errorf("trade %s already exists", s.Name)
+	}
+	return s.Trade()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Trade validates the strategy and returns it as a trade.
+func (s *Strategy) Trade() (*Trade, error) {
+	if len(s.Name) == 0 || strings.ContainsAny(s.Name, " \t\n") {
+		return nil, fmt.Errorf("invalid name %q", s.Name)
+	}
+	cond, err := expr.Parse(s.Evaluate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid evaluate %q: %s", s.Evaluate, err.Error())
+	}
+	if len(s.Actions) == 0 {
+		return nil, errors.New("at least one action is required")
+	}
+
+	keys := map[string]bool{"Last": true, "Bid": true, "Ask": true}
+	vars := map[string]expr.Type{"Last": expr.Number, "Bid": expr.Number, "Ask": expr.Number}
+	inputs := []*Input{}
+	for _, in := range s.Inputs {
+		if err := in.validate(); err != nil {
+			return nil, err
+		}
+		if keys[in.Key] {
+			return nil, fmt.Errorf("duplicate input %s", in.Key)
+		}
+		keys[in.Key] = true
+		inputs = append(inputs, &Input{Prompt: in.Prompt, Key: in.Key})
+		if in.Type == InputNumber {
+			vars[in.Key] = expr.Number
+		} else {
+			vars[in.Key] = expr.Invalid
+		}
+	}
+	if err := cond.Check(vars); err != nil {
+		return nil, fmt.Errorf("invalid evaluate %q: %s", s.Evaluate, err.Error())
+	}
+
+	for i, a := range s.Actions {
+		if err := a.validate(keys); err != nil {
+			return nil, fmt.Errorf("action %d: %s", i+1, err.Error())
+		}
+	}
+
+	return &Trade{
+		Name:        s.Name,
+		Description: s.Description,
+		Inputs:      inputs,
+		evaluate:    cond,
+		update:      s.update,
+		execute:     s.execute,
+	}, nil
+}
+
+func (in *StrategyInput) validate() error {
+	if len(in.Key) == 0 {
+		return errors.New("input key is required")
+	}
+	if len(in.Prompt) == 0 {
+		in.Prompt = in.Key + ": "
+	}
+
+	switch in.Type {
+	case "":
+		in.Type = InputNumber
+		fallthrough
+	case InputNumber:
+		if len(in.Options) > 0 {
+			return fmt.Errorf("input %s: options are only valid for strings", in.Key)
+		}
+		if in.Min != nil && in.Max != nil && in.Min.GreaterThan(*in.Max) {
+			return fmt.Errorf("input %s: min is above max", in.Key)
+		}
+		if d := in.Default; len(d) > 0 && d != DefaultAvailable {
+			if _, err := decimal.NewFromString(d); err != nil {
+				return fmt.Errorf("input %s: invalid default %q", in.Key, d)
+			}
+		}
+
+		// A blank number could not be used by the condition or the actions,
+		// left blank it takes its default instead.
+		if in.Optional && len(in.Default) == 0 {
+			return fmt.Errorf("input %s: optional numbers need a default", in.Key)
+		}
+	case InputString:
+		if in.Min != nil || in.Max != nil {
+			return fmt.Errorf("input %s: min and max are only valid for numbers", in.Key)
+		}
+	default:
+		return fmt.Errorf("input %s: unknown type %q", in.Key, in.Type)
+	}
+	return nil
+}
+
+func (a *StrategyAction) validate(keys map[string]bool) error {
+	operand := func(name, v string) error {
+		if len(v) == 0 {
+			return fmt.Errorf("%s is required", name)
+		}
+		if _, err := decimal.NewFromString(v); err != nil && !keys[v] {
+			return fmt.Errorf("%s %q is neither a number nor an input", name, v)
+		}
+		return nil
+	}
+
+	switch a.Type {
+	case ActionBuy, ActionSell:
+		if err := operand("quantity", a.Quantity); err != nil {
+			return err
+		}
+		return operand("rate", a.Rate)
+	case ActionCancel:
+		if len(a.Order) > 0 && !keys[a.Order] {
+			return fmt.Errorf("order %q is not an input", a.Order)
+		}
+	case ActionNotify:
+		if _, err := template.New("notify").Parse(a.Message); err != nil {
+			return fmt.Errorf("invalid message: %s", err.Error())
+		}
+	default:
+		return fmt.Errorf("unknown action %q", a.Type)
+	}
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// update parses and validates the strategy's inputs in `args`.
+func (s *Strategy) update(t *Trade, args map[string]interface{}) error {
+	for _, in := range s.Inputs {
+		if err := in.parse(t, args); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (in *StrategyInput) parse(t *Trade, args map[string]interface{}) error {
+	if str, ok := args[in.Key].(string); args[in.Key] == nil || (ok && len(strings.TrimSpace(str)) == 0) {
+		switch {
+		case len(in.Default) > 0:
+			args[in.Key] = in.Default
+		case in.Optional:
+			args[in.Key] = ""
+			return nil
+		default:
+			return fmt.Errorf("%s is required", in.Key)
+		}
+	}
+
+	if in.Type == InputString {
+		v := strings.TrimSpace(formatArg(args[in.Key]))
+		if len(in.Options) > 0 && !contains(in.Options, v) {
+			return fmt.Errorf("%s must be one of %s", in.Key, strings.Join(in.Options, ", "))
+		}
+		args[in.Key] = v
+		return nil
+	}
+
+	if args[in.Key] == DefaultAvailable {
+		avail := decimal.Zero
+		if t.TargetBalance != nil {
+			avail = t.TargetBalance.Available
+		}
+		args[in.Key] = avail
+	}
+	v, err := parseDecimalArg(args, in.Key, false, decimal.Zero)
+	if err != nil {
+		return err
+	}
+	if in.Min != nil && v.LessThan(*in.Min) {
+		return fmt.Errorf("%s must be at least %s", in.Key, in.Min)
+	}
+	if in.Max != nil && v.GreaterThan(*in.Max) {
+		return fmt.Errorf("%s must be at most %s", in.Key, in.Max)
+	}
+	return nil
+}
+
+// execute runs the strategy's actions in order, stopping at the first error.
+func (s *Strategy) execute(t *Trade, args map[string]interface{}) error {
+	for _, a := range s.Actions {
+		if err := a.run(t, args); err != nil {
+			return fmt.Errorf("%s action: %s", a.Type, err.Error())
+		}
+	}
+	return nil
+}
+
+func (a *StrategyAction) run(t *Trade, args map[string]interface{}) error {
+	switch a.Type {
+	case ActionBuy, ActionSell:
+		q, err := operandValue(args, a.Quantity)
+		if err != nil {
+			return err
+		}
+		r, err := operandValue(args, a.Rate)
+		if err != nil {
+			return err
+		}
+		if a.Type == ActionBuy {
+			return t.BuyLimit(args, q, r)
+		}
+		return t.SellLimit(args, q, r)
+
+	case ActionCancel:
+		ids := t.Orders
+		if len(a.Order) > 0 {
+			ids = []string{formatArg(args[a.Order])}
+		}
+		for _, id := range ids {
+			o, err := t.Exchange.GetOrder(id)
+			if err != nil {
+				return err
+			}
+			if !o.IsOpen {
+				continue
+			}
+			if _, err := t.CancelOrder(id); err != nil {
+				return err
+			}
+		}
+
+	case ActionNotify:
+		tpl, err := template.New("notify").Parse(a.Message)
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		if err := tpl.Execute(&buf, args); err != nil {
+			return err
+		}
+		t.Notify(buf.String())
+	}
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// operandValue returns the number `v` or the value of the argument named `v`.
+func operandValue(args map[string]interface{}, v string) (decimal.Decimal, error) {
+	if d, err := decimal.NewFromString(v); err == nil {
+		return d, nil
+	}
+	d, ok := args[v].(decimal.Decimal)
+	if !ok {
+		return decimal.Zero, fmt.Errorf("%s is not a number", v)
+	}
+	return d, nil
+}
+
+func contains(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,74 @@
+package trade
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"strings"
+	"testing"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+func TestStrategyOptionalInputs(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		input StrategyInput
+		err   string // empty if the strategy is valid
+	}{
+		{"optional number", StrategyInput{Key: "Floor", Optional: true}, "input Floor: optional numbers need a default"},
+		{"optional number with a default", StrategyInput{Key: "Floor", Optional: true, Default: "0.9"}, ""},
+		{"optional string", StrategyInput{Key: "Note", Type: InputString, Optional: true}, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			in := tc.input
+			s := &Strategy{
+				Name:     "test-" + strings.Replace(tc.name, " ", "-", -1),
+				Inputs:   []*StrategyInput{&in},
+				Evaluate: "last <= 0.95",
+				Actions:  []*StrategyAction{{Type: ActionNotify, Message: "{{.Last}}"}},
+			}
+			if in.Type != InputString {
+				s.Evaluate = "last <= Floor"
+			}
+
+			_, err := s.Trade()
+			if len(tc.err) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err.Error())
+				}
+				return
+			}
+			if err == nil || err.Error() != tc.err {
+				t.Fatalf("expected %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestStrategyDefaultInput(t *testing.T) {
+	s := &Strategy{
+		Name:     "test-floor",
+		Inputs:   []*StrategyInput{{Key: "Floor", Optional: true, Default: "0.9"}},
+		Evaluate: "last <= Floor",
+		Actions:  []*StrategyAction{{Type: ActionSell, Quantity: "10", Rate: "Floor"}},
+	}
+	st, err := s.Trade()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	Register(st)
+	defer delete(tradeMap, st.Name)
+
+	// The blank input takes its default, which the condition and the sell use.
+	tr, _, feed := newTestTrade(t, st.Name, "1", "0.85")
+	args := params("")
+	if err := tr.Start(args); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if n := runTrade(t, tr, feed, args); n != 2 {
+		t.Fatalf("expected the trade to execute at 0.85, executed on step %d", n)
+	}
+	checkOrders(t, tr, "10@0.9")
+}
+
+////////////////////////////////////////////////////////////////////////////////
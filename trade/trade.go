@@ -0,0 +1,493 @@
+// Package trade implements the conditional orders (trades) that the bot can
+// monitor and execute on behalf of the user.
+package trade
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sabhiram/trade-bot/exchange"
+	"github.com/sabhiram/trade-bot/expr"
+	"github.com/sabhiram/trade-bot/indicator"
+	"github.com/sabhiram/trade-bot/types"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+const (
+	cancelConfirmAttempts = 10
+	cancelConfirmDelay    = 500 * time.Millisecond
+)
+
+// CandleInterval is the candle interval used by the indicator functions of
+// trade conditions (ex: sma(20) is the average of the last 20 closes).
+const CandleInterval = "fiveMin"
+
+////////////////////////////////////////////////////////////////////////////////
+
+type (
+	ExecFunc   func(t *Trade, args map[string]interface{}) error
+	UpdateFunc func(t *Trade, args map[string]interface{}) error
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Input is a single parameter that a trade needs from the user.
+type Input struct {
+	Prompt string
+	Key    string
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Trade represents the required data to represent the appropriate
+// trading condition.  It contains a list of variables to fetch from
+// the user which are stored in a map.  It also contains a condition
+// expression (see package expr) which is evaluated against the numbers
+// and bools in the map and the trade's market.
+//
+// Before every evaluation the map is refreshed with the latest market data
+// for the trade's market under the keys "Last", "Bid" and "Ask".
+type Trade struct {
+	Name        string
+	Description string
+	Inputs      []*Input
+
+	evaluate *expr.Expr
+	execute  ExecFunc
+	update   UpdateFunc
+	arm      UpdateFunc // places resting orders, only once the trade runs
+	state    []string   // keys in args that are persisted across restarts
+	preview  bool       // set on the copy of the trade run by Preview
+
+	// OnUpdate (if set) is called after every successful update so that the
+	// caller can persist the trade's state.
+	OnUpdate UpdateFunc
+
+	// OnNotify (if set) is called with the messages of notify actions.
+	OnNotify func(t *Trade, msg string)
+
+	// Wake (if set) causes Run to re-evaluate the trade immediately instead of
+	// waiting for the next refresh, ex: when new market data arrives.
+	Wake <-chan struct{}
+
+	// Indicators provides the candles for the condition's indicators, Setup
+	// creates one for the exchange if it is not set.
+	Indicators *indicator.Source
+
+	Orders        []string // exchange order UUIDs placed by the trade
+	Exchange      exchange.Exchange
+	Market        string
+	Currency      string
+	TargetBalance *types.Balance
+	BTCBalance    *types.Balance
+	USDTBalance   *types.Balance
+}
+
+// Setup binds the trade to the exchange and the market for `currency`.
+func (t *Trade) Setup(ex exchange.Exchange, currency string, target, btc, usdt *types.Balance) error {
+	t.Exchange = ex
+	if t.Indicators == nil {
+		t.Indicators = indicator.NewSource(ex, indicator.DefaultRefresh)
+	}
+	t.Currency = strings.ToUpper(currency)
+	t.Market = MarketFor(t.Currency)
+	t.TargetBalance = target
+	t.BTCBalance = btc
+	t.USDTBalance = usdt
+	return nil
+}
+
+// Condition returns the trade's condition expression.
+func (t *Trade) Condition() string {
+	return t.evaluate.String()
+}
+
+// Check type checks the trade's condition against the variables in `args`.
+func (t *Trade) Check(args map[string]interface{}) error {
+	vars := map[string]expr.Type{}
+	for k, v := range args {
+		vars[k] = expr.TypeOf(v)
+	}
+	if err := t.evaluate.Check(vars); err != nil {
+		return fmt.Errorf("condition %q: %s", t.evaluate, err.Error())
+	}
+	return nil
+}
+
+// Evaluate evaluates the trade's condition against `args` and the market.
+// Errors fetching market data (ex: not enough candles yet) and divisions by
+// zero are returned as an *expr.Error with a `Cause`, so that the caller can
+// retry.
+func (t *Trade) Evaluate(args map[string]interface{}) (bool, error) {
+	ok, err := t.evaluate.Eval(args, &tradeMarket{t: t, args: args})
+	if e, isExpr := err.(*expr.Error); isExpr && e.Cause != nil {
+		return false, err
+	} else if err != nil {
+		return false, fmt.Errorf("condition %q: %s", t.evaluate, err.Error())
+	}
+	return ok, nil
+}
+
+// Refresh pulls the latest ticker for the trade's market into `args`.
+func (t *Trade) Refresh(args map[string]interface{}) error {
+	tk, err := t.Exchange.GetTicker(t.Market)
+	if err != nil {
+		return err
+	}
+
+	args["Last"] = tk.Last
+	args["Bid"] = tk.Bid
+	args["Ask"] = tk.Ask
+	return nil
+}
+
+// Resolve validates the user supplied `args` against the current market and
+// returns the trade's inputs with any defaults filled in.
+func (t *Trade) Resolve(args map[string]interface{}) (map[string]string, error) {
+	if err := t.Refresh(args); err != nil {
+		return nil, fmt.Errorf("unable to refresh %s: %s", t.Market, err.Error())
+	}
+	if err := t.update(t, args); err != nil {
+		return nil, err
+	}
+	if err := t.Check(args); err != nil {
+		return nil, err
+	}
+
+	ret := map[string]string{}
+	for _, inp := range t.Inputs {
+		ret[inp.Key] = formatArg(args[inp.Key])
+	}
+	return ret, nil
+}
+
+// State returns the values in `args` that the trade persists across restarts.
+func (t *Trade) State(args map[string]interface{}) map[string]string {
+	ret := map[string]string{}
+	for _, k := range t.state {
+		if v, ok := args[k]; ok {
+			ret[k] = formatArg(v)
+		}
+	}
+	return ret
+}
+
+func (t *Trade) doUpdate(args map[string]interface{}) error {
+	if err := t.update(t, args); err != nil {
+		return err
+	}
+	if t.OnUpdate != nil {
+		return t.OnUpdate(t, args)
+	}
+	return nil
+}
+
+// Start resolves the trade's defaults in `args` and type checks its condition
+// against them.  It must be called before the trade is stepped.
+func (t *Trade) Start(args map[string]interface{}) error {
+	// Always update the trade before doing anything else. This will cause the
+	// default values to be setup correctly.  Update should also be called
+	// if the evaluate returns false for the next tick.
+	if err := t.doUpdate(args); err != nil {
+		return err
+	}
+	return t.Check(args)
+}
+
+// Step refreshes the market data in `args` and evaluates the trade's condition
+// once, executing the trade if it is met.  It returns true once the trade has
+// executed.  Market data errors are logged and the trade may be stepped again.
+func (t *Trade) Step(args map[string]interface{}) (bool, error) {
+	if err := t.Refresh(args); err != nil {
+		t.logf("%s :: unable to refresh %s :: %s\n", t.Name, t.Market, err.Error())
+		return false, nil
+	}
+
+	ok, err := t.Evaluate(args)
+	if e, isExpr := err.(*expr.Error); isExpr && e.Cause != nil {
+		t.logf("%s :: unable to evaluate :: %s\n", t.Name, err.Error())
+	} else if err != nil {
+		return false, err
+	} else if ok {
+		return true, t.execute(t, args)
+	}
+
+	// Resting orders are only placed by a running trade, never while its
+	// inputs are resolved.
+	if t.arm != nil {
+		if err := t.arm(t, args); err != nil {
+			return false, err
+		}
+	}
+	return false, t.doUpdate(args)
+}
+
+// Run polls the market every `refreshDuration` until the trade's condition
+// evaluates to true, at which point the trade is executed.  Run returns the
+// context's error if `ctx` is done before the trade executes.
+func (t *Trade) Run(ctx context.Context, args map[string]interface{}, refreshDuration time.Duration) error {
+	if err := t.Start(args); err != nil {
+		return err
+	}
+
+	for {
+		if done, err := t.Step(args); done || err != nil {
+			return err
+		}
+
+		select {
+		case <-time.After(refreshDuration):
+		case <-t.Wake:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Preview returns the orders the trade would place if its condition were met
+// at the current market, without placing them.  `args` are not modified.
+func (t *Trade) Preview(args map[string]interface{}) ([]exchange.Order, error) {
+	dry := exchange.NewDryRun(t.Exchange)
+	dry.Quiet = true
+	p := *t
+	p.Exchange = dry
+	p.preview = true
+	p.Orders = nil
+	p.OnUpdate = nil
+	p.OnNotify = nil
+
+	a := map[string]interface{}{}
+	for k, v := range args {
+		a[k] = v
+	}
+	if err := p.Start(a); err != nil {
+		return nil, err
+	}
+	if err := p.Refresh(a); err != nil {
+		return nil, err
+	}
+
+	// The copy only places dry-run orders, so its resting orders are placed
+	// to be listed along with those placed once the condition is met.
+	if p.arm != nil {
+		if err := p.arm(&p, a); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.doUpdate(a); err != nil {
+		return nil, err
+	}
+	if err := p.execute(&p, a); err != nil {
+		return nil, err
+	}
+	return dry.Orders(), nil
+}
+
+// BuyLimit places a limit buy for the trade's market and records the
+// resulting order UUID in `args` under "OrderUUID".
+func (t *Trade) BuyLimit(args map[string]interface{}, quantity, rate decimal.Decimal) error {
+	t.logf("%s :: placing buy limit for %s %s @ %s\n", t.Name, quantity, t.Currency, rate.StringFixed(8))
+	uuid, err := t.Exchange.BuyLimit(t.Market, quantity, rate)
+	if err != nil {
+		return err
+	}
+
+	t.logf("%s :: placed order %s\n", t.Name, uuid)
+	args["OrderUUID"] = uuid
+	t.Orders = append(t.Orders, uuid)
+	return nil
+}
+
+// Notify logs `msg` and passes it on to OnNotify (if set).
+func (t *Trade) Notify(msg string) {
+	t.logf("%s :: %s\n", t.Name, msg)
+	if t.OnNotify != nil {
+		t.OnNotify(t, msg)
+	}
+}
+
+// SellLimit places a limit sell for the trade's market and records the
+// resulting order UUID in `args` under "OrderUUID".
+func (t *Trade) SellLimit(args map[string]interface{}, quantity, rate decimal.Decimal) error {
+	t.logf("%s :: placing sell limit for %s %s @ %s\n", t.Name, quantity, t.Currency, rate.StringFixed(8))
+	uuid, err := t.Exchange.SellLimit(t.Market, quantity, rate)
+	if err != nil {
+		return err
+	}
+
+	t.logf("%s :: placed order %s\n", t.Name, uuid)
+	args["OrderUUID"] = uuid
+	t.Orders = append(t.Orders, uuid)
+	return nil
+}
+
+// CancelOrder cancels the order `uuid` and waits for the exchange to confirm
+// that it is closed, returning the order's final state.
+func (t *Trade) CancelOrder(uuid string) (exchange.Order, error) {
+	t.logf("%s :: cancelling order %s\n", t.Name, uuid)
+	if err := t.Exchange.CancelOrder(uuid); err != nil {
+		// The order may have been filled in the meantime.
+		o, gerr := t.Exchange.GetOrder(uuid)
+		if gerr != nil || o.IsOpen {
+			return exchange.Order{}, err
+		}
+		return o, nil
+	}
+
+	for i := 0; i < cancelConfirmAttempts; i++ {
+		o, err := t.Exchange.GetOrder(uuid)
+		if err == nil && !o.IsOpen {
+			return o, nil
+		}
+		time.Sleep(cancelConfirmDelay)
+	}
+	return exchange.Order{}, fmt.Errorf("unable to confirm that order %s was cancelled", uuid)
+}
+
+// logf logs a message of the trade, previews are not logged.
+func (t *Trade) logf(format string, args ...interface{}) {
+	if !t.preview {
+		log.Printf(format, args...)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// tradeMarket provides the market data for evaluating a trade's condition.
+// The ticker comes from the last Refresh of `args`.
+type tradeMarket struct {
+	t    *Trade
+	args map[string]interface{}
+}
+
+func (m *tradeMarket) price(key string) decimal.Decimal {
+	d, _ := m.args[key].(decimal.Decimal)
+	return d
+}
+
+func (m *tradeMarket) Last() decimal.Decimal { return m.price("Last") }
+func (m *tradeMarket) Bid() decimal.Decimal  { return m.price("Bid") }
+func (m *tradeMarket) Ask() decimal.Decimal  { return m.price("Ask") }
+
+func (m *tradeMarket) Indicator(spec string) (indicator.Values, error) {
+	s, err := m.t.Indicators.Series(m.t.Market, CandleInterval)
+	if err != nil {
+		return nil, err
+	}
+	return s.Value(spec)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+var tradeMap = map[string]*Trade{}
+
+// Register adds the trade `t` to the set of known trades.
+func Register(t *Trade) {
+	tradeMap[t.Name] = t
+}
+
+// New returns a fresh copy of the trade registered as `name`.
+func New(name string) (*Trade, error) {
+	t, ok := tradeMap[name]
+	if !ok {
+		return nil, fmt.Errorf("invalid trade (%s) specified", name)
+	}
+
+	c := *t
+	c.Orders = nil
+	return &c, nil
+}
+
+// Names returns the sorted names of all registered trades.
+func Names() []string {
+	ns := []string{}
+	for n := range tradeMap {
+		ns = append(ns, n)
+	}
+	sort.Strings(ns)
+	return ns
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// MarketFor returns the BTC market used to trade `currency`.
+func MarketFor(currency string) string {
+	return "BTC-" + strings.ToUpper(currency)
+}
+
+// formatArg formats a trade argument for storage as a string.
+func formatArg(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case decimal.Decimal:
+		return v.String()
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// parseDecimalArg converts the user supplied `args[key]` to a decimal in
+// place.  Empty inputs take the value `def` if `optional` is set, and are an
+// error otherwise.
+func parseDecimalArg(args map[string]interface{}, key string, optional bool, def decimal.Decimal) (decimal.Decimal, error) {
+	switch v := args[key].(type) {
+	case decimal.Decimal:
+		return v, nil
+	case float64:
+		d := decimal.NewFromFloat(v)
+		args[key] = d
+		return d, nil
+	case string:
+		v = strings.TrimSpace(v)
+		if len(v) == 0 {
+			if optional {
+				args[key] = def
+				return def, nil
+			}
+			return decimal.Zero, fmt.Errorf("%s is required", key)
+		}
+
+		d, err := decimal.NewFromString(v)
+		if err != nil {
+			return decimal.Zero, fmt.Errorf("%s: invalid number %q", key, v)
+		}
+		args[key] = d
+		return d, nil
+	case nil:
+		if optional {
+			args[key] = def
+			return def, nil
+		}
+		return decimal.Zero, fmt.Errorf("%s is required", key)
+	}
+	return decimal.Zero, fmt.Errorf("%s: unsupported value %#v", key, args[key])
+}
+
+// parseBoolArg converts the (optional) `args[key]` to a bool in place.
+func parseBoolArg(args map[string]interface{}, key string) bool {
+	b := false
+	switch v := args[key].(type) {
+	case bool:
+		b = v
+	case string:
+		b, _ = strconv.ParseBool(strings.TrimSpace(v))
+	}
+	args[key] = b
+	return b
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -1,9 +1,25 @@
 package types
 
+import "github.com/shopspring/decimal"
+
 // Balance keeps track of the available and total balance for a
-// given currency.
+// given currency.  Amounts are encoded in JSON as strings.
 type Balance struct {
-	Currency  string
-	Available float64
-	Total     float64
+	Currency      string
+	Available     decimal.Decimal
+	Total         decimal.Decimal
+	Pending       decimal.Decimal // deposits not yet confirmed
+	CryptoAddress string          // deposit address, if any
+
+	// Estimated value of the total balance, zero if the currency could not be
+	// priced.
+	BTCValue  decimal.Decimal
+	USDTValue decimal.Decimal
+}
+
+// Portfolio is the estimated value of all balances.
+type Portfolio struct {
+	Balances  []*Balance
+	BTCValue  decimal.Decimal
+	USDTValue decimal.Decimal
 }
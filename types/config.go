@@ -8,11 +8,39 @@ import "time"
 
 // Config encapsulates app wide configuration settings.
 type Config struct {
+	Version         string        // trade-bot version
 	RefreshInterval time.Duration // conditions check refresh interval
 	ApiKey          string        // bittrex api key
 	Secret          string        // bittrex secret
 	DbPath          string        // path to local session db
+	StrategyDir     string        // directory of strategy files to load
+	CandleDir       string        // directory of the local candle store
+	SnapshotPath    string        // path to the portfolio snapshot series
 	Args            []string      // other command line args
+
+	BalanceInterval  time.Duration // balance refresh interval (0 disables)
+	TickerInterval   time.Duration // watched market ticker refresh interval
+	OrderInterval    time.Duration // open order refresh interval
+	SnapshotInterval time.Duration // portfolio snapshot interval (0 disables)
+	OrderRetention   time.Duration // how long closed orders of finished sessions are kept
+
+	DryRun bool // log the orders trades would place instead of placing them
+
+	Paper         bool    // trade against the paper exchange instead of bittrex
+	PaperBalances string  // initial paper balances (file or "BTC:1,PIVX:100")
+	PaperFeed     string  // paper price feed: "live", "synthetic" or a csv path
+	PaperFee      float64 // paper commission as a fraction of each fill
+	PaperSlippage float64 // paper slippage as a fraction of each fill's price
+
+	RiskMaxOrder       float64 // max BTC notional of a single order (0 disables)
+	RiskMarketMaxOrder string  // per market max order notional ("BTC-PIVX:0.5")
+	RiskMaxOpen        float64 // max BTC notional of all open orders (0 disables)
+	RiskMaxDeviation   float64 // max percent from the bid / ask (0 disables)
+	RiskMaxDailyLoss   float64 // max BTC lost in a day before buys stop (0 disables)
+
+	BacktestCandles  string // csv of candles to backtest, blank for the store
+	BacktestInterval string // interval of the backtested candles
+	BacktestEquity   string // path the backtest's equity curve is written to
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,18 @@
+package types
+
+////////////////////////////////////////////////////////////////////////////////
+
+import "time"
+
+////////////////////////////////////////////////////////////////////////////////
+
+// KillSwitch is the state of the global kill switch.  While it is engaged,
+// sessions are not monitored and no new orders are placed until trading is
+// re-armed.
+type KillSwitch struct {
+	Engaged   bool      `json:"Engaged"`
+	EngagedAt time.Time `json:"EngagedAt"`
+	RearmedAt time.Time `json:"RearmedAt"`
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,60 @@
+package types
+
+////////////////////////////////////////////////////////////////////////////////
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// OrderState is the lifecycle of an order placed by the bot:
+//
+//	OPEN -> PARTIALLY_FILLED -> FILLED
+//
+// with OPEN and PARTIALLY_FILLED orders able to transition to CANCELLED.
+type OrderState string
+
+const (
+	OrderOpen            OrderState = "OPEN"             // resting, nothing filled
+	OrderPartiallyFilled OrderState = "PARTIALLY_FILLED" // resting, some filled
+	OrderFilled          OrderState = "FILLED"           // closed, all filled
+	OrderCancelled       OrderState = "CANCELLED"        // closed, not all filled
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Order is an exchange order placed by the bot along with what is known of
+// its fills.  Amounts are encoded in JSON as strings.
+type Order struct {
+	UUID    string `json:"UUID"`
+	Session UUID   `json:"Session,omitempty"` // session which placed the order
+	Market  string `json:"Market"`
+	Type    string `json:"Type"` // exchange.OrderTypeLimitBuy or LimitSell
+
+	Quantity       decimal.Decimal `json:"Quantity"`
+	Limit          decimal.Decimal `json:"Limit"`
+	QuantityFilled decimal.Decimal `json:"QuantityFilled"`
+	AveragePrice   decimal.Decimal `json:"AveragePrice"` // per unit filled
+	Commission     decimal.Decimal `json:"Commission"`
+
+	State     OrderState `json:"State"`
+	PlacedAt  time.Time  `json:"PlacedAt"`
+	UpdatedAt time.Time  `json:"UpdatedAt"`
+	ClosedAt  time.Time  `json:"ClosedAt"`
+}
+
+// IsOpen returns true if the order is still resting on the exchange.
+func (o *Order) IsOpen() bool {
+	return o.State == OrderOpen || o.State == OrderPartiallyFilled
+}
+
+// Clone returns a copy of the order.
+func (o *Order) Clone() *Order {
+	c := *o
+	return &c
+}
+
+////////////////////////////////////////////////////////////////////////////////
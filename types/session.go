@@ -2,7 +2,79 @@ package types
 
 ////////////////////////////////////////////////////////////////////////////////
 
+import "time"
+
+////////////////////////////////////////////////////////////////////////////////
+
+// SessionStatus is the state of a session's state machine:
+//
+//	ARMED -> TRIGGERED -> FILLED
+//
+// with any non terminal state able to transition to CANCELLED or FAILED.
+type SessionStatus string
+
+const (
+	SessionArmed     SessionStatus = "ARMED"     // monitoring the trade's conditions
+	SessionTriggered SessionStatus = "TRIGGERED" // conditions met, orders placed
+	SessionFilled    SessionStatus = "FILLED"    // all orders filled (or none were placed)
+	SessionCancelled SessionStatus = "CANCELLED" // cancelled by the user or exchange
+	SessionFailed    SessionStatus = "FAILED"    // stopped due to an error
+)
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Session is a single conditional order (an instance of a trade) that the app
+// monitors on behalf of the user.
 type Session struct {
+	ID       UUID              `json:"ID"`
+	Market   string            `json:"Market"`   // ex: "BTC-PIVX"
+	Currency string            `json:"Currency"` // ex: "PIVX"
+	Strategy string            `json:"Strategy"` // name of the trade
+	Params   map[string]string `json:"Params"`   // user supplied trade inputs
+	State    map[string]string `json:"State"`    // trade state kept across restarts
+	Status   SessionStatus     `json:"Status"`
+	Error    string            `json:"Error,omitempty"`
+	OrderIDs []string          `json:"OrderIDs"`         // exchange order UUIDs placed
+	DryRun   bool              `json:"DryRun,omitempty"` // armed in dry-run mode, orders are never placed
+
+	CreatedAt   time.Time `json:"CreatedAt"`
+	TriggeredAt time.Time `json:"TriggeredAt"`
+	FilledAt    time.Time `json:"FilledAt"`
+}
+
+// NewSession returns an armed session for the `strategy` on `market`.
+func NewSession(market, currency, strategy string, params map[string]string) *Session {
+	return &Session{
+		ID:        NewUUID(),
+		Market:    market,
+		Currency:  currency,
+		Strategy:  strategy,
+		Params:    params,
+		State:     map[string]string{},
+		Status:    SessionArmed,
+		OrderIDs:  []string{},
+		CreatedAt: time.Now(),
+	}
+}
+
+// IsActive returns true if the session still needs to be monitored.
+func (s *Session) IsActive() bool {
+	return s.Status == SessionArmed || s.Status == SessionTriggered
+}
+
+// Clone returns a deep copy of the session.
+func (s *Session) Clone() *Session {
+	c := *s
+	c.Params = map[string]string{}
+	for k, v := range s.Params {
+		c.Params[k] = v
+	}
+	c.State = map[string]string{}
+	for k, v := range s.State {
+		c.State[k] = v
+	}
+	c.OrderIDs = append([]string{}, s.OrderIDs...)
+	return &c
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -6,9 +6,15 @@ import "encoding/json"
 
 ////////////////////////////////////////////////////////////////////////////////
 
+// SocketMessage is sent from the server to websocket clients.  Responses to a
+// client's request carry the request's `ID`, failed requests set `Error` and
+// messages published to a topic carry the `Topic`.
 type SocketMessage struct {
-	Type string      `json:"Type"`
-	Data interface{} `json:"Data"`
+	ID    string      `json:"ID,omitempty"`
+	Topic string      `json:"Topic,omitempty"`
+	Type  string      `json:"Type"`
+	Data  interface{} `json:"Data"`
+	Error string      `json:"Error,omitempty"`
 }
 
 func NewSocketMessage(t string, d interface{}) *SocketMessage {
@@ -18,8 +24,45 @@ func NewSocketMessage(t string, d interface{}) *SocketMessage {
 	}
 }
 
+// NewTopicMessage returns a message of type `t` published to `topic`.
+func NewTopicMessage(topic, t string, d interface{}) *SocketMessage {
+	return &SocketMessage{
+		Topic: topic,
+		Type:  t,
+		Data:  d,
+	}
+}
+
+// NewSocketResponse returns the response of type `t` to the request `id`.
+func NewSocketResponse(id, t string, d interface{}) *SocketMessage {
+	return &SocketMessage{
+		ID:   id,
+		Type: t,
+		Data: d,
+	}
+}
+
+// NewSocketError returns an error response to the request `id`.
+func NewSocketError(id string, err error) *SocketMessage {
+	return &SocketMessage{
+		ID:    id,
+		Type:  "Error",
+		Error: err.Error(),
+	}
+}
+
 func (sm *SocketMessage) Marshal() ([]byte, error) {
 	return json.Marshal(sm)
 }
 
 ////////////////////////////////////////////////////////////////////////////////
+
+// SocketRequest is sent from websocket clients to the server.  The `Data`
+// is decoded based on the request's `Type`.
+type SocketRequest struct {
+	ID   string          `json:"ID"`
+	Type string          `json:"Type"`
+	Data json.RawMessage `json:"Data"`
+}
+
+////////////////////////////////////////////////////////////////////////////////